@@ -0,0 +1,177 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var ErrMalformedAccountID = errors.New("malformed account id")
+
+type AccountIDFormat int
+
+const (
+	// AccountIDLegacy concatenates the client ID and the player ID as older releases did.
+	// Decoding splits them at a fixed width, LegacyWidth or, when zero, the length of the
+	// ACCOUNT_PREFIX environment variable.
+	AccountIDLegacy AccountIDFormat = iota
+	// AccountIDDelimited writes the client ID, Delimiter and the player ID. Client IDs are
+	// digits only, so splitting on the first delimiter is unambiguous for any player ID.
+	AccountIDDelimited
+)
+
+const defaultAccountIDDelimiter = "."
+
+// AccountID identifies a player of one operator.
+type AccountID struct {
+	ClientID int64
+	PlayerID string
+}
+
+// AccountIDCodec converts between AccountID and the composite string handed to games.
+type AccountIDCodec struct {
+	Format      AccountIDFormat
+	Delimiter   string
+	LegacyWidth int
+}
+
+// ParseAccountIDFormat accepts "legacy" or "delimited". An empty name is legacy.
+func ParseAccountIDFormat(name string) (AccountIDFormat, error) {
+
+	switch strings.ToLower(strings.TrimSpace(name)) {
+
+	case "", "legacy":
+		return AccountIDLegacy, nil
+
+	case "delimited":
+		return AccountIDDelimited, nil
+	}
+
+	return 0, fmt.Errorf("unsupported account id format %q", name)
+}
+
+// DefaultAccountIDCodec returns the codec selected by the ACCOUNT_ID_FORMAT environment
+// variable, with the delimiter from ACCOUNT_ID_DELIMITER. It is the legacy codec, which
+// matches IDs issued by older releases, unless ACCOUNT_ID_FORMAT is "delimited". An
+// unknown format yields a codec that fails Validate, so NewWallet and NewSessionStore
+// reject it at startup.
+func DefaultAccountIDCodec() AccountIDCodec {
+
+	format, err := ParseAccountIDFormat(os.Getenv("ACCOUNT_ID_FORMAT"))
+	if err != nil {
+
+		format = -1
+	}
+
+	return AccountIDCodec{Format: format, Delimiter: os.Getenv("ACCOUNT_ID_DELIMITER")}
+}
+
+func (c AccountIDCodec) delimiter() string {
+
+	if len(c.Delimiter) > 0 {
+
+		return c.Delimiter
+	}
+
+	return defaultAccountIDDelimiter
+}
+
+func (c AccountIDCodec) legacyWidth() int {
+
+	if c.LegacyWidth > 0 {
+
+		return c.LegacyWidth
+	}
+
+	return len(os.Getenv("ACCOUNT_PREFIX"))
+}
+
+// Validate checks the codec configuration. A legacy codec without a width is valid, since
+// encoding does not need one, but it cannot decode.
+func (c AccountIDCodec) Validate() error {
+
+	switch c.Format {
+
+	case AccountIDLegacy:
+		if c.LegacyWidth < 0 {
+
+			return fmt.Errorf("legacy account id width %d is negative", c.LegacyWidth)
+		}
+
+	case AccountIDDelimited:
+		if strings.ContainsAny(c.delimiter(), "0123456789-") {
+
+			return fmt.Errorf("account id delimiter %q must not contain digits or '-'", c.delimiter())
+		}
+
+	default:
+		return fmt.Errorf("unsupported account id format %d", c.Format)
+	}
+
+	return nil
+}
+
+// Encode returns the composite ID of id. The legacy format is a plain concatenation, so
+// that IDs keep matching what older releases handed out.
+func (c AccountIDCodec) Encode(id AccountID) (string, error) {
+
+	err := c.Validate()
+	if err != nil {
+
+		return "", err
+	}
+
+	if c.Format == AccountIDLegacy {
+
+		return fmt.Sprintf("%d%s", id.ClientID, id.PlayerID), nil
+	}
+
+	if id.ClientID <= 0 || len(id.PlayerID) == 0 {
+
+		return "", fmt.Errorf("%w: client and player id are required", ErrMalformedAccountID)
+	}
+
+	return strconv.FormatInt(id.ClientID, 10) + c.delimiter() + id.PlayerID, nil
+}
+
+func (c AccountIDCodec) Decode(s string) (AccountID, error) {
+
+	err := c.Validate()
+	if err != nil {
+
+		return AccountID{}, err
+	}
+
+	var client, player string
+
+	switch c.Format {
+
+	case AccountIDLegacy:
+		width := c.legacyWidth()
+		if width == 0 || len(s) <= width {
+
+			return AccountID{}, fmt.Errorf("%w: %q", ErrMalformedAccountID, s)
+		}
+
+		client, player = s[:width], s[width:]
+
+	case AccountIDDelimited:
+		var found bool
+		client, player, found = strings.Cut(s, c.delimiter())
+		if !found || len(player) == 0 {
+
+			return AccountID{}, fmt.Errorf("%w: %q", ErrMalformedAccountID, s)
+		}
+
+	}
+
+	clientID, err := strconv.ParseInt(client, 10, 64)
+	if err != nil || clientID <= 0 || strings.HasPrefix(client, "+") {
+
+		return AccountID{}, fmt.Errorf("%w: invalid client id in %q", ErrMalformedAccountID, s)
+	}
+
+	return AccountID{ClientID: clientID, PlayerID: player}, nil
+}
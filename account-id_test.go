@@ -0,0 +1,168 @@
+package wallet
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAccountIDCodecRoundTrip(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		codec   AccountIDCodec
+		id      AccountID
+		encoded string
+	}{
+		{"legacy", AccountIDCodec{LegacyWidth: 3}, AccountID{ClientID: 101, PlayerID: "p42"}, "101p42"},
+		{"legacy numeric player", AccountIDCodec{LegacyWidth: 2}, AccountID{ClientID: 12, PlayerID: "345"}, "12345"},
+		{"delimited", AccountIDCodec{Format: AccountIDDelimited}, AccountID{ClientID: 7, PlayerID: "p42"}, "7.p42"},
+		{"delimited player with delimiter", AccountIDCodec{Format: AccountIDDelimited}, AccountID{ClientID: 1234, PlayerID: "a.b"}, "1234.a.b"},
+		{"custom delimiter", AccountIDCodec{Format: AccountIDDelimited, Delimiter: "_"}, AccountID{ClientID: 7, PlayerID: "42"}, "7_42"},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			encoded, err := tt.codec.Encode(tt.id)
+			if err != nil {
+
+				t.Fatal(err)
+			}
+
+			if encoded != tt.encoded {
+
+				t.Fatalf("Encode = %q, want %q", encoded, tt.encoded)
+			}
+
+			decoded, err := tt.codec.Decode(encoded)
+			if err != nil {
+
+				t.Fatal(err)
+			}
+
+			if decoded != tt.id {
+
+				t.Fatalf("Decode = %+v, want %+v", decoded, tt.id)
+			}
+		})
+	}
+}
+
+func TestAccountIDLegacyWithoutPrefix(t *testing.T) {
+
+	t.Setenv("ACCOUNT_PREFIX", "")
+
+	codec := DefaultAccountIDCodec()
+
+	encoded, err := codec.Encode(AccountID{ClientID: 12345, PlayerID: "p1"})
+	if err != nil || encoded != "12345p1" {
+
+		t.Fatalf("Encode = %q, %v, want the plain concatenation", encoded, err)
+	}
+
+	_, err = codec.Decode(encoded)
+	if !errors.Is(err, ErrMalformedAccountID) {
+
+		t.Fatalf("Decode without a width = %v, want ErrMalformedAccountID", err)
+	}
+
+	t.Setenv("ACCOUNT_PREFIX", "12345")
+
+	decoded, err := codec.Decode(encoded)
+	if err != nil || decoded != (AccountID{ClientID: 12345, PlayerID: "p1"}) {
+
+		t.Fatalf("Decode with ACCOUNT_PREFIX = %+v, %v", decoded, err)
+	}
+}
+
+func TestAccountIDCodecDecodeMalformed(t *testing.T) {
+
+	tests := []struct {
+		codec AccountIDCodec
+		s     string
+	}{
+		{AccountIDCodec{LegacyWidth: 3}, "101"},
+		{AccountIDCodec{LegacyWidth: 3}, "1x1p42"},
+		{AccountIDCodec{LegacyWidth: 3}, "000p42"},
+		{AccountIDCodec{LegacyWidth: 3}, "+10p42"},
+		{AccountIDCodec{Format: AccountIDDelimited}, "7"},
+		{AccountIDCodec{Format: AccountIDDelimited}, "7."},
+		{AccountIDCodec{Format: AccountIDDelimited}, "-7.p42"},
+		{AccountIDCodec{Format: AccountIDDelimited}, "x.p42"},
+	}
+
+	for _, tt := range tests {
+
+		_, err := tt.codec.Decode(tt.s)
+		if !errors.Is(err, ErrMalformedAccountID) {
+
+			t.Errorf("Decode(%q) = %v, want ErrMalformedAccountID", tt.s, err)
+		}
+	}
+}
+
+func TestAccountIDCodecValidate(t *testing.T) {
+
+	tests := []AccountIDCodec{
+		{LegacyWidth: -1},
+		{Format: AccountIDDelimited, Delimiter: "1"},
+		{Format: AccountIDDelimited, Delimiter: "-"},
+		{Format: 9},
+	}
+
+	for _, codec := range tests {
+
+		err := codec.Validate()
+		if err == nil {
+
+			t.Errorf("Validate(%+v) accepted an invalid codec", codec)
+		}
+
+		_, err = codec.Encode(AccountID{ClientID: 1, PlayerID: "p"})
+		if err == nil {
+
+			t.Errorf("Encode with %+v succeeded", codec)
+		}
+	}
+}
+
+func TestDefaultAccountIDCodecFormat(t *testing.T) {
+
+	t.Setenv("ACCOUNT_PREFIX", "")
+	t.Setenv("ACCOUNT_ID_FORMAT", "")
+
+	// Older releases returned the whole token when ACCOUNT_PREFIX was not set.
+	token, client := GetUserTokenAndClient("12345p1")
+	if token != "12345p1" || client != 0 {
+
+		t.Fatalf("GetUserTokenAndClient without ACCOUNT_PREFIX = %q, %d", token, client)
+	}
+
+	t.Setenv("ACCOUNT_ID_FORMAT", "delimited")
+
+	if DefaultAccountIDCodec().Format != AccountIDDelimited {
+
+		t.Fatal("ACCOUNT_ID_FORMAT=delimited did not select the delimited codec")
+	}
+
+	user, client := GetUserAndClient("12345.p1")
+	if user != "p1" || client != 12345 {
+
+		t.Fatalf("GetUserAndClient with the delimited codec = %q, %d", user, client)
+	}
+
+	signer, err := NewTokenSigner(hmacKey("k1"))
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	t.Setenv("ACCOUNT_ID_FORMAT", "dotted")
+
+	_, err = NewSessionStore(TokenModeSigned, nil, KeySpace{Prefix: "test"}, signer)
+	if err == nil {
+
+		t.Fatal("unknown ACCOUNT_ID_FORMAT accepted")
+	}
+}
@@ -3,131 +3,120 @@ package wallet
 import (
 	"context"
 	"database/sql"
-	goutils "github.com/mudphilo/go-utils"
-	"github.com/sirupsen/logrus"
+	"errors"
 	"go.opentelemetry.io/otel/trace"
-	"os"
-	"strconv"
 )
 
-func GetUserTokenAndClient(token string) (tokenString string, clientID int64) {
+var ErrClientNotFound = errors.New("client not found")
 
-	prefix := os.Getenv("ACCOUNT_PREFIX")
-	UserIDLength := len(prefix)
+// GetUserTokenAndClient splits a client-prefixed token with DefaultAccountIDCodec.
+// Malformed tokens return an empty token and client 0. As in older releases, a legacy
+// codec without ACCOUNT_PREFIX returns the token whole with client 0.
+func GetUserTokenAndClient(token string) (tokenString string, clientID int64) {
 
-	if len(token) < UserIDLength {
+	return splitAccountID(token)
+}
 
-		return "", 0
-	}
+// GetUserAndClient splits an account ID with DefaultAccountIDCodec. Malformed IDs return
+// an empty user and client 0, and a legacy codec without ACCOUNT_PREFIX returns the ID
+// whole with client 0; use AccountIDCodec.Decode to get the error.
+func GetUserAndClient(accountId string) (userID string, clientID int64) {
 
-	client, _ := strconv.ParseInt(token[0:UserIDLength], 10, 64)
-	token = token[UserIDLength:]
-	return token, client
+	return splitAccountID(accountId)
 }
 
-func GetUserAndClient(accountId string) (userID string, clientID int64) {
+func splitAccountID(s string) (string, int64) {
 
-	prefix := os.Getenv("ACCOUNT_PREFIX")
-	UserIDLength := len(prefix)
-	if len(accountId) < UserIDLength {
+	codec := DefaultAccountIDCodec()
+	if codec.Format == AccountIDLegacy && codec.legacyWidth() == 0 {
 
-		return "", 0
+		return s, 0
 	}
 
-	client, _ := strconv.ParseInt(accountId[0:UserIDLength], 10, 64)
-	user := accountId[UserIDLength:]
-
-	return user, client
-}
+	id, err := codec.Decode(s)
+	if err != nil {
 
-func CreateClient(tr trace.Tracer, ctx context.Context, db *sql.DB, client Client) error {
+		return "", 0
+	}
 
-	ctx, span := tr.Start(ctx, "CreateClient")
-	defer span.End()
+	return id.PlayerID, id.ClientID
+}
 
-	dbUtils := goutils.Db{DB: db, Context: ctx}
+// The functions below keep the original *sql.DB based API and assume MySQL. Use a
+// ClientStore for other dialects.
 
-	inserts := map[string]interface{}{
-		"account":               client.ID,
-		"authentication_header": client.AuthenticationHeader,
-		"authentication_string": client.AuthenticationString,
-		"base_url":              client.BaseURL,
-	}
+// CreateClient stores client, encrypting its secret when CLIENT_SECRET_KEYS is set.
+func CreateClient(tr trace.Tracer, ctx context.Context, db *sql.DB, client Client) error {
 
-	_, err := dbUtils.UpsertWithContext("clients", inserts, []string{"account", "authentication_header", "authentication_string", "base_url"})
+	client, err := encryptLegacyClient(ctx, client)
 	if err != nil {
 
-		logrus.WithContext(ctx).
-			WithFields(logrus.Fields{
-				"description": "error creating  new client",
-				"data":        inserts,
-			}).
-			Error(err.Error())
-
 		return err
-
 	}
 
-	return err
-
+	return NewClientStore(tr, db, DialectMySQL).Create(ctx, client)
 }
 
 func DeleteClient(tr trace.Tracer, ctx context.Context, db *sql.DB, id int64) error {
 
-	ctx, span := tr.Start(ctx, "DeleteClient")
-	defer span.End()
+	return NewClientStore(tr, db, DialectMySQL).Delete(ctx, id)
+}
 
-	dbUtils := goutils.Db{DB: db, Context: ctx}
+// GetClient returns the client with its secret decrypted by the CLIENT_SECRET_KEYS cipher.
+// A client with an encrypted secret is an error when the keys are not set.
+func GetClient(tr trace.Tracer, ctx context.Context, db *sql.DB, clientID int64) (Client, error) {
 
-	_, err := dbUtils.DeleteWithContext("clients", map[string]interface{}{"account": id})
+	client, err := NewClientStore(tr, db, DialectMySQL).Get(ctx, clientID)
 	if err != nil {
 
-		logrus.WithContext(ctx).
-			WithFields(logrus.Fields{
-				"description": "error deleting client",
-				"data":        id,
-			}).
-			Error(err.Error())
+		return Client{}, err
+	}
 
-		return err
+	if len(client.AuthenticationKeyID) == 0 {
 
+		return client, nil
 	}
 
-	return err
+	c, err := NewEnvSecretCipher()
+	if err != nil {
+
+		return Client{}, err
+	}
 
+	return decryptClientSecret(ctx, c, client)
 }
 
-func GetClient(tr trace.Tracer, ctx context.Context, db *sql.DB, clientID int64) Client {
+func ListClients(tr trace.Tracer, ctx context.Context, db *sql.DB, filter ClientFilter) ([]Client, error) {
 
-	ctx, span := tr.Start(ctx, "GetClient")
-	defer span.End()
+	return NewClientStore(tr, db, DialectMySQL).List(ctx, filter)
+}
 
-	query := "SELECT base_url, authentication_header,authentication_string FROM clients WHERE account = ? "
-	dbUtils := goutils.Db{DB: db, Context: ctx}
-	dbUtils.SetQuery(query)
-	dbUtils.SetParams(clientID)
+// UpdateClient updates client, encrypting its secret when CLIENT_SECRET_KEYS is set.
+func UpdateClient(tr trace.Tracer, ctx context.Context, db *sql.DB, client Client) error {
 
-	var base_url, authenticationHeader, authenticationString sql.NullString
-	err := dbUtils.FetchOneWithContext().Scan(&base_url, &authenticationHeader, &authenticationString)
+	client, err := encryptLegacyClient(ctx, client)
 	if err != nil {
 
-		logrus.WithContext(ctx).
-			WithFields(logrus.Fields{
-				"description": "error retrieving client details",
-			}).
-			Error(err.Error())
+		return err
+	}
+
+	return NewClientStore(tr, db, DialectMySQL).Update(ctx, client)
+}
 
-		return Client{}
+// encryptLegacyClient encrypts the secret of client for the package level functions, which
+// take their keys from the environment. Without keys the client is stored as given.
+func encryptLegacyClient(ctx context.Context, client Client) (Client, error) {
 
-	}
+	c, err := NewEnvSecretCipher()
+	if err != nil || c == nil {
 
-	client := Client{
-		ID:                   clientID,
-		BaseURL:              base_url.String,
-		AuthenticationHeader: authenticationHeader.String,
-		AuthenticationString: authenticationString.String,
+		return client, err
 	}
 
-	return client
+	return encryptClientSecret(ctx, c, client)
+}
+
+func SetClientStatus(tr trace.Tracer, ctx context.Context, db *sql.DB, id int64, status ClientStatus) error {
 
+	return NewClientStore(tr, db, DialectMySQL).SetStatus(ctx, id, status)
 }
@@ -0,0 +1,434 @@
+// Package adapter translates the callback APIs of third-party game studios into wallet
+// calls. Each studio is served by an Adapter that authenticates its callbacks, decodes
+// them into a Request and encodes the Result the way the studio expects; Handler does
+// the rest: resolving the session token, loading the operator and calling the wallet.
+package adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	wallet "github.com/touchvas/casino-wallet"
+)
+
+const maxCallbackBytes = 1 << 20
+
+type Action string
+
+const (
+	ActionBalance Action = "balance"
+	ActionBet     Action = "bet"
+	ActionWin     Action = "win"
+	ActionRefund  Action = "refund"
+)
+
+// Outcomes of a callback, in addition to the wallet outcome codes.
+const (
+	OutcomeUnauthorized = "unauthorized"
+	OutcomeInvalidToken = "invalid_token"
+	OutcomeBadRequest   = "bad_request"
+)
+
+var (
+	ErrUnauthorized  = errors.New("unauthorized")
+	ErrUnknownAction = errors.New("unknown action")
+)
+
+// Request is a studio callback in wallet terms. Reference is the bet a win or refund
+// settles.
+type Request struct {
+	Action        Action
+	Token         string
+	PlayerID      string
+	TransactionID string
+	Reference     string
+	RoundID       string
+	GameID        string
+	GameName      string
+	SessionID     string
+	Amount        float64
+	Currency      string
+}
+
+// Result is the answer to a callback. Outcome is one of the wallet outcome codes or of
+// this package's; Balance is set whenever the player's balance is known.
+type Result struct {
+	Outcome     string
+	Balance     float64
+	Bonus       float64
+	Currency    string
+	HasBalance  bool
+	Description string
+}
+
+// Adapter speaks the callback API of one studio.
+type Adapter interface {
+	// Name identifies the studio and is the first path segment of its callbacks in a Registry.
+	Name() string
+	Authenticate(r *http.Request, body []byte) error
+	Decode(r *http.Request, body []byte) (Request, error)
+	Encode(rw http.ResponseWriter, req Request, res Result)
+}
+
+// SessionValidator resolves a session token. wallet.SessionStore implements it, looking
+// up Redis tokens with GetProfileIDFromtoken.
+type SessionValidator interface {
+	Validate(ctx context.Context, token string) (*wallet.SessionClaims, error)
+}
+
+// ClientResolver loads an operator. wallet.ClientRegistry and wallet.ClientStore implement it.
+type ClientResolver interface {
+	Get(ctx context.Context, id int64) (wallet.Client, error)
+}
+
+// Handler serves the callbacks of one studio. Wins and refunds are paid after the
+// session of their bet ended and while the operator is in maintenance: the account is then
+// resolved from Bets, which records every bet, or from an account ID in the payload.
+type Handler struct {
+	Adapter  Adapter
+	Wallet   *wallet.Wallet
+	Sessions SessionValidator
+	Clients  ClientResolver
+	Bets     BetIndex
+}
+
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+
+	body, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, maxCallbackBytes))
+	if err != nil {
+
+		h.Adapter.Encode(rw, Request{}, Result{Outcome: OutcomeBadRequest, Description: "unreadable body"})
+		return
+	}
+
+	err = h.Adapter.Authenticate(r, body)
+	if err != nil {
+
+		h.Adapter.Encode(rw, Request{}, Result{Outcome: OutcomeUnauthorized, Description: err.Error()})
+		return
+	}
+
+	req, err := h.Adapter.Decode(r, body)
+	if err != nil {
+
+		h.Adapter.Encode(rw, req, Result{Outcome: OutcomeBadRequest, Description: err.Error()})
+		return
+	}
+
+	h.Adapter.Encode(rw, req, h.handle(r.Context(), req))
+}
+
+func (h *Handler) handle(ctx context.Context, req Request) Result {
+
+	claims, err := h.Sessions.Validate(ctx, req.Token)
+	if err != nil || claims.ClientID <= 0 {
+
+		claims = h.settlementClaims(ctx, req)
+		if claims == nil {
+
+			return Result{Outcome: OutcomeInvalidToken, Description: "invalid session token"}
+		}
+	} else if len(req.PlayerID) > 0 && req.PlayerID != claims.PlayerID {
+
+		return Result{Outcome: OutcomeInvalidToken, Description: "token does not belong to the player"}
+	}
+
+	client, err := h.Clients.Get(ctx, claims.ClientID)
+	if err != nil {
+
+		return Result{Outcome: wallet.OutcomeError, Description: "operator not found"}
+	}
+
+	if !available(client.Status, req.Action) {
+
+		return Result{Outcome: wallet.OutcomeError, Description: "operator unavailable"}
+	}
+
+	if len(req.SessionID) == 0 {
+
+		req.SessionID = claims.SessionID
+	}
+
+	if len(req.GameID) == 0 {
+
+		req.GameID = claims.GameID
+	}
+
+	player := claims.PlayerID
+
+	switch req.Action {
+
+	case ActionBalance:
+		prof, err := h.Wallet.GetWalletProfile(ctx, client, player)
+		if err != nil {
+
+			return result(0, err, "")
+		}
+
+		return Result{Outcome: wallet.OutcomeSuccess, Balance: prof.Balance, Bonus: prof.Bonus, Currency: prof.Currency, HasBalance: true}
+
+	case ActionBet:
+		if h.Bets != nil {
+
+			// A bet that cannot be recorded is refused: its win or refund could not be paid
+			// once the session ends.
+			err := h.Bets.Remember(ctx, h.betKey(req.TransactionID), wallet.AccountID{ClientID: claims.ClientID, PlayerID: player})
+			if err != nil {
+
+				return h.withBalance(ctx, client, player, Result{Outcome: wallet.OutcomeError, Description: "bet could not be recorded"})
+			}
+		}
+
+		resp, err := h.Wallet.DebitWalletProfile(ctx, client, wallet.Debit{
+			PlayerID:      player,
+			GameName:      req.GameName,
+			GameID:        req.GameID,
+			TransactionID: req.TransactionID,
+			Amount:        req.Amount,
+			SessionID:     req.SessionID,
+			RoundID:       req.RoundID,
+		})
+		if resp == nil {
+
+			return h.withBalance(ctx, client, player, result(0, err, ""))
+		}
+
+		return h.withBalance(ctx, client, player, transactionResult(resp.Status, err, resp.Description, resp.Balance, resp.BonusBalance, resp.Currency))
+
+	case ActionWin:
+		resp, err := h.Wallet.CreditWalletProfile(ctx, client, wallet.Credit{
+			PlayerID:           player,
+			GameName:           req.GameName,
+			GameID:             req.GameID,
+			TransactionID:      req.TransactionID,
+			DebitTransactionID: req.Reference,
+			Amount:             req.Amount,
+			SessionID:          req.SessionID,
+			RoundID:            req.RoundID,
+		})
+		if resp == nil {
+
+			return h.withBalance(ctx, client, player, result(0, err, ""))
+		}
+
+		return h.withBalance(ctx, client, player, transactionResult(resp.Status, err, resp.Description, resp.Balance, resp.BonusBalance, resp.Currency))
+
+	case ActionRefund:
+		resp, err := h.Wallet.BetRollback(ctx, client, wallet.Rollback{
+			PlayerID:           player,
+			TransactionID:      req.TransactionID,
+			DebitTransactionID: req.Reference,
+			Amount:             req.Amount,
+			SessionID:          req.SessionID,
+			RoundID:            req.RoundID,
+		})
+		if resp == nil {
+
+			return h.withBalance(ctx, client, player, result(0, err, ""))
+		}
+
+		return h.withBalance(ctx, client, player, transactionResult(resp.Status, err, resp.Description, resp.Balance, resp.BonusBalance, resp.Currency))
+	}
+
+	return Result{Outcome: OutcomeBadRequest, Description: fmt.Sprintf("%v %q", ErrUnknownAction, req.Action)}
+}
+
+// settlementClaims resolves the account of a win or refund whose session token no longer
+// validates from the bet it settles. Only the account recorded for that bet is trusted: an
+// account ID in the payload could name any operator's player. It returns nil for other
+// actions and for bets that were not recorded.
+func (h *Handler) settlementClaims(ctx context.Context, req Request) *wallet.SessionClaims {
+
+	if req.Action != ActionWin && req.Action != ActionRefund {
+
+		return nil
+	}
+
+	if h.Bets == nil || len(req.Reference) == 0 {
+
+		return nil
+	}
+
+	account, err := h.Bets.Lookup(ctx, h.betKey(req.Reference))
+	if err != nil || (len(req.PlayerID) > 0 && req.PlayerID != account.PlayerID) {
+
+		return nil
+	}
+
+	return &wallet.SessionClaims{ClientID: account.ClientID, PlayerID: account.PlayerID}
+}
+
+func (h *Handler) betKey(transactionID string) string {
+
+	return h.Adapter.Name() + ":" + transactionID
+}
+
+// available reports whether an operator with status takes action. Operators in
+// maintenance take no new bets but are still paid the wins and refunds of earlier ones.
+func available(status wallet.ClientStatus, action Action) bool {
+
+	switch status {
+
+	case "", wallet.ClientStatusActive:
+		return true
+
+	case wallet.ClientStatusMaintenance:
+		return action == ActionWin || action == ActionRefund
+	}
+
+	return false
+}
+
+// result classifies the answer of a wallet call: declined debits answer 402, duplicates
+// 409, anything else that is not an error is a success. Errors carry operator answers,
+// which are not passed on to the studio.
+func result(status int64, err error, description string) Result {
+
+	switch {
+
+	case err != nil:
+		return Result{Outcome: wallet.OutcomeError, Description: "wallet error"}
+
+	case status == http.StatusPaymentRequired:
+		return Result{Outcome: wallet.OutcomeInsufficientFunds, Description: description}
+
+	case status == http.StatusConflict:
+		return Result{Outcome: wallet.OutcomeDuplicate, Description: description}
+	}
+
+	return Result{Outcome: wallet.OutcomeSuccess, Description: description}
+}
+
+func transactionResult(status int64, err error, description string, balance, bonus float64, currency string) Result {
+
+	res := result(status, err, description)
+
+	if res.Outcome == wallet.OutcomeSuccess {
+
+		res.Balance, res.Bonus, res.Currency, res.HasBalance = balance, bonus, currency, true
+	}
+
+	return res
+}
+
+// withBalance looks up the balance of a declined or failed transaction, since most studios
+// expect the current balance in every answer.
+func (h *Handler) withBalance(ctx context.Context, client wallet.Client, player string, res Result) Result {
+
+	if res.HasBalance {
+
+		return res
+	}
+
+	prof, err := h.Wallet.GetWalletProfile(ctx, client, player)
+	if err == nil {
+
+		res.Balance, res.Bonus, res.Currency, res.HasBalance = prof.Balance, prof.Bonus, prof.Currency, true
+	}
+
+	return res
+}
+
+// Registry serves the callbacks of several studios, routing /<name>/... to the adapter
+// registered under name.
+type Registry struct {
+	Wallet   *wallet.Wallet
+	Sessions SessionValidator
+	Clients  ClientResolver
+	Bets     BetIndex
+
+	mu       sync.RWMutex
+	adapters map[string]Adapter
+}
+
+func NewRegistry(w *wallet.Wallet, sessions SessionValidator, clients ClientResolver) *Registry {
+
+	return &Registry{
+		Wallet:   w,
+		Sessions: sessions,
+		Clients:  clients,
+		adapters: make(map[string]Adapter),
+	}
+}
+
+// Register adds a studio adapter, rejecting a name that is already registered and an
+// adapter whose Validate method fails.
+func (r *Registry) Register(a Adapter) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := a.Name()
+	if len(name) == 0 || strings.Contains(name, "/") {
+
+		return fmt.Errorf("invalid adapter name %q", name)
+	}
+
+	if v, ok := a.(interface{ Validate() error }); ok {
+
+		err := v.Validate()
+		if err != nil {
+
+			return err
+		}
+	}
+
+	if _, ok := r.adapters[name]; ok {
+
+		return fmt.Errorf("adapter %q is already registered", name)
+	}
+
+	if r.adapters == nil {
+
+		r.adapters = make(map[string]Adapter)
+	}
+
+	r.adapters[name] = a
+	return nil
+}
+
+func (r *Registry) Get(name string) (Adapter, bool) {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	a, ok := r.adapters[name]
+	return a, ok
+}
+
+// Names returns the registered studio names in order.
+func (r *Registry) Names() []string {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.adapters))
+	for name := range r.adapters {
+
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func (r *Registry) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+
+	name, _, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/"), "/")
+
+	a, ok := r.Get(name)
+	if !ok {
+
+		http.NotFound(rw, req)
+		return
+	}
+
+	h := &Handler{Adapter: a, Wallet: r.Wallet, Sessions: r.Sessions, Clients: r.Clients, Bets: r.Bets}
+	http.StripPrefix("/"+name, h).ServeHTTP(rw, req)
+}
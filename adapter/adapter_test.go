@@ -0,0 +1,176 @@
+package adapter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	wallet "github.com/touchvas/casino-wallet"
+	"github.com/touchvas/casino-wallet/simulator"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// sessions is a SessionValidator over a fixed set of live tokens.
+type sessions map[string]wallet.SessionClaims
+
+func (s sessions) Validate(ctx context.Context, token string) (*wallet.SessionClaims, error) {
+
+	claims, ok := s[token]
+	if !ok {
+
+		return nil, wallet.ErrTokenExpired
+	}
+
+	return &claims, nil
+}
+
+// clients is a ClientResolver over a fixed set of operators.
+type clients map[int64]*wallet.Client
+
+func (c clients) Get(ctx context.Context, id int64) (wallet.Client, error) {
+
+	client, ok := c[id]
+	if !ok {
+
+		return wallet.Client{}, wallet.ErrClientNotFound
+	}
+
+	return *client, nil
+}
+
+func newTestHandler(t *testing.T) (*Handler, *simulator.Simulator, *wallet.Client) {
+
+	t.Helper()
+
+	sim := simulator.New("X-Api-Key", "secret")
+	sim.SetPlayer("p1", 100)
+
+	server := sim.Start()
+	t.Cleanup(server.Close)
+
+	mr := miniredis.RunT(t)
+	conn := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { conn.Close() })
+
+	w, err := wallet.NewWallet(noop.NewTracerProvider().Tracer("test"), wallet.ProviderIdentity{ID: 1, Name: "test"})
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	client := &wallet.Client{ID: 7, BaseURL: server.URL, AuthenticationHeader: "X-Api-Key", AuthenticationString: "secret", Status: wallet.ClientStatusActive}
+
+	h := &Handler{
+		Adapter:  NewGenericAdapter("studio", "X-Studio-Key", "studio-secret"),
+		Wallet:   w,
+		Sessions: sessions{"live": {ClientID: 7, PlayerID: "p1", SessionID: "s1"}},
+		Clients:  clients{7: client},
+		Bets:     NewRedisBetIndex(conn, wallet.KeySpace{Prefix: "test"}),
+	}
+
+	return h, sim, client
+}
+
+func callback(t *testing.T, h *Handler, body string) *httptest.ResponseRecorder {
+
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodPost, "/callback", strings.NewReader(body))
+	r.Header.Set("X-Studio-Key", "studio-secret")
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, r)
+	return rw
+}
+
+func TestHandlerPaysWinAfterSessionEnds(t *testing.T) {
+
+	h, sim, client := newTestHandler(t)
+
+	rw := callback(t, h, `{"action":"bet","token":"live","transaction_id":"b1","amount":10}`)
+	if rw.Code != http.StatusOK {
+
+		t.Fatalf("bet = %d %s", rw.Code, rw.Body.String())
+	}
+
+	// The session ended and the operator was put in maintenance before the round settled.
+	client.Status = wallet.ClientStatusMaintenance
+
+	rw = callback(t, h, `{"action":"bet","token":"live","transaction_id":"b2","amount":10}`)
+	if rw.Code == http.StatusOK {
+
+		t.Fatal("bet accepted for an operator in maintenance")
+	}
+
+	rw = callback(t, h, `{"action":"win","token":"expired","transaction_id":"w1","reference":"b1","amount":25}`)
+	if rw.Code != http.StatusOK {
+
+		t.Fatalf("late win = %d %s", rw.Code, rw.Body.String())
+	}
+
+	if err := sim.AssertBalance("p1", 115); err != nil {
+
+		t.Fatal(err)
+	}
+
+	rw = callback(t, h, `{"action":"win","token":"expired","transaction_id":"w2","reference":"unknown","amount":25}`)
+	if rw.Code != http.StatusUnauthorized {
+
+		t.Fatalf("win of an unknown bet with an expired token = %d, want 401", rw.Code)
+	}
+}
+
+// A win for a bet that was not recorded must not be paid to whatever account its payload
+// names, which could belong to another operator.
+func TestHandlerRejectsUnindexedWin(t *testing.T) {
+
+	h, sim, _ := newTestHandler(t)
+	h.Wallet.AccountIDs = wallet.AccountIDCodec{Format: wallet.AccountIDDelimited}
+
+	player, err := h.Wallet.AccountIDs.Encode(wallet.AccountID{ClientID: 7, PlayerID: "p1"})
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	rw := callback(t, h, `{"action":"win","token":"expired","transaction_id":"w1","reference":"b1","player_id":"`+player+`","amount":25}`)
+	if rw.Code != http.StatusUnauthorized {
+
+		t.Fatalf("win of an unrecorded bet with an invalid token = %d, want 401", rw.Code)
+	}
+
+	if err := sim.AssertBalance("p1", 100); err != nil {
+
+		t.Fatal(err)
+	}
+}
+
+func TestGenericAdapterRejectsInvalidAmounts(t *testing.T) {
+
+	g := NewGenericAdapter("studio", "X-Studio-Key", "studio-secret")
+
+	r := httptest.NewRequest(http.MethodPost, "/callback", nil)
+	_, err := g.Decode(r, []byte(`{"action":"bet","token":"t","transaction_id":"b1","amount":"NaN"}`))
+	if err == nil {
+
+		t.Fatal("NaN amount accepted")
+	}
+
+	g.AmountMultiplier = 25
+
+	_, err = g.Decode(r, []byte(`{"action":"bet","token":"t","transaction_id":"b1","amount":10}`))
+	if err == nil {
+
+		t.Fatal("unsupported amount multiplier accepted")
+	}
+
+	err = NewRegistry(nil, nil, nil).Register(g)
+	if err == nil {
+
+		t.Fatal("Register accepted an unsupported amount multiplier")
+	}
+}
@@ -0,0 +1,67 @@
+package adapter
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	wallet "github.com/touchvas/casino-wallet"
+)
+
+const defaultBetTTL = 7 * 24 * time.Hour
+
+// BetIndex remembers the account of each bet, so that a win or refund arriving after the
+// session of its bet ended can still be paid to the right player.
+type BetIndex interface {
+	Remember(ctx context.Context, key string, account wallet.AccountID) error
+	Lookup(ctx context.Context, key string) (wallet.AccountID, error)
+}
+
+// RedisBetIndex keeps bets in Redis for TTL, which should outlive the latest win or
+// refund a studio sends for a round.
+type RedisBetIndex struct {
+	Redis    redis.UniversalClient
+	KeySpace wallet.KeySpace
+	TTL      time.Duration
+}
+
+func NewRedisBetIndex(redisConn redis.UniversalClient, ks wallet.KeySpace) *RedisBetIndex {
+
+	return &RedisBetIndex{Redis: redisConn, KeySpace: ks, TTL: defaultBetTTL}
+}
+
+// betCodec encodes stored accounts independently of the codec handed to games.
+var betCodec = wallet.AccountIDCodec{Format: wallet.AccountIDDelimited}
+
+func (b *RedisBetIndex) key(key string) string {
+
+	return b.KeySpace.Key("adapter-bet:" + key)
+}
+
+func (b *RedisBetIndex) Remember(ctx context.Context, key string, account wallet.AccountID) error {
+
+	value, err := betCodec.Encode(account)
+	if err != nil {
+
+		return err
+	}
+
+	ttl := b.TTL
+	if ttl <= 0 {
+
+		ttl = defaultBetTTL
+	}
+
+	return b.Redis.Set(ctx, b.key(key), value, ttl).Err()
+}
+
+func (b *RedisBetIndex) Lookup(ctx context.Context, key string) (wallet.AccountID, error) {
+
+	value, err := b.Redis.Get(ctx, b.key(key)).Result()
+	if err != nil {
+
+		return wallet.AccountID{}, err
+	}
+
+	return betCodec.Decode(value)
+}
@@ -0,0 +1,305 @@
+package adapter
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	wallet "github.com/touchvas/casino-wallet"
+)
+
+// GenericFields names the JSON fields of a callback. Nested fields are written as dotted
+// paths such as "data.amount"; an empty name leaves the field unset.
+type GenericFields struct {
+	Action        string `json:"action"`
+	Token         string `json:"token"`
+	PlayerID      string `json:"player_id"`
+	TransactionID string `json:"transaction_id"`
+	Reference     string `json:"reference"`
+	RoundID       string `json:"round_id"`
+	GameID        string `json:"game_id"`
+	GameName      string `json:"game_name"`
+	SessionID     string `json:"session_id"`
+	Amount        string `json:"amount"`
+	Currency      string `json:"currency"`
+}
+
+// GenericResponse is the answer to an outcome: the HTTP status and the value of the code field.
+type GenericResponse struct {
+	HTTPStatus int         `json:"http_status"`
+	Code       interface{} `json:"code"`
+}
+
+// GenericAdapter serves studios with a JSON callback API through configuration alone, and
+// can be loaded from JSON. Callbacks carry Secret in AuthHeader or, when Signature is set,
+// the hex HMAC-SHA256 of the body keyed with Secret. The action is read from Fields.Action
+// or, when that is empty, from the last path segment, and mapped through Actions. Amounts
+// and balances are exchanged in units of 1/AmountMultiplier, which must be one of the
+// wallet.DecimalMultiplier constants or zero for whole units.
+type GenericAdapter struct {
+	Studio           string                     `json:"name"`
+	AuthHeader       string                     `json:"auth_header"`
+	Secret           string                     `json:"secret"`
+	Signature        bool                       `json:"signature"`
+	Fields           GenericFields              `json:"fields"`
+	Actions          map[string]Action          `json:"actions"`
+	AmountMultiplier wallet.DecimalMultiplier   `json:"amount_multiplier"`
+	CodeField        string                     `json:"code_field"`
+	MessageField     string                     `json:"message_field"`
+	BalanceField     string                     `json:"balance_field"`
+	CurrencyField    string                     `json:"currency_field"`
+	Responses        map[string]GenericResponse `json:"responses"`
+}
+
+// NewGenericAdapter returns an adapter for name using snake_case fields named after
+// Request, the action names of this package, and HTTP statuses matching the outcomes.
+func NewGenericAdapter(name, authHeader, secret string) *GenericAdapter {
+
+	return &GenericAdapter{
+		Studio:     name,
+		AuthHeader: authHeader,
+		Secret:     secret,
+		Fields: GenericFields{
+			Action:        "action",
+			Token:         "token",
+			PlayerID:      "player_id",
+			TransactionID: "transaction_id",
+			Reference:     "reference",
+			RoundID:       "round_id",
+			GameID:        "game_id",
+			GameName:      "game_name",
+			SessionID:     "session_id",
+			Amount:        "amount",
+			Currency:      "currency",
+		},
+		Actions: map[string]Action{
+			string(ActionBalance): ActionBalance,
+			string(ActionBet):     ActionBet,
+			string(ActionWin):     ActionWin,
+			string(ActionRefund):  ActionRefund,
+		},
+		AmountMultiplier: wallet.DecimalMultiplierNone,
+		CodeField:        "code",
+		MessageField:     "message",
+		BalanceField:     "balance",
+		CurrencyField:    "currency",
+		Responses: map[string]GenericResponse{
+			wallet.OutcomeSuccess:           {HTTPStatus: http.StatusOK, Code: wallet.OutcomeSuccess},
+			wallet.OutcomeInsufficientFunds: {HTTPStatus: http.StatusPaymentRequired, Code: wallet.OutcomeInsufficientFunds},
+			wallet.OutcomeDuplicate:         {HTTPStatus: http.StatusConflict, Code: wallet.OutcomeDuplicate},
+			wallet.OutcomeError:             {HTTPStatus: http.StatusInternalServerError, Code: wallet.OutcomeError},
+			OutcomeUnauthorized:             {HTTPStatus: http.StatusUnauthorized, Code: OutcomeUnauthorized},
+			OutcomeInvalidToken:             {HTTPStatus: http.StatusUnauthorized, Code: OutcomeInvalidToken},
+			OutcomeBadRequest:               {HTTPStatus: http.StatusBadRequest, Code: OutcomeBadRequest},
+		},
+	}
+}
+
+func (g *GenericAdapter) Name() string {
+
+	return g.Studio
+}
+
+// Validate rejects an AmountMultiplier that would silently be taken as 1.
+func (g *GenericAdapter) Validate() error {
+
+	if g.AmountMultiplier != 0 && g.AmountMultiplier.In64() != int64(g.AmountMultiplier) {
+
+		return fmt.Errorf("adapter %s: unsupported amount multiplier %d", g.Studio, g.AmountMultiplier)
+	}
+
+	return nil
+}
+
+func (g *GenericAdapter) Authenticate(r *http.Request, body []byte) error {
+
+	if len(g.AuthHeader) == 0 || len(g.Secret) == 0 {
+
+		return fmt.Errorf("%w: adapter %s has no credentials configured", ErrUnauthorized, g.Studio)
+	}
+
+	got := r.Header.Get(g.AuthHeader)
+
+	want := g.Secret
+	if g.Signature {
+
+		mac := hmac.New(sha256.New, []byte(g.Secret))
+		mac.Write(body)
+		want = hex.EncodeToString(mac.Sum(nil))
+		got = strings.ToLower(got)
+	}
+
+	if len(got) == 0 || subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+
+		return ErrUnauthorized
+	}
+
+	return nil
+}
+
+func (g *GenericAdapter) Decode(r *http.Request, body []byte) (Request, error) {
+
+	err := g.Validate()
+	if err != nil {
+
+		return Request{}, err
+	}
+
+	var payload map[string]interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	err = decoder.Decode(&payload)
+	if err != nil {
+
+		return Request{}, fmt.Errorf("malformed callback: %v", err)
+	}
+
+	name := lookupString(payload, g.Fields.Action)
+	if len(g.Fields.Action) == 0 {
+
+		name = path.Base(r.URL.Path)
+	}
+
+	action, ok := g.Actions[name]
+	if !ok {
+
+		return Request{}, fmt.Errorf("%w %q", ErrUnknownAction, name)
+	}
+
+	req := Request{
+		Action:        action,
+		Token:         lookupString(payload, g.Fields.Token),
+		PlayerID:      lookupString(payload, g.Fields.PlayerID),
+		TransactionID: lookupString(payload, g.Fields.TransactionID),
+		Reference:     lookupString(payload, g.Fields.Reference),
+		RoundID:       lookupString(payload, g.Fields.RoundID),
+		GameID:        lookupString(payload, g.Fields.GameID),
+		GameName:      lookupString(payload, g.Fields.GameName),
+		SessionID:     lookupString(payload, g.Fields.SessionID),
+		Currency:      lookupString(payload, g.Fields.Currency),
+	}
+
+	if len(req.Token) == 0 {
+
+		return req, fmt.Errorf("callback has no token")
+	}
+
+	if action == ActionBalance {
+
+		return req, nil
+	}
+
+	if len(req.TransactionID) == 0 {
+
+		return req, fmt.Errorf("callback has no transaction id")
+	}
+
+	if action != ActionBet && len(req.Reference) == 0 {
+
+		return req, fmt.Errorf("%s callback has no reference", action)
+	}
+
+	amount := lookupString(payload, g.Fields.Amount)
+
+	req.Amount, err = strconv.ParseFloat(amount, 64)
+	if err != nil || req.Amount < 0 || math.IsInf(req.Amount, 0) || math.IsNaN(req.Amount) {
+
+		return req, fmt.Errorf("invalid amount %q", amount)
+	}
+
+	req.Amount = req.Amount / float64(g.AmountMultiplier.In64())
+	return req, nil
+}
+
+func (g *GenericAdapter) Encode(rw http.ResponseWriter, req Request, res Result) {
+
+	response, ok := g.Responses[res.Outcome]
+	if !ok {
+
+		response = g.Responses[wallet.OutcomeError]
+	}
+
+	if response.HTTPStatus == 0 {
+
+		response.HTTPStatus = http.StatusOK
+	}
+
+	body := map[string]interface{}{}
+
+	if len(g.CodeField) > 0 {
+
+		body[g.CodeField] = response.Code
+	}
+
+	if len(g.MessageField) > 0 && len(res.Description) > 0 {
+
+		body[g.MessageField] = res.Description
+	}
+
+	if res.HasBalance && len(g.BalanceField) > 0 {
+
+		balance := res.Balance * float64(g.AmountMultiplier.In64())
+		if g.AmountMultiplier.In64() > 1 {
+
+			balance = math.Round(balance)
+		}
+
+		body[g.BalanceField] = balance
+	}
+
+	if len(res.Currency) > 0 && len(g.CurrencyField) > 0 {
+
+		body[g.CurrencyField] = res.Currency
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(response.HTTPStatus)
+	_ = json.NewEncoder(rw).Encode(body)
+}
+
+// lookupString returns the field at the dotted path name as a string, or "" when missing.
+func lookupString(payload map[string]interface{}, name string) string {
+
+	if len(name) == 0 {
+
+		return ""
+	}
+
+	var value interface{} = payload
+
+	for _, part := range strings.Split(name, ".") {
+
+		object, ok := value.(map[string]interface{})
+		if !ok {
+
+			return ""
+		}
+
+		value = object[part]
+	}
+
+	switch v := value.(type) {
+
+	case string:
+		return v
+
+	case json.Number:
+		return v.String()
+
+	case bool:
+		return strconv.FormatBool(v)
+	}
+
+	return ""
+}
@@ -0,0 +1,475 @@
+package wallet
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrAuditChainBroken = errors.New("audit chain broken")
+
+// AuditResultSent is the Result of the record written before an instruction is sent.
+const AuditResultSent = "sent"
+
+// AuditRecord is the record of one financial instruction sent to an operator, or of a
+// security event such as a launch token replay. Each instruction is recorded twice: with
+// Result AuditResultSent before it is sent, and again with the same identifiers and its
+// outcome once the operator answered. BalanceAfter is only known when the operator
+// accepted the instruction. BalanceBefore is no longer written; it is kept so that
+// records of older releases still verify.
+type AuditRecord struct {
+	Sequence           int64     `json:"seq"`
+	Operation          string    `json:"operation"`
+	Actor              string    `json:"actor"`
+	ClientID           int64     `json:"client_id"`
+	PlayerID           string    `json:"player_id"`
+	GameID             string    `json:"game_id,omitempty"`
+	SessionID          string    `json:"session_id,omitempty"`
+	RoundID            string    `json:"round_id,omitempty"`
+	TransactionID      string    `json:"transaction_id,omitempty"`
+	DebitTransactionID string    `json:"debit_transaction_id,omitempty"`
+	Amount             float64   `json:"amount"`
+	BalanceBefore      *float64  `json:"balance_before"`
+	BalanceAfter       *float64  `json:"balance_after"`
+	Status             int64     `json:"status"`
+	Result             string    `json:"result"`
+	Error              string    `json:"error,omitempty"`
+	StartedAt          time.Time `json:"started_at"`
+	CompletedAt        time.Time `json:"completed_at"`
+	PrevHash           string    `json:"prev_hash"`
+	Hash               string    `json:"hash"`
+}
+
+// AuditSink keeps the audit trail of a Wallet. Sequence and the hashes are owned by the
+// sink; Wallet leaves them empty.
+type AuditSink interface {
+	Record(ctx context.Context, record AuditRecord) error
+}
+
+// hash returns the hash of record, which covers every field but Hash itself and so
+// chains the record to its predecessor through PrevHash. With a key the hash is an
+// HMAC, so the chain cannot be rebuilt by someone who can only edit the file.
+func (record AuditRecord) hash(key []byte) (string, error) {
+
+	record.Hash = ""
+
+	data, err := json.Marshal(record)
+	if err != nil {
+
+		return "", err
+	}
+
+	var h hash.Hash
+	if len(key) > 0 {
+
+		h = hmac.New(sha256.New, key)
+
+	} else {
+
+		h = sha256.New()
+	}
+
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// AuditCheckpoint is the sequence and hash of the latest record of an audit file.
+type AuditCheckpoint struct {
+	Sequence int64  `json:"seq"`
+	Hash     string `json:"hash"`
+}
+
+// AuditAnchor keeps the latest AuditCheckpoint away from the audit file, so that records
+// cut from the end of the file, which leaves a valid chain behind, are detected. Load
+// returns the zero checkpoint when nothing has been stored yet.
+type AuditAnchor interface {
+	Load(ctx context.Context) (AuditCheckpoint, error)
+	Store(ctx context.Context, checkpoint AuditCheckpoint) error
+}
+
+// RedisAuditAnchor stores the checkpoint of the audit file called Name in Redis, without
+// expiry.
+type RedisAuditAnchor struct {
+	Redis    redis.UniversalClient
+	KeySpace KeySpace
+	Name     string
+}
+
+func (a *RedisAuditAnchor) key() string {
+
+	return a.KeySpace.Key(fmt.Sprintf("audit-anchor:%s", a.Name))
+}
+
+func (a *RedisAuditAnchor) Load(ctx context.Context) (AuditCheckpoint, error) {
+
+	var checkpoint AuditCheckpoint
+
+	data, err := a.Redis.Get(ctx, a.key()).Bytes()
+	if errors.Is(err, redis.Nil) {
+
+		return checkpoint, nil
+	}
+
+	if err != nil {
+
+		return checkpoint, fmt.Errorf("error loading audit anchor %s: %v", a.Name, err)
+	}
+
+	err = json.Unmarshal(data, &checkpoint)
+	if err != nil {
+
+		return checkpoint, fmt.Errorf("malformed audit anchor %s: %v", a.Name, err)
+	}
+
+	return checkpoint, nil
+}
+
+func (a *RedisAuditAnchor) Store(ctx context.Context, checkpoint AuditCheckpoint) error {
+
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+
+		return err
+	}
+
+	return a.Redis.Set(ctx, a.key(), data, 0).Err()
+}
+
+// AuditFileOptions secure an audit file beyond its plain hash chain. Key turns the chain
+// into an HMAC chain and Anchor records the latest checkpoint outside the file. The
+// same options must be used to write and to verify a file.
+type AuditFileOptions struct {
+	Key    []byte
+	Anchor AuditAnchor
+}
+
+// FileAuditSink appends hash-chained records to a JSONL file, one record per line, and
+// syncs the file after each record. Editing, removing or reordering lines breaks the
+// chain, which VerifyAuditFile detects.
+type FileAuditSink struct {
+	mu       sync.Mutex
+	file     *os.File
+	options  AuditFileOptions
+	sequence int64
+	lastHash string
+	offset   int64
+	broken   error
+}
+
+// OpenFileAuditSink opens path for appending, creating it when missing, and continues the
+// chain of the records it already holds. The existing chain is verified first so that
+// new records are never appended to a tampered file.
+func OpenFileAuditSink(path string) (*FileAuditSink, error) {
+
+	return OpenFileAuditSinkWithOptions(context.Background(), path, AuditFileOptions{})
+}
+
+// OpenFileAuditSinkWithOptions is OpenFileAuditSink for a keyed or anchored file. The file
+// is also checked against the anchor, so a file that lost records is not written to.
+func OpenFileAuditSinkWithOptions(ctx context.Context, path string, options AuditFileOptions) (*FileAuditSink, error) {
+
+	sink := &FileAuditSink{options: options}
+
+	last, err := verifyAuditFile(ctx, path, options)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+
+		return nil, err
+	}
+
+	if last != nil {
+
+		sink.sequence = last.Sequence
+		sink.lastHash = last.Hash
+	}
+
+	sink.file, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+
+		return nil, err
+	}
+
+	info, err := sink.file.Stat()
+	if err != nil {
+
+		sink.file.Close()
+		return nil, err
+	}
+
+	sink.offset = info.Size()
+	return sink, nil
+}
+
+// Record appends record to the file. A write that fails is cut off again, so that the
+// file keeps ending with a complete record; when even that fails the sink refuses any
+// further records. A record that is written but cannot be anchored is reported, but
+// stays in the chain.
+func (s *FileAuditSink) Record(ctx context.Context, record AuditRecord) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.broken != nil {
+
+		return s.broken
+	}
+
+	record.Sequence = s.sequence + 1
+	record.PrevHash = s.lastHash
+	record.StartedAt = record.StartedAt.UTC()
+	record.CompletedAt = record.CompletedAt.UTC()
+
+	hash, err := record.hash(s.options.Key)
+	if err != nil {
+
+		return err
+	}
+
+	record.Hash = hash
+
+	line, err := json.Marshal(record)
+	if err != nil {
+
+		return err
+	}
+
+	line = append(line, '\n')
+
+	_, err = s.file.Write(line)
+	if err == nil {
+
+		err = s.file.Sync()
+	}
+
+	if err != nil {
+
+		s.rewind()
+		return fmt.Errorf("error writing audit record %d: %v", record.Sequence, err)
+	}
+
+	s.sequence = record.Sequence
+	s.lastHash = record.Hash
+	s.offset += int64(len(line))
+
+	if s.options.Anchor != nil {
+
+		err = s.options.Anchor.Store(ctx, AuditCheckpoint{Sequence: record.Sequence, Hash: record.Hash})
+		if err != nil {
+
+			return fmt.Errorf("audit record %d was written but not anchored: %v", record.Sequence, err)
+		}
+	}
+
+	return nil
+}
+
+// rewind truncates the file back to the end of the last complete record after a failed
+// write.
+func (s *FileAuditSink) rewind() {
+
+	err := s.file.Truncate(s.offset)
+	if err == nil {
+
+		err = s.file.Sync()
+	}
+
+	if err != nil {
+
+		s.broken = fmt.Errorf("audit file could not be truncated to its last record at offset %d: %v", s.offset, err)
+	}
+}
+
+func (s *FileAuditSink) Close() error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
+
+// VerifyAuditFile walks the chain of the audit file at path and returns the number of
+// records it holds. A record whose hash, predecessor or sequence does not match is
+// reported with ErrAuditChainBroken and its line number.
+func VerifyAuditFile(path string) (int64, error) {
+
+	return VerifyAuditFileWithOptions(context.Background(), path, AuditFileOptions{})
+}
+
+// VerifyAuditFileWithOptions is VerifyAuditFile for a keyed or anchored file. A file that
+// ends before the anchored record, or whose record at the anchored sequence has another
+// hash, is reported with ErrAuditChainBroken.
+func VerifyAuditFileWithOptions(ctx context.Context, path string, options AuditFileOptions) (int64, error) {
+
+	last, err := verifyAuditFile(ctx, path, options)
+	if last == nil {
+
+		return 0, err
+	}
+
+	return last.Sequence, err
+}
+
+func verifyAuditFile(ctx context.Context, path string, options AuditFileOptions) (*AuditRecord, error) {
+
+	var anchor AuditCheckpoint
+	var err error
+
+	if options.Anchor != nil {
+
+		anchor, err = options.Anchor.Load(ctx)
+		if err != nil {
+
+			return nil, err
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+
+		if errors.Is(err, os.ErrNotExist) && anchor.Sequence > 0 {
+
+			return nil, fmt.Errorf("%w: file is missing but record %d was anchored", ErrAuditChainBroken, anchor.Sequence)
+		}
+
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var last *AuditRecord
+	var line int
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+
+		line++
+
+		record := new(AuditRecord)
+		err = json.Unmarshal(scanner.Bytes(), record)
+		if err != nil {
+
+			return last, fmt.Errorf("%w: line %d is not a record: %v", ErrAuditChainBroken, line, err)
+		}
+
+		var prevHash string
+		var prevSequence int64
+		if last != nil {
+
+			prevHash, prevSequence = last.Hash, last.Sequence
+		}
+
+		if record.Sequence != prevSequence+1 {
+
+			return last, fmt.Errorf("%w: line %d has sequence %d, expected %d", ErrAuditChainBroken, line, record.Sequence, prevSequence+1)
+		}
+
+		if record.PrevHash != prevHash {
+
+			return last, fmt.Errorf("%w: line %d does not follow its predecessor", ErrAuditChainBroken, line)
+		}
+
+		// Lines are written in canonical form, so any edit that survives decoding, such as
+		// a renamed key, still shows up as a difference from the re-encoded record.
+		canonical, err := json.Marshal(record)
+		if err != nil || !bytes.Equal(canonical, scanner.Bytes()) {
+
+			return last, fmt.Errorf("%w: line %d has been modified", ErrAuditChainBroken, line)
+		}
+
+		hash, err := record.hash(options.Key)
+		if err != nil || hash != record.Hash {
+
+			return last, fmt.Errorf("%w: line %d has been modified", ErrAuditChainBroken, line)
+		}
+
+		if record.Sequence == anchor.Sequence && record.Hash != anchor.Hash {
+
+			return last, fmt.Errorf("%w: line %d is not the anchored record %d", ErrAuditChainBroken, line, anchor.Sequence)
+		}
+
+		last = record
+	}
+
+	err = scanner.Err()
+	if err != nil {
+
+		return last, err
+	}
+
+	var sequence int64
+	if last != nil {
+
+		sequence = last.Sequence
+	}
+
+	if sequence < anchor.Sequence {
+
+		return last, fmt.Errorf("%w: file ends at record %d but record %d was anchored, records have been removed", ErrAuditChainBroken, sequence, anchor.Sequence)
+	}
+
+	return last, nil
+}
+
+// auditSent records that the instruction of record is about to be sent. A failing sink is
+// returned, and the instruction must then not be sent, so that the trail never misses an
+// instruction the operator may have applied.
+func (w *Wallet) auditSent(ctx context.Context, record AuditRecord) error {
+
+	if w.Audit == nil {
+
+		return nil
+	}
+
+	record.Actor = fmt.Sprintf("provider:%d", w.Provider.ID)
+	record.Result = AuditResultSent
+
+	err := w.Audit.Record(ctx, record)
+	if err != nil {
+
+		w.log().Error(ctx, "error writing audit record", err, nil)
+		return fmt.Errorf("instruction not sent, error writing audit record: %w", err)
+	}
+
+	return nil
+}
+
+// audit completes record with the outcome of the instruction and hands it to the sink.
+// The instruction has already reached the operator, so a failing sink is logged rather
+// than returned.
+func (w *Wallet) audit(ctx context.Context, record AuditRecord, status int64, balance *float64, err error) {
+
+	if w.Audit == nil {
+
+		return
+	}
+
+	record.Actor = fmt.Sprintf("provider:%d", w.Provider.ID)
+	record.Status = status
+	record.Result = outcomeCode(status, err)
+	record.BalanceAfter = balance
+	record.CompletedAt = time.Now()
+
+	if err != nil {
+
+		record.Error = err.Error()
+	}
+
+	auditErr := w.Audit.Record(ctx, record)
+	if auditErr != nil {
+
+		w.log().Error(ctx, "error writing audit record", auditErr, nil)
+	}
+}
@@ -0,0 +1,302 @@
+package wallet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func writeAuditRecords(t *testing.T, sink *FileAuditSink, n int) {
+
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+
+		err := sink.Record(context.Background(), AuditRecord{
+			Operation:     OperationDebit,
+			ClientID:      1,
+			PlayerID:      "p1",
+			TransactionID: fmt.Sprintf("t%d", i),
+			Amount:        10,
+			StartedAt:     time.Now(),
+			CompletedAt:   time.Now(),
+		})
+		if err != nil {
+
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAuditFileKeyedChain(t *testing.T) {
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	options := AuditFileOptions{Key: []byte("audit-key")}
+
+	sink, err := OpenFileAuditSinkWithOptions(ctx, path, options)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	writeAuditRecords(t, sink, 3)
+	sink.Close()
+
+	records, err := VerifyAuditFileWithOptions(ctx, path, options)
+	if err != nil || records != 3 {
+
+		t.Fatalf("VerifyAuditFileWithOptions = %d, %v", records, err)
+	}
+
+	_, err = VerifyAuditFile(path)
+	if !errors.Is(err, ErrAuditChainBroken) {
+
+		t.Fatalf("verify without the key = %v, want ErrAuditChainBroken", err)
+	}
+
+	_, err = VerifyAuditFileWithOptions(ctx, path, AuditFileOptions{Key: []byte("other-key")})
+	if !errors.Is(err, ErrAuditChainBroken) {
+
+		t.Fatalf("verify with another key = %v, want ErrAuditChainBroken", err)
+	}
+}
+
+// An unkeyed chain can be rebuilt by anyone who edits the file; a keyed one cannot.
+func TestAuditFileRehashedEdit(t *testing.T) {
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	options := AuditFileOptions{Key: []byte("audit-key")}
+
+	sink, err := OpenFileAuditSinkWithOptions(ctx, path, options)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	writeAuditRecords(t, sink, 1)
+	sink.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	var record AuditRecord
+	err = json.Unmarshal(data, &record)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	record.Amount = 1000
+	record.Hash, err = record.hash(nil)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	forged, err := json.Marshal(record)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(path, append(forged, '\n'), 0o600)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	_, err = VerifyAuditFile(path)
+	if err != nil {
+
+		t.Fatalf("rehashed record does not verify without a key: %v", err)
+	}
+
+	_, err = VerifyAuditFileWithOptions(ctx, path, options)
+	if !errors.Is(err, ErrAuditChainBroken) {
+
+		t.Fatalf("rehashed record = %v, want ErrAuditChainBroken", err)
+	}
+}
+
+func TestAuditFileAnchorDetectsTruncation(t *testing.T) {
+
+	ctx := context.Background()
+	_, conn := newTestRedis(t)
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	options := AuditFileOptions{Key: []byte("audit-key"), Anchor: &RedisAuditAnchor{Redis: conn, KeySpace: KeySpace{Prefix: "test"}, Name: "journal"}}
+
+	sink, err := OpenFileAuditSinkWithOptions(ctx, path, options)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	writeAuditRecords(t, sink, 3)
+	sink.Close()
+
+	records, err := VerifyAuditFileWithOptions(ctx, path, options)
+	if err != nil || records != 3 {
+
+		t.Fatalf("VerifyAuditFileWithOptions = %d, %v", records, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	os.WriteFile(path, []byte(strings.Join(lines[:2], "")), 0o600)
+
+	_, err = VerifyAuditFileWithOptions(ctx, path, options)
+	if !errors.Is(err, ErrAuditChainBroken) {
+
+		t.Fatalf("truncated file = %v, want ErrAuditChainBroken", err)
+	}
+
+	_, err = OpenFileAuditSinkWithOptions(ctx, path, options)
+	if !errors.Is(err, ErrAuditChainBroken) {
+
+		t.Fatalf("opening a truncated file = %v, want ErrAuditChainBroken", err)
+	}
+
+	os.Remove(path)
+
+	_, err = OpenFileAuditSinkWithOptions(ctx, path, options)
+	if !errors.Is(err, ErrAuditChainBroken) {
+
+		t.Fatalf("opening a removed file = %v, want ErrAuditChainBroken", err)
+	}
+}
+
+func TestFileAuditSinkRewind(t *testing.T) {
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	sink, err := OpenFileAuditSink(path)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	writeAuditRecords(t, sink, 1)
+
+	// A write that failed half way leaves part of a line behind.
+	_, err = sink.file.Write([]byte(`{"seq":2,"oper`))
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	sink.rewind()
+
+	writeAuditRecords(t, sink, 1)
+	sink.Close()
+
+	records, err := VerifyAuditFile(path)
+	if err != nil || records != 2 {
+
+		t.Fatalf("VerifyAuditFile after rewind = %d, %v", records, err)
+	}
+
+	sink, err = OpenFileAuditSink(path)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	sink.file.Close()
+
+	err = sink.Record(ctx, AuditRecord{Operation: OperationDebit})
+	if err == nil {
+
+		t.Fatal("Record on a closed file succeeded")
+	}
+
+	err = sink.Record(ctx, AuditRecord{Operation: OperationDebit})
+	if err == nil || !strings.Contains(err.Error(), "truncated") {
+
+		t.Fatalf("Record after a failed rewind = %v, want the sink to refuse", err)
+	}
+}
+
+// failingSink is an AuditSink that cannot write.
+type failingSink struct{}
+
+func (failingSink) Record(ctx context.Context, record AuditRecord) error {
+
+	return errors.New("disk full")
+}
+
+func TestWalletAuditsBeforeSending(t *testing.T) {
+
+	var requests atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+
+		requests.Add(1)
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write([]byte(`{"status":1,"balance":90}`))
+	}))
+	defer server.Close()
+
+	w, err := NewWallet(noop.NewTracerProvider().Tracer("test"), ProviderIdentity{ID: 1, Name: "test"})
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	audit := new(auditRecords)
+	w.Audit = audit
+
+	client := Client{ID: 7, BaseURL: server.URL, AuthenticationHeader: "X-Api-Key", AuthenticationString: "secret", Status: ClientStatusActive}
+	debit := Debit{PlayerID: "p1", TransactionID: "t1", Amount: 10}
+
+	_, err = w.DebitWalletProfile(context.Background(), client, debit)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	if len(*audit) != 2 || (*audit)[0].Result != AuditResultSent || (*audit)[1].Result != OutcomeSuccess {
+
+		t.Fatalf("audit records = %+v, want a sent record followed by the outcome", *audit)
+	}
+
+	if (*audit)[1].TransactionID != "t1" || (*audit)[1].BalanceAfter == nil || *(*audit)[1].BalanceAfter != 90 {
+
+		t.Fatalf("outcome record = %+v", (*audit)[1])
+	}
+
+	// Without the sent record the instruction must not reach the operator.
+	w.Audit = failingSink{}
+
+	_, err = w.DebitWalletProfile(context.Background(), client, debit)
+	if err == nil {
+
+		t.Fatal("debit sent although its audit record could not be written")
+	}
+
+	if requests.Load() != 1 {
+
+		t.Fatalf("operator received %d requests, want 1", requests.Load())
+	}
+}
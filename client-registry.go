@@ -0,0 +1,555 @@
+package wallet
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultClientCacheTTL     = 30 * time.Second
+	clientInvalidationChannel = "clients:invalidate"
+	clientInvalidateAll       = "*"
+)
+
+// ClientRegistry serves operator configs from an in-process cache backed by the clients
+// store. When Redis is set, every change is published so that the registries of other
+// processes drop their copy; run Listen in a goroutine to receive those notifications.
+// When Cipher is set, authentication strings are encrypted before they are written and
+// decrypted when read, so callers only ever see plaintext secrets.
+type ClientRegistry struct {
+	Store    *ClientStore
+	Redis    redis.UniversalClient
+	KeySpace KeySpace
+	TTL      time.Duration
+	Cipher   *SecretCipher
+	Logger   Logger
+
+	mu    sync.RWMutex
+	cache map[int64]cachedClient
+
+	// generation counts invalidations. A client read from the store is only cached if no
+	// invalidation happened since the read started, so an older copy cannot replace the
+	// change that invalidated it.
+	generation uint64
+}
+
+type cachedClient struct {
+	client  Client
+	expires time.Time
+}
+
+func NewClientRegistry(store *ClientStore, redisConn redis.UniversalClient, ks KeySpace) (*ClientRegistry, error) {
+
+	err := ks.Validate()
+	if err != nil {
+
+		return nil, err
+	}
+
+	return &ClientRegistry{
+		Store:    store,
+		Redis:    redisConn,
+		KeySpace: ks,
+		TTL:      defaultClientCacheTTL,
+		cache:    make(map[int64]cachedClient),
+	}, nil
+}
+
+// log uses Logger, falling back to the logger of the store.
+func (r *ClientRegistry) log() contextLogger {
+
+	if r.Logger == nil && r.Store != nil {
+
+		return r.Store.log()
+	}
+
+	return logTo(r.Logger)
+}
+
+func (r *ClientRegistry) ttl() time.Duration {
+
+	if r.TTL > 0 {
+
+		return r.TTL
+	}
+
+	return defaultClientCacheTTL
+}
+
+// Get returns the client with id, or ErrClientNotFound.
+func (r *ClientRegistry) Get(ctx context.Context, id int64) (Client, error) {
+
+	r.mu.RLock()
+	entry, ok := r.cache[id]
+	generation := r.generation
+	r.mu.RUnlock()
+
+	if ok && time.Now().Before(entry.expires) {
+
+		return entry.client, nil
+	}
+
+	client, err := r.Store.Get(ctx, id)
+	if err != nil {
+
+		return Client{}, err
+	}
+
+	client, err = r.decrypt(ctx, client)
+	if err != nil {
+
+		return Client{}, err
+	}
+
+	client, err = r.loadCredentials(ctx, client)
+	if err != nil {
+
+		return Client{}, err
+	}
+
+	r.store(client, generation)
+	return client, nil
+}
+
+func (r *ClientRegistry) List(ctx context.Context, filter ClientFilter) ([]Client, error) {
+
+	generation := r.currentGeneration()
+
+	clients, err := r.Store.List(ctx, filter)
+	if err != nil {
+
+		return nil, err
+	}
+
+	for i, client := range clients {
+
+		client, err = r.decrypt(ctx, client)
+		if err != nil {
+
+			return nil, err
+		}
+
+		client, err = r.loadCredentials(ctx, client)
+		if err != nil {
+
+			return nil, err
+		}
+
+		clients[i] = client
+		r.store(client, generation)
+	}
+
+	return clients, nil
+}
+
+func (r *ClientRegistry) Create(ctx context.Context, client Client) error {
+
+	client, err := r.encrypt(ctx, client)
+	if err != nil {
+
+		return err
+	}
+
+	err = r.Store.Create(ctx, client)
+	if err != nil {
+
+		return err
+	}
+
+	r.Invalidate(ctx, client.ID)
+	return nil
+}
+
+func (r *ClientRegistry) Update(ctx context.Context, client Client) error {
+
+	client, err := r.encrypt(ctx, client)
+	if err != nil {
+
+		return err
+	}
+
+	err = r.Store.Update(ctx, client)
+	if err != nil {
+
+		return err
+	}
+
+	r.Invalidate(ctx, client.ID)
+	return nil
+}
+
+func (r *ClientRegistry) SetStatus(ctx context.Context, id int64, status ClientStatus) error {
+
+	err := r.Store.SetStatus(ctx, id, status)
+	if err != nil {
+
+		return err
+	}
+
+	r.Invalidate(ctx, id)
+	return nil
+}
+
+func (r *ClientRegistry) Delete(ctx context.Context, id int64) error {
+
+	err := r.Store.Delete(ctx, id)
+	if err != nil {
+
+		return err
+	}
+
+	r.Invalidate(ctx, id)
+	return nil
+}
+
+// Invalidate drops the cached client locally and tells other processes to do the same.
+func (r *ClientRegistry) Invalidate(ctx context.Context, id int64) {
+
+	r.drop(strconv.FormatInt(id, 10))
+
+	if r.Redis == nil {
+
+		return
+	}
+
+	err := r.Redis.Publish(ctx, r.KeySpace.Key(clientInvalidationChannel), id).Err()
+	if err != nil {
+
+		r.log().Error(ctx, "error publishing client invalidation", err, LogFields{
+			LogFieldClientID: id,
+		})
+	}
+}
+
+// Listen applies invalidations published by other processes until ctx is cancelled.
+// Messages published while the subscription is down are lost, so the whole cache is
+// dropped whenever Redis confirms the subscription: once at start and again after every
+// reconnect, which go-redis performs on its own. Cache entries also expire after TTL,
+// which bounds staleness should a confirmation be missed.
+func (r *ClientRegistry) Listen(ctx context.Context) error {
+
+	if r.Redis == nil {
+
+		return fmt.Errorf("client registry has no redis connection to listen on")
+	}
+
+	pubsub := r.Redis.Subscribe(ctx, r.KeySpace.Key(clientInvalidationChannel))
+	defer pubsub.Close()
+
+	ch := pubsub.ChannelWithSubscriptions(redis.WithChannelHealthCheckInterval(30 * time.Second))
+
+	r.drop(clientInvalidateAll)
+
+	for {
+
+		select {
+
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case msg, ok := <-ch:
+			if !ok {
+
+				return nil
+			}
+
+			switch m := msg.(type) {
+
+			case *redis.Subscription:
+				if m.Kind == "subscribe" {
+
+					r.drop(clientInvalidateAll)
+				}
+
+			case *redis.Message:
+				r.drop(m.Payload)
+			}
+		}
+	}
+}
+
+func (r *ClientRegistry) currentGeneration() uint64 {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.generation
+}
+
+// store caches client unless the cache was invalidated after generation was read.
+func (r *ClientRegistry) store(client Client, generation uint64) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.generation != generation {
+
+		return
+	}
+
+	if r.cache == nil {
+
+		r.cache = make(map[int64]cachedClient)
+	}
+
+	r.cache[client.ID] = cachedClient{client: client, expires: time.Now().Add(r.ttl())}
+}
+
+func (r *ClientRegistry) drop(payload string) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.generation++
+
+	if payload == clientInvalidateAll {
+
+		r.cache = make(map[int64]cachedClient)
+		return
+	}
+
+	id, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+
+		return
+	}
+
+	delete(r.cache, id)
+}
+
+func (r *ClientRegistry) encrypt(ctx context.Context, client Client) (Client, error) {
+
+	return encryptClientSecret(ctx, r.Cipher, client)
+}
+
+func (r *ClientRegistry) decrypt(ctx context.Context, client Client) (Client, error) {
+
+	return decryptClientSecret(ctx, r.Cipher, client)
+}
+
+// encryptClientSecret seals the secret of client with c, or stores it in plaintext when c is nil.
+func encryptClientSecret(ctx context.Context, c *SecretCipher, client Client) (Client, error) {
+
+	if c == nil {
+
+		client.AuthenticationKeyID = ""
+		return client, nil
+	}
+
+	ciphertext, keyID, err := c.Encrypt(ctx, client.ID, client.AuthenticationString)
+	if err != nil {
+
+		return Client{}, fmt.Errorf("error encrypting secret of client %d: %v", client.ID, err)
+	}
+
+	client.AuthenticationString = ciphertext
+	client.AuthenticationKeyID = keyID
+	return client, nil
+}
+
+func decryptClientSecret(ctx context.Context, c *SecretCipher, client Client) (Client, error) {
+
+	if len(client.AuthenticationKeyID) == 0 {
+
+		return client, nil
+	}
+
+	if c == nil {
+
+		return Client{}, fmt.Errorf("client %d has an encrypted secret but no cipher is configured", client.ID)
+	}
+
+	plaintext, err := c.Decrypt(ctx, client.ID, client.AuthenticationString, client.AuthenticationKeyID)
+	if err != nil {
+
+		return Client{}, fmt.Errorf("error decrypting secret of client %d: %v", client.ID, err)
+	}
+
+	client.AuthenticationString = plaintext
+	client.AuthenticationKeyID = ""
+	return client, nil
+}
+
+// ReencryptSecrets re-encrypts every client and credential secret that is stored in plaintext or under a key
+// other than the current one. Run it after rotating the key provider's current key, then
+// retire the old key once it returns zero.
+func (r *ClientRegistry) ReencryptSecrets(ctx context.Context) (int, error) {
+
+	if r.Cipher == nil {
+
+		return 0, fmt.Errorf("re-encryption requires a cipher")
+	}
+
+	clients, err := r.Store.List(ctx, ClientFilter{})
+	if err != nil {
+
+		return 0, err
+	}
+
+	count := 0
+
+	for _, stored := range clients {
+
+		credentials, err := r.Store.ListCredentials(ctx, stored.ID)
+		if err != nil {
+
+			return count, err
+		}
+
+		for _, credential := range credentials {
+
+			if r.Cipher.IsCurrent(credential.Secret, credential.KeyID) {
+
+				continue
+			}
+
+			plaintext, err := r.Cipher.DecryptCredential(ctx, stored.ID, credential.Secret, credential.KeyID)
+			if err != nil {
+
+				return count, err
+			}
+
+			credential.Secret, credential.KeyID, err = r.Cipher.EncryptCredential(ctx, stored.ID, plaintext)
+			if err != nil {
+
+				return count, err
+			}
+
+			err = r.Store.UpdateCredentialSecret(ctx, credential)
+			if err != nil {
+
+				return count, err
+			}
+
+			count++
+		}
+
+		if r.Cipher.IsCurrent(stored.AuthenticationString, stored.AuthenticationKeyID) {
+
+			continue
+		}
+
+		client, err := r.decrypt(ctx, stored)
+		if err != nil {
+
+			return count, err
+		}
+
+		err = r.Update(ctx, client)
+		if err != nil {
+
+			return count, err
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+func (r *ClientRegistry) loadCredentials(ctx context.Context, client Client) (Client, error) {
+
+	credentials, err := r.Store.ListCredentials(ctx, client.ID)
+	if err != nil {
+
+		return Client{}, err
+	}
+
+	for i, credential := range credentials {
+
+		if len(credential.KeyID) == 0 {
+
+			continue
+		}
+
+		if r.Cipher == nil {
+
+			return Client{}, fmt.Errorf("credential %d of client %d is encrypted but the registry has no cipher", credential.ID, client.ID)
+		}
+
+		credentials[i].Secret, err = r.Cipher.DecryptCredential(ctx, client.ID, credential.Secret, credential.KeyID)
+		if err != nil {
+
+			return Client{}, fmt.Errorf("error decrypting credential %d of client %d: %v", credential.ID, client.ID, err)
+		}
+
+		credentials[i].KeyID = ""
+	}
+
+	client.Credentials = credentials
+	return client, nil
+}
+
+// StageCredential adds a credential that is used as a fallback until it is promoted.
+func (r *ClientRegistry) StageCredential(ctx context.Context, credential Credential) (int64, error) {
+
+	if r.Cipher != nil {
+
+		ciphertext, keyID, err := r.Cipher.EncryptCredential(ctx, credential.ClientID, credential.Secret)
+		if err != nil {
+
+			return 0, fmt.Errorf("error encrypting credential of client %d: %v", credential.ClientID, err)
+		}
+
+		credential.Secret = ciphertext
+		credential.KeyID = keyID
+	}
+
+	id, err := r.Store.StageCredential(ctx, credential)
+	if err != nil {
+
+		return 0, err
+	}
+
+	r.Invalidate(ctx, credential.ClientID)
+	return id, nil
+}
+
+func (r *ClientRegistry) PromoteCredential(ctx context.Context, clientID, credentialID int64) error {
+
+	err := r.Store.PromoteCredential(ctx, clientID, credentialID)
+	if err != nil {
+
+		return err
+	}
+
+	r.Invalidate(ctx, clientID)
+	return nil
+}
+
+func (r *ClientRegistry) RetireCredential(ctx context.Context, clientID, credentialID int64) error {
+
+	err := r.Store.RetireCredential(ctx, clientID, credentialID)
+	if err != nil {
+
+		return err
+	}
+
+	r.Invalidate(ctx, clientID)
+	return nil
+}
+
+// RecordCredentialUse notes that the operator accepted a fallback credential, which usually
+// means it has switched keys and the credential should be promoted.
+func (r *ClientRegistry) RecordCredentialUse(ctx context.Context, clientID int64, credentialID int64) {
+
+	r.log().Warn(ctx, "primary credential rejected", LogFields{
+		"description":    "operator accepted a fallback credential",
+		LogFieldClientID: clientID,
+		"credential_id":  credentialID,
+	})
+
+	err := r.Store.TouchCredential(ctx, clientID, credentialID)
+	if err != nil {
+
+		r.log().Error(ctx, "error recording credential use", err, LogFields{
+			LogFieldClientID: clientID,
+			"credential_id":  credentialID,
+		})
+	}
+}
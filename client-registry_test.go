@@ -0,0 +1,108 @@
+package wallet
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func (r *ClientRegistry) cached(id int64) bool {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.cache[id]
+	return ok
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+
+		if time.Now().After(deadline) {
+
+			t.Fatalf("timed out waiting for %s", what)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClientRegistryListen(t *testing.T) {
+
+	server, conn := newTestRedis(t)
+
+	registry, err := NewClientRegistry(nil, conn, KeySpace{Prefix: "test"})
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go registry.Listen(ctx)
+
+	waitFor(t, "subscription", func() bool {
+
+		return len(server.PubSubChannels("")) == 1
+	})
+
+	registry.store(Client{ID: 1}, registry.currentGeneration())
+	registry.store(Client{ID: 2}, registry.currentGeneration())
+
+	conn.Publish(ctx, registry.KeySpace.Key(clientInvalidationChannel), 1)
+
+	waitFor(t, "invalidation of client 1", func() bool {
+
+		return !registry.cached(1)
+	})
+
+	if !registry.cached(2) {
+
+		t.Fatal("invalidation of client 1 dropped client 2")
+	}
+
+	// Messages published while disconnected are lost; the resubscription after the
+	// reconnect must drop the whole cache instead.
+	server.Close()
+
+	err = server.Restart()
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	waitFor(t, "cache flush after reconnect", func() bool {
+
+		return !registry.cached(2)
+	})
+}
+
+func TestClientRegistryStaleStore(t *testing.T) {
+
+	registry, err := NewClientRegistry(nil, nil, KeySpace{Prefix: "test"})
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	// A Get that read the store before an invalidation must not cache what it read.
+	generation := registry.currentGeneration()
+	registry.Invalidate(context.Background(), 1)
+	registry.store(Client{ID: 1}, generation)
+
+	if registry.cached(1) {
+
+		t.Fatal("a client read before its invalidation was cached")
+	}
+
+	err = registry.Listen(context.Background())
+	if err == nil {
+
+		t.Fatal("Listen without redis succeeded")
+	}
+}
@@ -0,0 +1,466 @@
+package wallet
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ClientStore reads and writes operator configs and credentials in the dialect of DB.
+// MySQL connections need parseTime=true in the DSN so that timestamps scan into time.Time.
+type ClientStore struct {
+	Tracer  trace.Tracer
+	DB      *sql.DB
+	Dialect Dialect
+	Logger  Logger
+}
+
+func NewClientStore(tr trace.Tracer, db *sql.DB, dialect Dialect) *ClientStore {
+
+	return &ClientStore{Tracer: tr, DB: db, Dialect: dialect}
+}
+
+func (s *ClientStore) log() contextLogger {
+
+	return logTo(s.Logger)
+}
+
+func (s *ClientStore) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+
+	return s.DB.ExecContext(ctx, s.Dialect.Rebind(query), args...)
+}
+
+func (s *ClientStore) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+
+	return s.DB.QueryContext(ctx, s.Dialect.Rebind(query), args...)
+}
+
+func (s *ClientStore) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+
+	return s.DB.QueryRowContext(ctx, s.Dialect.Rebind(query), args...)
+}
+
+// clientSchema records which of the clients columns added by migrations a database has.
+// Databases that were never migrated only have the columns of the original table; they
+// can still be read and written as long as nothing needs the missing columns.
+type clientSchema struct {
+	status bool
+	keyID  bool
+}
+
+// migratedClientSchemas holds the databases known to have every clients column, so that
+// they are only inspected once.
+var migratedClientSchemas sync.Map
+
+func errClientsNotMigrated(column string) error {
+
+	return fmt.Errorf("clients table has no %s column, run Migrate first", column)
+}
+
+func (s *ClientStore) clientSchema(ctx context.Context) (clientSchema, error) {
+
+	if _, ok := migratedClientSchemas.Load(s.DB); ok {
+
+		return clientSchema{status: true, keyID: true}, nil
+	}
+
+	var schema clientSchema
+	var err error
+
+	schema.status, err = s.columnExists(ctx, "clients", "status")
+	if err != nil {
+
+		return schema, err
+	}
+
+	schema.keyID, err = s.columnExists(ctx, "clients", "authentication_key_id")
+	if err != nil {
+
+		return schema, err
+	}
+
+	if schema.status && schema.keyID {
+
+		migratedClientSchemas.Store(s.DB, true)
+	}
+
+	return schema, nil
+}
+
+func (s *ClientStore) columnExists(ctx context.Context, table, column string) (bool, error) {
+
+	var count int
+	err := s.queryRow(ctx, s.Dialect.columnExistsQuery(), table, column).Scan(&count)
+	return count > 0, err
+}
+
+// selectColumns returns the clientColumns expressions of the schema, reading missing
+// columns as empty.
+func (schema clientSchema) selectColumns() string {
+
+	columns := "account, base_url, authentication_header, authentication_string"
+
+	if schema.keyID {
+
+		columns = columns + ", authentication_key_id"
+
+	} else {
+
+		columns = columns + ", ''"
+	}
+
+	if schema.status {
+
+		return columns + ", status"
+	}
+
+	return columns + ", ''"
+}
+
+// Create stores client, or updates its connection details when it exists. The status of
+// an existing client is kept, so re-creating a suspended client does not reactivate it.
+func (s *ClientStore) Create(ctx context.Context, client Client) error {
+
+	ctx, span := s.Tracer.Start(ctx, "CreateClient")
+	defer span.End()
+
+	schema, err := s.clientSchema(ctx)
+	if err != nil {
+
+		return err
+	}
+
+	status := client.Status
+	if len(status) == 0 {
+
+		status = ClientStatusActive
+	}
+
+	columns := []string{"account", "authentication_header", "authentication_string", "base_url"}
+	params := []interface{}{client.ID, client.AuthenticationHeader, client.AuthenticationString, client.BaseURL}
+
+	if schema.keyID {
+
+		columns = append(columns, "authentication_key_id")
+		params = append(params, client.AuthenticationKeyID)
+
+	} else if len(client.AuthenticationKeyID) > 0 {
+
+		return errClientsNotMigrated("authentication_key_id")
+	}
+
+	update := columns[1:]
+
+	if schema.status {
+
+		columns = append(columns, "status")
+		params = append(params, string(status))
+
+	} else if status != ClientStatusActive {
+
+		return errClientsNotMigrated("status")
+	}
+
+	query := s.Dialect.Upsert("clients", columns, []string{"account"}, update)
+
+	_, err = s.DB.ExecContext(ctx, query, params...)
+	if err != nil {
+
+		s.log().Error(ctx, "error creating  new client", err, LogFields{
+			LogFieldClientID: client.ID,
+			"base_url":       client.BaseURL,
+		})
+
+		return err
+
+	}
+
+	return nil
+}
+
+func (s *ClientStore) Delete(ctx context.Context, id int64) error {
+
+	ctx, span := s.Tracer.Start(ctx, "DeleteClient")
+	defer span.End()
+
+	err := s.delete(ctx, id)
+	if err != nil {
+
+		s.log().Error(ctx, "error deleting client", err, LogFields{
+			LogFieldClientID: id,
+		})
+
+		return err
+	}
+
+	return nil
+}
+
+// delete removes the client and its credentials in one transaction. Databases created
+// before client_credentials existed have no credentials to remove.
+func (s *ClientStore) delete(ctx context.Context, id int64) error {
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var tables int
+	err = tx.QueryRowContext(ctx, s.Dialect.Rebind(s.Dialect.tableExistsQuery()), "client_credentials").Scan(&tables)
+	if err != nil {
+
+		return err
+	}
+
+	if tables > 0 {
+
+		_, err = tx.ExecContext(ctx, s.Dialect.Rebind("DELETE FROM client_credentials WHERE account = ?"), id)
+		if err != nil {
+
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, s.Dialect.Rebind("DELETE FROM clients WHERE account = ?"), id)
+	if err != nil {
+
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *ClientStore) Get(ctx context.Context, clientID int64) (Client, error) {
+
+	ctx, span := s.Tracer.Start(ctx, "GetClient")
+	defer span.End()
+
+	schema, err := s.clientSchema(ctx)
+	if err != nil {
+
+		return Client{}, err
+	}
+
+	client, err := scanClient(s.queryRow(ctx, "SELECT "+schema.selectColumns()+" FROM clients WHERE account = ?", clientID))
+	if err != nil {
+
+		if errors.Is(err, sql.ErrNoRows) {
+
+			return Client{}, ErrClientNotFound
+		}
+
+		s.log().Error(ctx, "error retrieving client details", err, LogFields{
+			LogFieldClientID: clientID,
+		})
+
+		return Client{}, err
+	}
+
+	return client, nil
+}
+
+func (s *ClientStore) List(ctx context.Context, filter ClientFilter) ([]Client, error) {
+
+	ctx, span := s.Tracer.Start(ctx, "ListClients")
+	defer span.End()
+
+	schema, err := s.clientSchema(ctx)
+	if err != nil {
+
+		return nil, err
+	}
+
+	var conditions []string
+	var params []interface{}
+
+	// Without a status column every client is active.
+	if len(filter.Status) > 0 && !schema.status {
+
+		if filter.Status != ClientStatusActive {
+
+			return nil, nil
+		}
+
+	} else if len(filter.Status) > 0 {
+
+		conditions = append(conditions, "status = ?")
+		params = append(params, string(filter.Status))
+	}
+
+	if len(filter.IDs) > 0 {
+
+		placeholders := make([]string, len(filter.IDs))
+		for i, id := range filter.IDs {
+
+			placeholders[i] = "?"
+			params = append(params, id)
+		}
+
+		conditions = append(conditions, fmt.Sprintf("account IN (%s)", strings.Join(placeholders, ",")))
+	}
+
+	query := "SELECT " + schema.selectColumns() + " FROM clients"
+	if len(conditions) > 0 {
+
+		query = query + " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query = query + " ORDER BY account"
+
+	if filter.Limit > 0 {
+
+		query = query + fmt.Sprintf(" LIMIT %d OFFSET %d", filter.Limit, filter.Offset)
+	}
+
+	rows, err := s.query(ctx, query, params...)
+	if err != nil {
+
+		s.log().Error(ctx, "error listing clients", err, nil)
+
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var clients []Client
+
+	for rows.Next() {
+
+		client, err := scanClient(rows)
+		if err != nil {
+
+			return nil, err
+		}
+
+		clients = append(clients, client)
+	}
+
+	return clients, rows.Err()
+}
+
+func (s *ClientStore) Update(ctx context.Context, client Client) error {
+
+	ctx, span := s.Tracer.Start(ctx, "UpdateClient")
+	defer span.End()
+
+	schema, err := s.clientSchema(ctx)
+	if err != nil {
+
+		return err
+	}
+
+	query := "UPDATE clients SET authentication_header = ?, authentication_string = ?, base_url = ?"
+	params := []interface{}{client.AuthenticationHeader, client.AuthenticationString, client.BaseURL}
+
+	if schema.keyID {
+
+		query = query + ", authentication_key_id = ?"
+		params = append(params, client.AuthenticationKeyID)
+
+	} else if len(client.AuthenticationKeyID) > 0 {
+
+		return errClientsNotMigrated("authentication_key_id")
+	}
+
+	if len(client.Status) > 0 && !schema.status {
+
+		if client.Status != ClientStatusActive {
+
+			return errClientsNotMigrated("status")
+		}
+
+	} else if len(client.Status) > 0 {
+
+		query = query + ", status = ?"
+		params = append(params, string(client.Status))
+	}
+
+	return s.updateClient(ctx, client.ID, query+" WHERE account = ?", append(params, client.ID)...)
+}
+
+func (s *ClientStore) SetStatus(ctx context.Context, id int64, status ClientStatus) error {
+
+	ctx, span := s.Tracer.Start(ctx, "SetClientStatus")
+	defer span.End()
+
+	if !status.Valid() {
+
+		return fmt.Errorf("invalid client status %q", status)
+	}
+
+	schema, err := s.clientSchema(ctx)
+	if err != nil {
+
+		return err
+	}
+
+	if !schema.status {
+
+		return errClientsNotMigrated("status")
+	}
+
+	return s.updateClient(ctx, id, "UPDATE clients SET status = ? WHERE account = ?", string(status), id)
+}
+
+func (s *ClientStore) updateClient(ctx context.Context, id int64, query string, params ...interface{}) error {
+
+	result, err := s.exec(ctx, query, params...)
+	if err != nil {
+
+		s.log().Error(ctx, "error updating client", err, LogFields{
+			LogFieldClientID: id,
+		})
+
+		return err
+	}
+
+	// MySQL reports zero affected rows when the values did not change, so only a
+	// missing row is treated as not found.
+	affected, err := result.RowsAffected()
+	if err == nil && affected == 0 {
+
+		_, err = s.Get(ctx, id)
+	}
+
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanClient(row rowScanner) (Client, error) {
+
+	var id int64
+	var baseURL, authenticationHeader, authenticationString, authenticationKeyID, status sql.NullString
+
+	err := row.Scan(&id, &baseURL, &authenticationHeader, &authenticationString, &authenticationKeyID, &status)
+	if err != nil {
+
+		return Client{}, err
+	}
+
+	client := Client{
+		ID:                   id,
+		BaseURL:              baseURL.String,
+		AuthenticationHeader: authenticationHeader.String,
+		AuthenticationString: authenticationString.String,
+		AuthenticationKeyID:  authenticationKeyID.String,
+		Status:               ClientStatus(status.String),
+	}
+
+	if len(client.Status) == 0 {
+
+		client.Status = ClientStatusActive
+	}
+
+	return client, nil
+}
@@ -0,0 +1,296 @@
+package wallet
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// newTestClientStore returns a ClientStore over a migrated SQLite database.
+func newTestClientStore(t *testing.T) *ClientStore {
+
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "wallet.db"))
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	err = MigrateDialect(context.Background(), db, DialectSQLite)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	return NewClientStore(noop.NewTracerProvider().Tracer("test"), db, DialectSQLite)
+}
+
+func TestClientStoreCRUD(t *testing.T) {
+
+	ctx := context.Background()
+	store := newTestClientStore(t)
+
+	for _, id := range []int64{3, 1, 2} {
+
+		err := store.Create(ctx, Client{ID: id, BaseURL: "http://operator", AuthenticationHeader: "X-Auth", AuthenticationString: "secret"})
+		if err != nil {
+
+			t.Fatal(err)
+		}
+	}
+
+	client, err := store.Get(ctx, 1)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	if client.BaseURL != "http://operator" || client.Status != ClientStatusActive {
+
+		t.Fatalf("Get = %+v", client)
+	}
+
+	client.BaseURL = "http://moved"
+	client.AuthenticationString = "rotated"
+
+	err = store.Update(ctx, client)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	err = store.SetStatus(ctx, 2, ClientStatusSuspended)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	client, err = store.Get(ctx, 1)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	if client.BaseURL != "http://moved" || client.AuthenticationString != "rotated" {
+
+		t.Fatalf("Get after Update = %+v", client)
+	}
+
+	tests := []struct {
+		filter ClientFilter
+		want   []int64
+	}{
+		{ClientFilter{}, []int64{1, 2, 3}},
+		{ClientFilter{Status: ClientStatusActive}, []int64{1, 3}},
+		{ClientFilter{IDs: []int64{2, 3}}, []int64{2, 3}},
+		{ClientFilter{Limit: 1, Offset: 1}, []int64{2}},
+	}
+
+	for _, tt := range tests {
+
+		clients, err := store.List(ctx, tt.filter)
+		if err != nil {
+
+			t.Fatal(err)
+		}
+
+		var got []int64
+		for _, c := range clients {
+
+			got = append(got, c.ID)
+		}
+
+		if len(got) != len(tt.want) {
+
+			t.Fatalf("List(%+v) = %v, want %v", tt.filter, got, tt.want)
+		}
+
+		for i := range got {
+
+			if got[i] != tt.want[i] {
+
+				t.Fatalf("List(%+v) = %v, want %v", tt.filter, got, tt.want)
+			}
+		}
+	}
+
+	err = store.Update(ctx, Client{ID: 9})
+	if !errors.Is(err, ErrClientNotFound) {
+
+		t.Fatalf("Update of a missing client = %v, want ErrClientNotFound", err)
+	}
+}
+
+func TestClientStoreDelete(t *testing.T) {
+
+	ctx := context.Background()
+	store := newTestClientStore(t)
+
+	for _, id := range []int64{1, 2} {
+
+		err := store.Create(ctx, Client{ID: id, AuthenticationHeader: "X-Auth", AuthenticationString: "secret"})
+		if err != nil {
+
+			t.Fatal(err)
+		}
+
+		_, err = store.StageCredential(ctx, Credential{ClientID: id, Header: "X-Auth", Secret: "next"})
+		if err != nil {
+
+			t.Fatal(err)
+		}
+	}
+
+	err := store.Delete(ctx, 1)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	_, err = store.Get(ctx, 1)
+	if !errors.Is(err, ErrClientNotFound) {
+
+		t.Fatalf("Get after Delete = %v, want ErrClientNotFound", err)
+	}
+
+	credentials, err := store.ListCredentials(ctx, 1)
+	if err != nil || len(credentials) > 0 {
+
+		t.Fatalf("credentials after Delete = %+v, %v", credentials, err)
+	}
+
+	credentials, err = store.ListCredentials(ctx, 2)
+	if err != nil || len(credentials) != 1 {
+
+		t.Fatalf("credentials of another client = %+v, %v", credentials, err)
+	}
+}
+
+func TestClientStoreDeleteWithoutCredentialsTable(t *testing.T) {
+
+	ctx := context.Background()
+	store := newTestClientStore(t)
+
+	_, err := store.DB.ExecContext(ctx, "DROP TABLE client_credentials")
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	err = store.Create(ctx, Client{ID: 1, AuthenticationHeader: "X-Auth", AuthenticationString: "secret"})
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	err = store.Delete(ctx, 1)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	_, err = store.Get(ctx, 1)
+	if !errors.Is(err, ErrClientNotFound) {
+
+		t.Fatalf("Get after Delete = %v, want ErrClientNotFound", err)
+	}
+}
+
+func TestClientStoreCreateKeepsStatus(t *testing.T) {
+
+	ctx := context.Background()
+	store := newTestClientStore(t)
+
+	client := Client{ID: 1, BaseURL: "http://operator", AuthenticationHeader: "X-Auth", AuthenticationString: "secret"}
+
+	err := store.Create(ctx, client)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	err = store.SetStatus(ctx, 1, ClientStatusSuspended)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	client.BaseURL = "http://moved"
+
+	err = store.Create(ctx, client)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	got, err := store.Get(ctx, 1)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	if got.Status != ClientStatusSuspended || got.BaseURL != "http://moved" {
+
+		t.Fatalf("Get after re-creating a suspended client = %+v", got)
+	}
+}
+
+// An upgraded library must keep working against a database that has not been migrated.
+func TestClientStoreUnmigrated(t *testing.T) {
+
+	ctx := context.Background()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "wallet.db"))
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.ExecContext(ctx, "CREATE TABLE clients (account INTEGER NOT NULL PRIMARY KEY, base_url TEXT NOT NULL DEFAULT '', authentication_header TEXT NOT NULL DEFAULT '', authentication_string TEXT NULL)")
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	store := NewClientStore(noop.NewTracerProvider().Tracer("test"), db, DialectSQLite)
+
+	err = store.Create(ctx, Client{ID: 1, BaseURL: "http://operator", AuthenticationHeader: "X-Auth", AuthenticationString: "secret"})
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	client, err := store.Get(ctx, 1)
+	if err != nil || client.AuthenticationString != "secret" || client.Status != ClientStatusActive {
+
+		t.Fatalf("Get = %+v, %v", client, err)
+	}
+
+	clients, err := store.List(ctx, ClientFilter{Status: ClientStatusActive})
+	if err != nil || len(clients) != 1 {
+
+		t.Fatalf("List(active) = %+v, %v", clients, err)
+	}
+
+	err = store.Create(ctx, Client{ID: 2, AuthenticationString: "sealed", AuthenticationKeyID: "k1"})
+	if err == nil {
+
+		t.Fatal("stored an encrypted secret without a key ID column")
+	}
+
+	err = store.SetStatus(ctx, 1, ClientStatusSuspended)
+	if err == nil {
+
+		t.Fatal("set a status without a status column")
+	}
+}
@@ -0,0 +1,86 @@
+// Command wallet-conformance runs the operator conformance battery against an operator
+// wallet and prints a pass/fail report. It exits with status 1 when a check fails.
+//
+//	wallet-conformance -base-url https://operator.example/wallet -client-id 101 \
+//		-header X-Api-Key -secret s3cr3t -player test-player-1 -amount 1
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	wallet "github.com/touchvas/casino-wallet"
+	"github.com/touchvas/casino-wallet/conformance"
+	"go.opentelemetry.io/otel"
+)
+
+func main() {
+
+	baseURL := flag.String("base-url", "", "operator wallet base URL")
+	clientID := flag.Int64("client-id", 1, "operator client ID")
+	header := flag.String("header", "X-Api-Key", "authentication header")
+	secret := flag.String("secret", "", "authentication secret")
+	player := flag.String("player", "", "test player ID, with a balance of at least 10 times the amount")
+	amount := flag.Float64("amount", 1, "amount of each debit")
+	concurrency := flag.Int("concurrency", 5, "identical debits sent at once by the concurrent debit check")
+	providerID := flag.Int64("provider-id", 1, "provider ID sent to the operator")
+	providerName := flag.String("provider-name", "conformance", "provider name sent to the operator")
+	timeout := flag.Duration("timeout", 5*time.Minute, "timeout of the whole run")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	if len(*baseURL) == 0 || len(*player) == 0 {
+
+		fmt.Fprintln(os.Stderr, "-base-url and -player are required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	w, err := wallet.NewWallet(otel.Tracer("wallet-conformance"), wallet.ProviderIdentity{ID: *providerID, Name: *providerName})
+	if err != nil {
+
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	runner := &conformance.Runner{
+		Wallet: w,
+		Client: wallet.Client{
+			ID:                   *clientID,
+			BaseURL:              *baseURL,
+			AuthenticationHeader: *header,
+			AuthenticationString: *secret,
+		},
+		PlayerID:    *player,
+		Amount:      *amount,
+		Concurrency: *concurrency,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	report := runner.Run(ctx)
+	cancel()
+
+	if *asJSON {
+
+		data, err := report.MarshalIndent()
+		if err != nil {
+
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+
+		fmt.Println(string(data))
+
+	} else {
+
+		report.WriteText(os.Stdout)
+	}
+
+	if !report.Passed() {
+
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,130 @@
+// Command wallet-simulator serves an in-memory operator wallet for manual and
+// cross-language integration testing.
+//
+//	wallet-simulator -addr :8090 -header X-Api-Key -secret test \
+//		-player alice=100 -player bob=5 -scenarios scenarios.json
+//
+// The scenarios file holds a JSON array of scenarios, with latency as a Go duration:
+//
+//	[{"operation": "debit", "player_id": "bob", "fault": "timeout", "times": 1},
+//	 {"operation": "credit", "latency": "1.5s"}]
+//
+// GET /_calls lists the calls received so far as JSON, and /_calls?operation=debit only
+// those of one operation.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/touchvas/casino-wallet/simulator"
+)
+
+type scenarioFile struct {
+	Operation     string          `json:"operation"`
+	PlayerID      string          `json:"player_id"`
+	TransactionID string          `json:"transaction_id"`
+	Fault         simulator.Fault `json:"fault"`
+	Latency       string          `json:"latency"`
+	Times         int             `json:"times"`
+}
+
+func main() {
+
+	addr := flag.String("addr", ":8090", "listen address")
+	header := flag.String("header", "X-Api-Key", "authentication header")
+	secret := flag.String("secret", "test", "authentication secret")
+	scenarios := flag.String("scenarios", "", "JSON file of scenarios")
+
+	players := map[string]float64{}
+	flag.Func("player", "player as id=balance, repeatable", func(v string) error {
+
+		id, balance, ok := strings.Cut(v, "=")
+		if !ok {
+
+			return fmt.Errorf("expected id=balance, got %q", v)
+		}
+
+		amount, err := strconv.ParseFloat(balance, 64)
+		if err != nil {
+
+			return err
+		}
+
+		players[id] = amount
+		return nil
+	})
+
+	flag.Parse()
+
+	sim := simulator.New(*header, *secret)
+
+	for id, balance := range players {
+
+		sim.SetPlayer(id, balance)
+	}
+
+	if len(*scenarios) > 0 {
+
+		err := loadScenarios(sim, *scenarios)
+		if err != nil {
+
+			log.Fatalf("error loading scenarios: %v", err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/_calls", sim.CallsHandler())
+	mux.Handle("/", sim)
+
+	log.Printf("operator wallet simulator listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+func loadScenarios(sim *simulator.Simulator, path string) error {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+
+		return err
+	}
+
+	var entries []scenarioFile
+
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+
+		return err
+	}
+
+	for _, e := range entries {
+
+		var latency time.Duration
+		if len(e.Latency) > 0 {
+
+			latency, err = time.ParseDuration(e.Latency)
+			if err != nil {
+
+				return fmt.Errorf("invalid latency %q: %v", e.Latency, err)
+			}
+		}
+
+		sim.Script(simulator.Scenario{
+			Operation:     e.Operation,
+			PlayerID:      e.PlayerID,
+			TransactionID: e.TransactionID,
+			Fault:         e.Fault,
+			Latency:       latency,
+			Times:         e.Times,
+		})
+	}
+
+	return nil
+}
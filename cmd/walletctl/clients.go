@@ -0,0 +1,568 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	wallet "github.com/touchvas/casino-wallet"
+)
+
+var clientCommands = []command{
+	{"list", "list operator clients", clientList},
+	{"get", "show an operator client and its credentials", clientGet},
+	{"create", "create or replace an operator client", clientCreate},
+	{"update", "change the settings of an operator client", clientUpdate},
+	{"delete", "delete an operator client and its credentials", clientDelete},
+	{"credentials", "list the credentials of an operator client", clientCredentials},
+	{"rotate", "stage a new credential, promoting it with -promote", clientRotate},
+	{"promote", "make a staged credential the primary one", clientPromote},
+	{"retire", "stop sending a credential", clientRetire},
+}
+
+// clientView is the printed form of a client. Secrets are never printed.
+type clientView struct {
+	ID          int64               `json:"id"`
+	BaseURL     string              `json:"base_url"`
+	Header      string              `json:"authentication_header"`
+	Secret      string              `json:"authentication_string"`
+	Status      wallet.ClientStatus `json:"status"`
+	Credentials []credentialView    `json:"credentials,omitempty"`
+}
+
+type credentialView struct {
+	ID         int64                  `json:"id"`
+	Header     string                 `json:"header"`
+	Secret     string                 `json:"secret"`
+	State      wallet.CredentialState `json:"state"`
+	Primary    bool                   `json:"primary"`
+	ValidFrom  time.Time              `json:"valid_from"`
+	ValidUntil time.Time              `json:"valid_until"`
+	LastUsedAt time.Time              `json:"last_used_at"`
+}
+
+func newClientView(client wallet.Client) clientView {
+
+	view := clientView{
+		ID:      client.ID,
+		BaseURL: client.BaseURL,
+		Header:  client.AuthenticationHeader,
+		Secret:  mask(client.AuthenticationString),
+		Status:  client.Status,
+	}
+
+	for _, credential := range client.Credentials {
+
+		view.Credentials = append(view.Credentials, newCredentialView(credential))
+	}
+
+	return view
+}
+
+func newCredentialView(credential wallet.Credential) credentialView {
+
+	return credentialView{
+		ID:         credential.ID,
+		Header:     credential.Header,
+		Secret:     mask(credential.Secret),
+		State:      credential.State,
+		Primary:    credential.Primary,
+		ValidFrom:  credential.ValidFrom,
+		ValidUntil: credential.ValidUntil,
+		LastUsedAt: credential.LastUsedAt,
+	}
+}
+
+func (a *app) printCredentials(views []credentialView) error {
+
+	var rows [][]string
+	for _, c := range views {
+
+		rows = append(rows, []string{formatInt(c.ID), c.Header, c.Secret, string(c.State), fmt.Sprint(c.Primary), formatTime(c.ValidFrom), formatTime(c.ValidUntil), formatTime(c.LastUsedAt)})
+	}
+
+	return a.out.table(views, []string{"ID", "HEADER", "SECRET", "STATE", "PRIMARY", "VALID FROM", "VALID UNTIL", "LAST USED"}, rows)
+}
+
+func clientList(a *app, args []string) error {
+
+	fs := newFlagSet("client", "list")
+	status := fs.String("status", "", "only clients with this status")
+	limit := fs.Int("limit", 0, "maximum number of clients, 0 for all")
+	offset := fs.Int("offset", 0, "number of clients to skip")
+
+	err := fs.Parse(args)
+	if err != nil {
+
+		return err
+	}
+
+	registry, err := a.clients()
+	if err != nil {
+
+		return err
+	}
+
+	clients, err := registry.List(a.ctx, wallet.ClientFilter{Status: wallet.ClientStatus(*status), Limit: *limit, Offset: *offset})
+	if err != nil {
+
+		return err
+	}
+
+	views := []clientView{}
+	var rows [][]string
+
+	for _, client := range clients {
+
+		view := newClientView(client)
+		view.Credentials = nil
+		views = append(views, view)
+		rows = append(rows, []string{formatInt(view.ID), string(view.Status), view.BaseURL, view.Header, view.Secret})
+	}
+
+	return a.out.table(views, []string{"ID", "STATUS", "BASE URL", "HEADER", "SECRET"}, rows)
+}
+
+func clientGet(a *app, args []string) error {
+
+	fs := newFlagSet("client", "get")
+	id := fs.Int64("id", 0, "client ID")
+
+	err := fs.Parse(args)
+	if err != nil {
+
+		return err
+	}
+
+	err = required(fs, "id")
+	if err != nil {
+
+		return err
+	}
+
+	registry, err := a.clients()
+	if err != nil {
+
+		return err
+	}
+
+	client, err := registry.Get(a.ctx, *id)
+	if err != nil {
+
+		return err
+	}
+
+	view := newClientView(client)
+	if a.out.json {
+
+		return a.out.encode(view)
+	}
+
+	err = a.out.fields(view, []string{"ID", "Status", "Base URL", "Header", "Secret"},
+		[]string{formatInt(view.ID), string(view.Status), view.BaseURL, view.Header, view.Secret})
+	if err != nil || len(view.Credentials) == 0 {
+
+		return err
+	}
+
+	fmt.Fprintln(a.out.w)
+	return a.printCredentials(view.Credentials)
+}
+
+func clientCreate(a *app, args []string) error {
+
+	fs := newFlagSet("client", "create")
+	id := fs.Int64("id", 0, "client ID")
+	baseURL := fs.String("base-url", "", "operator wallet base URL")
+	header := fs.String("header", "", "authentication header")
+	secretSource := newSecretFlags(fs, "secret", "authentication secret")
+	status := fs.String("status", string(wallet.ClientStatusActive), "client status")
+
+	err := fs.Parse(args)
+	if err != nil {
+
+		return err
+	}
+
+	err = required(fs, "id", "base-url", "header")
+	if err != nil {
+
+		return err
+	}
+
+	secret, err := secretSource.read(a)
+	if err != nil {
+
+		return err
+	}
+
+	client := wallet.Client{
+		ID:                   *id,
+		BaseURL:              *baseURL,
+		AuthenticationHeader: *header,
+		AuthenticationString: secret,
+		Status:               wallet.ClientStatus(*status),
+	}
+
+	if !client.Status.Valid() {
+
+		return fmt.Errorf("invalid client status %q", client.Status)
+	}
+
+	registry, err := a.clients()
+	if err != nil {
+
+		return err
+	}
+
+	_, err = registry.Get(a.ctx, client.ID)
+	switch {
+
+	case err == nil:
+		err = a.ask("client %d exists and will be replaced with base URL %s", client.ID, client.BaseURL)
+
+	case errors.Is(err, wallet.ErrClientNotFound):
+		err = a.ask("creating client %d with base URL %s", client.ID, client.BaseURL)
+	}
+
+	if err != nil {
+
+		return err
+	}
+
+	err = registry.Create(a.ctx, client)
+	if err != nil {
+
+		return err
+	}
+
+	return a.out.fields(newClientView(client), []string{"Created"}, []string{formatInt(client.ID)})
+}
+
+func clientUpdate(a *app, args []string) error {
+
+	fs := newFlagSet("client", "update")
+	id := fs.Int64("id", 0, "client ID")
+	baseURL := fs.String("base-url", "", "operator wallet base URL")
+	header := fs.String("header", "", "authentication header")
+	secretSource := newSecretFlags(fs, "secret", "authentication secret")
+	status := fs.String("status", "", "client status")
+
+	err := fs.Parse(args)
+	if err != nil {
+
+		return err
+	}
+
+	err = required(fs, "id")
+	if err != nil {
+
+		return err
+	}
+
+	registry, err := a.clients()
+	if err != nil {
+
+		return err
+	}
+
+	client, err := registry.Get(a.ctx, *id)
+	if err != nil {
+
+		return err
+	}
+
+	set := flagsSet(fs)
+
+	if set["base-url"] {
+
+		client.BaseURL = *baseURL
+	}
+
+	if set["header"] {
+
+		client.AuthenticationHeader = *header
+	}
+
+	if secretSource.given(fs) {
+
+		client.AuthenticationString, err = secretSource.read(a)
+		if err != nil {
+
+			return err
+		}
+	}
+
+	if set["status"] {
+
+		client.Status = wallet.ClientStatus(*status)
+		if !client.Status.Valid() {
+
+			return fmt.Errorf("invalid client status %q", client.Status)
+		}
+	}
+
+	err = a.ask("updating client %d: base URL %s, header %s, status %s", client.ID, client.BaseURL, client.AuthenticationHeader, client.Status)
+	if err != nil {
+
+		return err
+	}
+
+	err = registry.Update(a.ctx, client)
+	if err != nil {
+
+		return err
+	}
+
+	view := newClientView(client)
+	view.Credentials = nil
+
+	return a.out.fields(view, []string{"Updated"}, []string{formatInt(client.ID)})
+}
+
+func clientDelete(a *app, args []string) error {
+
+	fs := newFlagSet("client", "delete")
+	id := fs.Int64("id", 0, "client ID")
+
+	err := fs.Parse(args)
+	if err != nil {
+
+		return err
+	}
+
+	err = required(fs, "id")
+	if err != nil {
+
+		return err
+	}
+
+	registry, err := a.clients()
+	if err != nil {
+
+		return err
+	}
+
+	client, err := registry.Get(a.ctx, *id)
+	if err != nil {
+
+		return err
+	}
+
+	err = a.ask("deleting client %d (%s) and its %d credentials", client.ID, client.BaseURL, len(client.Credentials))
+	if err != nil {
+
+		return err
+	}
+
+	err = registry.Delete(a.ctx, client.ID)
+	if err != nil {
+
+		return err
+	}
+
+	return a.out.fields(map[string]int64{"deleted": client.ID}, []string{"Deleted"}, []string{formatInt(client.ID)})
+}
+
+func clientCredentials(a *app, args []string) error {
+
+	fs := newFlagSet("client", "credentials")
+	id := fs.Int64("id", 0, "client ID")
+
+	err := fs.Parse(args)
+	if err != nil {
+
+		return err
+	}
+
+	err = required(fs, "id")
+	if err != nil {
+
+		return err
+	}
+
+	registry, err := a.clients()
+	if err != nil {
+
+		return err
+	}
+
+	client, err := registry.Get(a.ctx, *id)
+	if err != nil {
+
+		return err
+	}
+
+	views := []credentialView{}
+	for _, credential := range client.Credentials {
+
+		views = append(views, newCredentialView(credential))
+	}
+
+	return a.printCredentials(views)
+}
+
+// clientRotate starts a credential rotation. The new credential is staged, so it is only
+// tried when the operator rejects the primary, until it is promoted here with -promote
+// or later with "client promote". The old primary is retired with "client retire" once
+// the operator has switched.
+func clientRotate(a *app, args []string) error {
+
+	fs := newFlagSet("client", "rotate")
+	id := fs.Int64("id", 0, "client ID")
+	header := fs.String("header", "", "authentication header, the primary credential's by default")
+	secretSource := newSecretFlags(fs, "secret", "new authentication secret")
+	validFrom := fs.String("valid-from", "", "RFC 3339 time the credential becomes usable")
+	validUntil := fs.String("valid-until", "", "RFC 3339 time the credential stops being usable")
+	promote := fs.Bool("promote", false, "make the new credential the primary one")
+
+	err := fs.Parse(args)
+	if err != nil {
+
+		return err
+	}
+
+	err = required(fs, "id")
+	if err != nil {
+
+		return err
+	}
+
+	secret, err := secretSource.read(a)
+	if err != nil {
+
+		return err
+	}
+
+	credential := wallet.Credential{ClientID: *id, Header: *header, Secret: secret}
+
+	credential.ValidFrom, err = parseTime(*validFrom)
+	if err != nil {
+
+		return fmt.Errorf("-valid-from: %v", err)
+	}
+
+	credential.ValidUntil, err = parseTime(*validUntil)
+	if err != nil {
+
+		return fmt.Errorf("-valid-until: %v", err)
+	}
+
+	registry, err := a.clients()
+	if err != nil {
+
+		return err
+	}
+
+	client, err := registry.Get(a.ctx, *id)
+	if err != nil {
+
+		return err
+	}
+
+	if len(credential.Header) == 0 {
+
+		credential.Header = client.AuthenticationHeader
+	}
+
+	action := "staging"
+	if *promote {
+
+		action = "staging and promoting"
+	}
+
+	err = a.ask("%s a new %s credential for client %d", action, credential.Header, client.ID)
+	if err != nil {
+
+		return err
+	}
+
+	credential.ID, err = registry.StageCredential(a.ctx, credential)
+	if err != nil {
+
+		return err
+	}
+
+	credential.State = wallet.CredentialStateStaged
+
+	if *promote {
+
+		err = registry.PromoteCredential(a.ctx, client.ID, credential.ID)
+		if err != nil {
+
+			return fmt.Errorf("credential %d was staged but not promoted: %v", credential.ID, err)
+		}
+
+		credential.State = wallet.CredentialStateActive
+		credential.Primary = true
+	}
+
+	return a.printCredentials([]credentialView{newCredentialView(credential)})
+}
+
+func clientPromote(a *app, args []string) error {
+
+	return credentialChange(a, "promote", args)
+}
+
+func clientRetire(a *app, args []string) error {
+
+	return credentialChange(a, "retire", args)
+}
+
+func credentialChange(a *app, name string, args []string) error {
+
+	fs := newFlagSet("client", name)
+	id := fs.Int64("id", 0, "client ID")
+	credentialID := fs.Int64("credential", 0, "credential ID")
+
+	err := fs.Parse(args)
+	if err != nil {
+
+		return err
+	}
+
+	err = required(fs, "id", "credential")
+	if err != nil {
+
+		return err
+	}
+
+	registry, err := a.clients()
+	if err != nil {
+
+		return err
+	}
+
+	err = a.ask("%s credential %d of client %d", name, *credentialID, *id)
+	if err != nil {
+
+		return err
+	}
+
+	if name == "promote" {
+
+		err = registry.PromoteCredential(a.ctx, *id, *credentialID)
+
+	} else {
+
+		err = registry.RetireCredential(a.ctx, *id, *credentialID)
+	}
+
+	if err != nil {
+
+		return err
+	}
+
+	return clientCredentials(a, []string{"-id", formatInt(*id)})
+}
+
+func parseTime(value string) (time.Time, error) {
+
+	if len(value) == 0 {
+
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
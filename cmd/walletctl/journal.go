@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	wallet "github.com/touchvas/casino-wallet"
+)
+
+// The journal is the audit log written by a FileAuditSink, one JSON record per line.
+var journalCommands = []command{
+	{"list", "list audit journal records, newest last", journalList},
+	{"verify", "verify the hash chain of the audit journal", journalVerify},
+}
+
+// journalFile returns the -file flag of a journal command, defaulting to -audit-file.
+func (a *app) journalFile(file string) (string, error) {
+
+	if len(file) == 0 {
+
+		file = a.auditFile
+	}
+
+	if len(file) == 0 {
+
+		return "", fmt.Errorf("no journal given, set -file, -audit-file or WALLET_AUDIT_FILE")
+	}
+
+	return file, nil
+}
+
+func journalList(a *app, args []string) error {
+
+	fs := newFlagSet("journal", "list")
+	file := fs.String("file", "", "audit journal, -audit-file by default")
+	client := fs.Int64("client", 0, "only records of this client")
+	player := fs.String("player", "", "only records of this player")
+	round := fs.String("round", "", "only records of this round")
+	txn := fs.String("txn", "", "only records of this transaction, or of the debit it refers to")
+	operation := fs.String("operation", "", "only records of this operation")
+	failed := fs.Bool("failed", false, "only records the operator did not accept")
+	limit := fs.Int("limit", 50, "print at most the last n matching records, 0 for all")
+
+	err := fs.Parse(args)
+	if err != nil {
+
+		return err
+	}
+
+	path, err := a.journalFile(*file)
+	if err != nil {
+
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+
+		return err
+	}
+
+	defer f.Close()
+
+	records := []wallet.AuditRecord{}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+
+	for scanner.Scan() {
+
+		if len(scanner.Bytes()) == 0 {
+
+			continue
+		}
+
+		var record wallet.AuditRecord
+
+		err := json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+
+			return fmt.Errorf("malformed journal record after sequence %d: %v", lastSequence(records), err)
+		}
+
+		switch {
+
+		case *client > 0 && record.ClientID != *client:
+		case len(*player) > 0 && record.PlayerID != *player:
+		case len(*round) > 0 && record.RoundID != *round:
+		case len(*txn) > 0 && record.TransactionID != *txn && record.DebitTransactionID != *txn:
+		case len(*operation) > 0 && record.Operation != *operation:
+		case *failed && record.Result == wallet.OutcomeSuccess:
+
+		default:
+			records = append(records, record)
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+
+		return err
+	}
+
+	if *limit > 0 && len(records) > *limit {
+
+		records = records[len(records)-*limit:]
+	}
+
+	var rows [][]string
+	for _, r := range records {
+
+		rows = append(rows, []string{formatInt(r.Sequence), formatTime(r.StartedAt), r.Operation, formatInt(r.ClientID), r.PlayerID, r.RoundID, r.TransactionID, formatAmount(r.Amount), formatBalance(r.BalanceBefore), formatBalance(r.BalanceAfter), formatInt(r.Status), r.Result, r.Error})
+	}
+
+	return a.out.table(records, []string{"SEQ", "STARTED", "OPERATION", "CLIENT", "PLAYER", "ROUND", "TRANSACTION", "AMOUNT", "BEFORE", "AFTER", "STATUS", "RESULT", "ERROR"}, rows)
+}
+
+func lastSequence(records []wallet.AuditRecord) int64 {
+
+	if len(records) == 0 {
+
+		return 0
+	}
+
+	return records[len(records)-1].Sequence
+}
+
+func journalVerify(a *app, args []string) error {
+
+	fs := newFlagSet("journal", "verify")
+	file := fs.String("file", "", "audit journal, -audit-file by default")
+
+	err := fs.Parse(args)
+	if err != nil {
+
+		return err
+	}
+
+	path, err := a.journalFile(*file)
+	if err != nil {
+
+		return err
+	}
+
+	options, err := a.auditOptions()
+	if err != nil {
+
+		return err
+	}
+
+	records, err := wallet.VerifyAuditFileWithOptions(a.ctx, path, options)
+	if err != nil {
+
+		return err
+	}
+
+	return a.out.fields(map[string]interface{}{"file": path, "records": records, "valid": true},
+		[]string{"File", "Records", "Chain"}, []string{path, formatInt(records), "valid"})
+}
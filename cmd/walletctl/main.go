@@ -0,0 +1,663 @@
+// Command walletctl is the operations and support tool of the wallet library: it manages
+// operator clients and their credentials, issues, inspects and revokes player sessions,
+// sends manual wallet instructions and inspects the audit journal.
+//
+//	walletctl [flags] client list|get|create|update|delete|credentials|rotate|promote|retire
+//	walletctl [flags] session issue|inspect|revoke
+//	walletctl [flags] wallet profile|debit|credit|rollback|settle
+//	walletctl [flags] journal list|verify
+//
+// Run "walletctl <group> <command> -h" for the flags of a command. Global flags default to
+// the environment variables named in their usage. Commands that change state ask for
+// confirmation unless -yes is given; the -timeout of the command starts once confirmed.
+//
+// The library depends on no SQL driver, but this command links the mysql, postgres and
+// sqlite3 drivers for -driver.
+//
+// Secrets are never given on the command line, where they would end up in shell history
+// and ps: they are read from a file, from stdin with "-", or from an environment variable.
+// Secrets stored encrypted are read with the keys of CLIENT_SECRET_KEYS and
+// CLIENT_SECRET_KEY_ID, and new secrets are encrypted with them when they are set.
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/redis/go-redis/v9"
+	wallet "github.com/touchvas/casino-wallet"
+	"go.opentelemetry.io/otel"
+)
+
+// errAborted is returned when the operator declines the confirmation prompt.
+var errAborted = errors.New("aborted")
+
+// command is one "walletctl <group> <name>" command. run receives the arguments after
+// the command name.
+type command struct {
+	name    string
+	summary string
+	run     func(app *app, args []string) error
+}
+
+var groups = []struct {
+	name     string
+	commands []command
+}{
+	{"client", clientCommands},
+	{"session", sessionCommands},
+	{"wallet", walletCommands},
+	{"journal", journalCommands},
+}
+
+// app holds the global configuration and the connections opened from it on first use.
+type app struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	timeout time.Duration
+	out     *output
+	confirm bool
+	stdin   *bufio.Reader
+
+	driver         string
+	dsn            string
+	dialect        string
+	redisURL       string
+	redisCluster   bool
+	tokenMode      string
+	signingKeyID   string
+	signingKeyFile string
+	accountFormat  string
+	providerID     int64
+	providerName   string
+	auditFile      string
+	auditAnchor    string
+
+	db       *sql.DB
+	registry *wallet.ClientRegistry
+	redis    redis.UniversalClient
+	audit    *wallet.FileAuditSink
+}
+
+func main() {
+
+	a := &app{stdin: bufio.NewReader(os.Stdin)}
+	format := "table"
+
+	flag.StringVar(&a.driver, "driver", env("WALLET_DB_DRIVER", "mysql"), "database/sql driver name, WALLET_DB_DRIVER")
+	flag.StringVar(&a.dsn, "dsn", os.Getenv("WALLET_DB_DSN"), "database DSN, WALLET_DB_DSN")
+	flag.StringVar(&a.dialect, "dialect", os.Getenv("WALLET_DB_DIALECT"), "SQL dialect when it cannot be told from the driver, WALLET_DB_DIALECT")
+	flag.StringVar(&a.redisURL, "redis-url", os.Getenv("REDIS_URL"), "Redis URL, REDIS_URL; cluster nodes beyond the first are added as addr query parameters")
+	flag.BoolVar(&a.redisCluster, "redis-cluster", os.Getenv("REDIS_CLUSTER") == "true", "connect to a Redis Cluster, REDIS_CLUSTER")
+	flag.StringVar(&a.tokenMode, "token-mode", env("WALLET_TOKEN_MODE", "redis"), "session token mode, redis or signed, WALLET_TOKEN_MODE")
+	flag.StringVar(&a.signingKeyID, "signing-key-id", os.Getenv("WALLET_SIGNING_KEY_ID"), "ID of the HMAC key of signed tokens, WALLET_SIGNING_KEY_ID")
+	flag.StringVar(&a.signingKeyFile, "signing-key-file", os.Getenv("WALLET_SIGNING_KEY_FILE"), "file holding the HMAC key of signed tokens, - for stdin, WALLET_SIGNING_KEY_FILE; the key is read from WALLET_SIGNING_KEY otherwise")
+	flag.StringVar(&a.accountFormat, "account-format", env("WALLET_ACCOUNT_FORMAT", env("ACCOUNT_ID_FORMAT", "legacy")), "account ID format, legacy or delimited, WALLET_ACCOUNT_FORMAT or ACCOUNT_ID_FORMAT")
+	flag.StringVar(&a.providerName, "provider-name", os.Getenv("PROVIDER_NAME"), "provider name sent to operators, PROVIDER_NAME")
+	flag.StringVar(&a.auditFile, "audit-file", os.Getenv("WALLET_AUDIT_FILE"), "audit journal recording manual wallet instructions, WALLET_AUDIT_FILE; the journal is keyed with WALLET_AUDIT_KEY when set")
+	flag.StringVar(&a.auditAnchor, "audit-anchor", os.Getenv("WALLET_AUDIT_ANCHOR"), "name of the Redis anchor of the audit journal, WALLET_AUDIT_ANCHOR")
+	flag.StringVar(&format, "o", format, "output format, table or json")
+	flag.BoolVar(&a.confirm, "yes", false, "do not ask for confirmation")
+	flag.DurationVar(&a.timeout, "timeout", time.Minute, "timeout of the command, from its confirmation")
+
+	providerID, _ := strconv.ParseInt(os.Getenv("PROVIDER_ID"), 10, 64)
+	flag.Int64Var(&a.providerID, "provider-id", providerID, "provider ID sent to operators, PROVIDER_ID")
+
+	flag.Usage = usage
+	flag.Parse()
+
+	out, err := newOutput(format, os.Stdout)
+	if err != nil {
+
+		fail(err, 2)
+	}
+
+	a.out = out
+
+	args := flag.Args()
+	if len(args) < 2 {
+
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := lookup(args[0], args[1])
+	if !ok {
+
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", strings.Join(args[:2], " "))
+		usage()
+		os.Exit(2)
+	}
+
+	a.startTimeout()
+
+	err = cmd.run(a, args[2:])
+	a.close()
+	a.cancel()
+
+	if errors.Is(err, flag.ErrHelp) {
+
+		os.Exit(2)
+	}
+
+	if err != nil {
+
+		fail(err, 1)
+	}
+}
+
+func lookup(group, name string) (command, bool) {
+
+	for _, g := range groups {
+
+		if g.name != group {
+
+			continue
+		}
+
+		for _, cmd := range g.commands {
+
+			if cmd.name == name {
+
+				return cmd, true
+			}
+		}
+	}
+
+	return command{}, false
+}
+
+func usage() {
+
+	fmt.Fprintf(os.Stderr, "usage: walletctl [flags] <group> <command> [command flags]\n\n")
+
+	for _, g := range groups {
+
+		for _, cmd := range g.commands {
+
+			fmt.Fprintf(os.Stderr, "  %-28s %s\n", g.name+" "+cmd.name, cmd.summary)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "\nflags:\n")
+	flag.PrintDefaults()
+}
+
+func fail(err error, code int) {
+
+	fmt.Fprintln(os.Stderr, "walletctl:", err)
+	os.Exit(code)
+}
+
+func env(name, fallback string) string {
+
+	value := os.Getenv(name)
+	if len(value) == 0 {
+
+		return fallback
+	}
+
+	return value
+}
+
+// newFlagSet returns the flag set of a command, which reports parse errors instead of
+// exiting so that connections are closed.
+func newFlagSet(group, name string) *flag.FlagSet {
+
+	return flag.NewFlagSet("walletctl "+group+" "+name, flag.ContinueOnError)
+}
+
+// flagsSet returns the names of the flags given on the command line.
+func flagsSet(fs *flag.FlagSet) map[string]bool {
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+
+		set[f.Name] = true
+	})
+
+	return set
+}
+
+// required reports the first of names that was not given.
+func required(fs *flag.FlagSet, names ...string) error {
+
+	set := flagsSet(fs)
+
+	for _, name := range names {
+
+		if !set[name] {
+
+			return fmt.Errorf("-%s is required", name)
+		}
+	}
+
+	return nil
+}
+
+// startTimeout starts the -timeout of the command, ending the previous one.
+func (a *app) startTimeout() {
+
+	if a.cancel != nil {
+
+		a.cancel()
+	}
+
+	a.ctx, a.cancel = context.WithTimeout(context.Background(), a.timeout)
+}
+
+// ask describes a change and waits for the operator to type yes, unless -yes was given.
+// The timeout of the command restarts once the change is confirmed, so that time spent
+// at the prompt does not count against it.
+func (a *app) ask(format string, args ...interface{}) error {
+
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+
+	if !a.confirm {
+
+		fmt.Fprint(os.Stderr, "type yes to continue: ")
+
+		answer, _ := a.stdin.ReadString('\n')
+		if strings.TrimSpace(answer) != "yes" {
+
+			return errAborted
+		}
+	}
+
+	a.startTimeout()
+	return nil
+}
+
+// secretFlags are the -<name>-file and -<name>-env flags a command reads a secret from.
+type secretFlags struct {
+	name string
+	file *string
+	env  *string
+}
+
+func newSecretFlags(fs *flag.FlagSet, name, usage string) *secretFlags {
+
+	return &secretFlags{
+		name: name,
+		file: fs.String(name+"-file", "", "file holding the "+usage+", - for stdin"),
+		env:  fs.String(name+"-env", "", "environment variable holding the "+usage),
+	}
+}
+
+// given reports whether the secret was given on the command line.
+func (s *secretFlags) given(fs *flag.FlagSet) bool {
+
+	set := flagsSet(fs)
+	return set[s.name+"-file"] || set[s.name+"-env"]
+}
+
+func (s *secretFlags) read(a *app) (string, error) {
+
+	switch {
+
+	case len(*s.file) > 0 && len(*s.env) > 0:
+		return "", fmt.Errorf("-%s-file and -%s-env are exclusive", s.name, s.name)
+
+	case len(*s.env) > 0:
+		value := os.Getenv(*s.env)
+		if len(value) == 0 {
+
+			return "", fmt.Errorf("-%s-env: %s is not set", s.name, *s.env)
+		}
+
+		return value, nil
+
+	case len(*s.file) > 0:
+		value, err := a.readSecretFile(*s.file)
+		if err != nil {
+
+			return "", fmt.Errorf("-%s-file: %v", s.name, err)
+		}
+
+		return value, nil
+	}
+
+	return "", fmt.Errorf("-%s-file or -%s-env is required", s.name, s.name)
+}
+
+// readSecretFile reads a secret from the file at path, or its first line from stdin when
+// path is "-". The trailing line break is dropped.
+func (a *app) readSecretFile(path string) (string, error) {
+
+	var value string
+
+	if path == "-" {
+
+		line, err := a.stdin.ReadString('\n')
+		if err != nil && len(line) == 0 {
+
+			return "", fmt.Errorf("reading stdin: %v", err)
+		}
+
+		value = line
+	} else {
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+
+			return "", err
+		}
+
+		value = string(data)
+	}
+
+	value = strings.TrimRight(value, "\r\n")
+	if len(value) == 0 {
+
+		return "", fmt.Errorf("empty secret")
+	}
+
+	return value, nil
+}
+
+// accountIDs returns the account ID codec of -account-format.
+func (a *app) accountIDs() (wallet.AccountIDCodec, error) {
+
+	format, err := wallet.ParseAccountIDFormat(a.accountFormat)
+	if err != nil {
+
+		return wallet.AccountIDCodec{}, err
+	}
+
+	return wallet.AccountIDCodec{Format: format, Delimiter: os.Getenv("ACCOUNT_ID_DELIMITER")}, nil
+}
+
+// clients returns the client registry, opening the database on first use.
+func (a *app) clients() (*wallet.ClientRegistry, error) {
+
+	if a.registry != nil {
+
+		return a.registry, nil
+	}
+
+	if len(a.dsn) == 0 {
+
+		return nil, fmt.Errorf("no database configured, set -dsn or WALLET_DB_DSN")
+	}
+
+	db, err := sql.Open(a.driver, a.dsn)
+	if err != nil {
+
+		if len(sql.Drivers()) == 0 {
+
+			return nil, fmt.Errorf("%v: walletctl was built without SQL drivers", err)
+		}
+
+		return nil, fmt.Errorf("%v, linked drivers: %s", err, strings.Join(sql.Drivers(), ", "))
+	}
+
+	a.db = db
+
+	name := a.dialect
+	if len(name) == 0 {
+
+		name = a.driver
+	}
+
+	dialect, err := wallet.ParseDialect(name)
+	if err != nil {
+
+		return nil, err
+	}
+
+	redisConn, err := a.redisClient(false)
+	if err != nil {
+
+		return nil, err
+	}
+
+	tr := otel.Tracer("walletctl")
+
+	a.registry, err = wallet.NewClientRegistry(wallet.NewClientStore(tr, db, dialect), redisConn, wallet.DefaultKeySpace())
+	if err != nil {
+
+		return nil, err
+	}
+
+	if len(os.Getenv("CLIENT_SECRET_KEYS")) > 0 {
+
+		keys, err := wallet.NewEnvKeyProvider()
+		if err != nil {
+
+			return nil, err
+		}
+
+		a.registry.Cipher = &wallet.SecretCipher{Keys: keys}
+	}
+
+	return a.registry, nil
+}
+
+// redisClient returns the Redis connection, or nil when none is configured and it is
+// not required.
+func (a *app) redisClient(require bool) (redis.UniversalClient, error) {
+
+	if a.redis != nil {
+
+		return a.redis, nil
+	}
+
+	if len(a.redisURL) == 0 {
+
+		if require {
+
+			return nil, fmt.Errorf("no redis configured, set -redis-url or REDIS_URL")
+		}
+
+		return nil, nil
+	}
+
+	if a.redisCluster {
+
+		opts, err := redis.ParseClusterURL(a.redisURL)
+		if err != nil {
+
+			return nil, err
+		}
+
+		a.redis = redis.NewUniversalClient(&redis.UniversalOptions{
+			Addrs:         opts.Addrs,
+			Username:      opts.Username,
+			Password:      opts.Password,
+			TLSConfig:     opts.TLSConfig,
+			IsClusterMode: true,
+		})
+		return a.redis, nil
+	}
+
+	opts, err := redis.ParseURL(a.redisURL)
+	if err != nil {
+
+		return nil, err
+	}
+
+	a.redis = redis.NewUniversalClient(&redis.UniversalOptions{
+		Addrs:     []string{opts.Addr},
+		Username:  opts.Username,
+		Password:  opts.Password,
+		DB:        opts.DB,
+		TLSConfig: opts.TLSConfig,
+	})
+	return a.redis, nil
+}
+
+// sessions returns the session store of the configured token mode.
+func (a *app) sessions() (*wallet.SessionStore, error) {
+
+	codec, err := a.accountIDs()
+	if err != nil {
+
+		return nil, err
+	}
+
+	var store *wallet.SessionStore
+
+	switch a.tokenMode {
+
+	case "redis":
+		redisConn, err := a.redisClient(true)
+		if err != nil {
+
+			return nil, err
+		}
+
+		store, err = wallet.NewSessionStore(wallet.TokenModeRedis, redisConn, wallet.DefaultKeySpace(), nil)
+		if err != nil {
+
+			return nil, err
+		}
+
+	case "signed":
+		key, err := a.signingKey()
+		if err != nil {
+
+			return nil, err
+		}
+
+		signer, err := wallet.NewTokenSigner(wallet.SigningKey{
+			ID:        a.signingKeyID,
+			Algorithm: wallet.SigningAlgorithmHMAC,
+			Secret:    []byte(key),
+		})
+		if err != nil {
+
+			return nil, err
+		}
+
+		redisConn, err := a.redisClient(false)
+		if err != nil {
+
+			return nil, err
+		}
+
+		store, err = wallet.NewSessionStore(wallet.TokenModeSigned, redisConn, wallet.DefaultKeySpace(), signer)
+		if err != nil {
+
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported token mode %q", a.tokenMode)
+	}
+
+	store.AccountIDs = codec
+	return store, nil
+}
+
+// signingKey returns the HMAC key of signed tokens, from -signing-key-file or else from
+// WALLET_SIGNING_KEY.
+func (a *app) signingKey() (string, error) {
+
+	if len(a.signingKeyID) == 0 {
+
+		return "", fmt.Errorf("signed tokens require -signing-key-id")
+	}
+
+	if len(a.signingKeyFile) > 0 {
+
+		key, err := a.readSecretFile(a.signingKeyFile)
+		if err != nil {
+
+			return "", fmt.Errorf("-signing-key-file: %v", err)
+		}
+
+		return key, nil
+	}
+
+	key := os.Getenv("WALLET_SIGNING_KEY")
+	if len(key) == 0 {
+
+		return "", fmt.Errorf("signed tokens require -signing-key-file or WALLET_SIGNING_KEY")
+	}
+
+	return key, nil
+}
+
+// wallet returns a wallet for the configured provider, recording to -audit-file when set.
+func (a *app) wallet() (*wallet.Wallet, error) {
+
+	w, err := wallet.NewWallet(otel.Tracer("walletctl"), wallet.ProviderIdentity{ID: a.providerID, Name: a.providerName})
+	if err != nil {
+
+		return nil, err
+	}
+
+	w.AccountIDs, err = a.accountIDs()
+	if err != nil {
+
+		return nil, err
+	}
+
+	if len(a.auditFile) > 0 {
+
+		options, err := a.auditOptions()
+		if err != nil {
+
+			return nil, err
+		}
+
+		a.audit, err = wallet.OpenFileAuditSinkWithOptions(a.ctx, a.auditFile, options)
+		if err != nil {
+
+			return nil, err
+		}
+
+		w.Audit = a.audit
+	}
+
+	return w, nil
+}
+
+// auditOptions returns the HMAC key of the audit journal from WALLET_AUDIT_KEY and its
+// Redis anchor when -audit-anchor is set.
+func (a *app) auditOptions() (wallet.AuditFileOptions, error) {
+
+	options := wallet.AuditFileOptions{Key: []byte(os.Getenv("WALLET_AUDIT_KEY"))}
+
+	if len(a.auditAnchor) > 0 {
+
+		redisConn, err := a.redisClient(true)
+		if err != nil {
+
+			return options, err
+		}
+
+		options.Anchor = &wallet.RedisAuditAnchor{Redis: redisConn, KeySpace: wallet.DefaultKeySpace(), Name: a.auditAnchor}
+	}
+
+	return options, nil
+}
+
+func (a *app) close() {
+
+	if a.audit != nil {
+
+		_ = a.audit.Close()
+	}
+
+	if a.db != nil {
+
+		_ = a.db.Close()
+	}
+
+	if a.redis != nil {
+
+		_ = a.redis.Close()
+	}
+}
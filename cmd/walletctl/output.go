@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// output prints command results as an aligned table or as indented JSON.
+type output struct {
+	json bool
+	w    io.Writer
+}
+
+func newOutput(format string, w io.Writer) (*output, error) {
+
+	switch format {
+
+	case "table":
+		return &output{w: w}, nil
+
+	case "json":
+		return &output{json: true, w: w}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported output format %q, use table or json", format)
+}
+
+// table prints rows under header, or v as JSON.
+func (o *output) table(v interface{}, header []string, rows [][]string) error {
+
+	if o.json {
+
+		return o.encode(v)
+	}
+
+	tw := tabwriter.NewWriter(o.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for _, row := range rows {
+
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+// fields prints one record as name/value lines, or v as JSON.
+func (o *output) fields(v interface{}, names []string, values []string) error {
+
+	if o.json {
+
+		return o.encode(v)
+	}
+
+	tw := tabwriter.NewWriter(o.w, 0, 4, 2, ' ', 0)
+
+	for i, name := range names {
+
+		fmt.Fprintf(tw, "%s:\t%s\n", name, values[i])
+	}
+
+	return tw.Flush()
+}
+
+func (o *output) encode(v interface{}) error {
+
+	encoder := json.NewEncoder(o.w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func formatInt(v int64) string {
+
+	return strconv.FormatInt(v, 10)
+}
+
+func formatAmount(v float64) string {
+
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func formatBalance(v *float64) string {
+
+	if v == nil {
+
+		return "-"
+	}
+
+	return formatAmount(*v)
+}
+
+func formatTime(t time.Time) string {
+
+	if t.IsZero() {
+
+		return "-"
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
+
+// mask hides a secret, keeping its last four characters of long secrets to tell keys apart.
+func mask(secret string) string {
+
+	if len(secret) == 0 {
+
+		return ""
+	}
+
+	if len(secret) <= 8 {
+
+		return "****"
+	}
+
+	return "****" + secret[len(secret)-4:]
+}
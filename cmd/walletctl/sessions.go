@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	wallet "github.com/touchvas/casino-wallet"
+)
+
+var sessionCommands = []command{
+	{"issue", "issue a session token for a player", sessionIssue},
+	{"inspect", "validate a session token and show its claims", sessionInspect},
+	{"revoke", "end the session of a token", sessionRevoke},
+}
+
+type sessionView struct {
+	Token     string    `json:"token,omitempty"`
+	PlayerID  string    `json:"player_id"`
+	ClientID  int64     `json:"client_id"`
+	GameID    string    `json:"game_id,omitempty"`
+	SessionID string    `json:"session_id"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func newSessionView(token string, claims *wallet.SessionClaims) sessionView {
+
+	view := sessionView{
+		Token:     token,
+		PlayerID:  claims.PlayerID,
+		ClientID:  claims.ClientID,
+		GameID:    claims.GameID,
+		SessionID: claims.SessionID,
+	}
+
+	if claims.IssuedAt > 0 {
+
+		view.IssuedAt = time.Unix(claims.IssuedAt, 0).UTC()
+	}
+
+	if claims.ExpiresAt > 0 {
+
+		view.ExpiresAt = time.Unix(claims.ExpiresAt, 0).UTC()
+	}
+
+	return view
+}
+
+func (a *app) printSession(view sessionView) error {
+
+	names := []string{"Player", "Client", "Game", "Session", "Issued", "Expires"}
+	values := []string{view.PlayerID, formatInt(view.ClientID), view.GameID, view.SessionID, formatTime(view.IssuedAt), formatTime(view.ExpiresAt)}
+
+	if len(view.Token) > 0 {
+
+		names = append([]string{"Token"}, names...)
+		values = append([]string{view.Token}, values...)
+	}
+
+	return a.out.fields(view, names, values)
+}
+
+func sessionIssue(a *app, args []string) error {
+
+	fs := newFlagSet("session", "issue")
+	player := fs.String("player", "", "player ID")
+	client := fs.Int64("client", 0, "client ID")
+	game := fs.String("game", "", "game ID")
+
+	err := fs.Parse(args)
+	if err != nil {
+
+		return err
+	}
+
+	err = required(fs, "player", "client")
+	if err != nil {
+
+		return err
+	}
+
+	store, err := a.sessions()
+	if err != nil {
+
+		return err
+	}
+
+	err = a.ask("issuing a session for player %s of client %d", *player, *client)
+	if err != nil {
+
+		return err
+	}
+
+	token, err := store.Issue(a.ctx, wallet.SessionClaims{PlayerID: *player, ClientID: *client, GameID: *game})
+	if err != nil {
+
+		return err
+	}
+
+	if len(token) == 0 {
+
+		return fmt.Errorf("no token was issued, check the redis connection")
+	}
+
+	claims, err := store.Validate(a.ctx, token)
+	if err != nil {
+
+		return fmt.Errorf("issued token %s does not validate: %v", token, err)
+	}
+
+	return a.printSession(newSessionView(token, claims))
+}
+
+func sessionInspect(a *app, args []string) error {
+
+	fs := newFlagSet("session", "inspect")
+	token := fs.String("token", "", "session token")
+
+	err := fs.Parse(args)
+	if err != nil {
+
+		return err
+	}
+
+	err = required(fs, "token")
+	if err != nil {
+
+		return err
+	}
+
+	store, err := a.sessions()
+	if err != nil {
+
+		return err
+	}
+
+	claims, err := store.Validate(a.ctx, *token)
+	if err != nil {
+
+		return err
+	}
+
+	return a.printSession(newSessionView("", claims))
+}
+
+func sessionRevoke(a *app, args []string) error {
+
+	fs := newFlagSet("session", "revoke")
+	token := fs.String("token", "", "session token")
+
+	err := fs.Parse(args)
+	if err != nil {
+
+		return err
+	}
+
+	err = required(fs, "token")
+	if err != nil {
+
+		return err
+	}
+
+	store, err := a.sessions()
+	if err != nil {
+
+		return err
+	}
+
+	claims, err := store.Validate(a.ctx, *token)
+	if err != nil {
+
+		return err
+	}
+
+	err = a.ask("revoking session %s of player %s of client %d", claims.SessionID, claims.PlayerID, claims.ClientID)
+	if err != nil {
+
+		return err
+	}
+
+	err = store.Revoke(a.ctx, *token)
+	if err != nil {
+
+		return err
+	}
+
+	return a.out.fields(map[string]string{"revoked": claims.SessionID}, []string{"Revoked"}, []string{claims.SessionID})
+}
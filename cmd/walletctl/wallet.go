@@ -0,0 +1,395 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+
+	"github.com/google/uuid"
+	wallet "github.com/touchvas/casino-wallet"
+)
+
+var walletCommands = []command{
+	{"profile", "look up the wallet profile of a player", walletProfile},
+	{"debit", "debit a player", walletDebit},
+	{"credit", "credit a player against a debit", walletCredit},
+	{"rollback", "roll back a debit", walletRollback},
+	{"settle", "settle the round of a debit", walletSettle},
+}
+
+// walletTarget is the operator and player of a wallet command.
+type walletTarget struct {
+	client *int64
+	player *string
+}
+
+func targetFlags(fs *flag.FlagSet) walletTarget {
+
+	return walletTarget{
+		client: fs.Int64("client", 0, "client ID"),
+		player: fs.String("player", "", "player ID"),
+	}
+}
+
+// resolve loads the operator of t and a wallet to call it with. Fallback credentials the
+// operator accepts are recorded in the registry, as the services do.
+func (a *app) resolve(t walletTarget) (*wallet.Wallet, wallet.Client, error) {
+
+	registry, err := a.clients()
+	if err != nil {
+
+		return nil, wallet.Client{}, err
+	}
+
+	client, err := registry.Get(a.ctx, *t.client)
+	if err != nil {
+
+		return nil, wallet.Client{}, err
+	}
+
+	w, err := a.wallet()
+	if err != nil {
+
+		return nil, wallet.Client{}, err
+	}
+
+	w.Credentials = registry
+	return w, client, nil
+}
+
+// transactionID returns id, or a new walletctl transaction ID when it is empty.
+func transactionID(id string) string {
+
+	if len(id) > 0 {
+
+		return id
+	}
+
+	return "walletctl-" + uuid.New().String()
+}
+
+type transactionView struct {
+	Operation     string  `json:"operation"`
+	ClientID      int64   `json:"client_id"`
+	PlayerID      string  `json:"player_id"`
+	TransactionID string  `json:"transaction_id"`
+	Amount        float64 `json:"amount"`
+	Status        int64   `json:"status"`
+	Description   string  `json:"description"`
+	Balance       float64 `json:"balance"`
+	Currency      string  `json:"currency,omitempty"`
+}
+
+func (a *app) printTransaction(view transactionView) error {
+
+	return a.out.fields(view,
+		[]string{"Operation", "Client", "Player", "Transaction", "Amount", "Status", "Description", "Balance", "Currency"},
+		[]string{view.Operation, formatInt(view.ClientID), view.PlayerID, view.TransactionID, formatAmount(view.Amount), formatInt(view.Status), view.Description, formatAmount(view.Balance), view.Currency})
+}
+
+func walletProfile(a *app, args []string) error {
+
+	fs := newFlagSet("wallet", "profile")
+	target := targetFlags(fs)
+
+	err := fs.Parse(args)
+	if err != nil {
+
+		return err
+	}
+
+	err = required(fs, "client", "player")
+	if err != nil {
+
+		return err
+	}
+
+	w, client, err := a.resolve(target)
+	if err != nil {
+
+		return err
+	}
+
+	prof, err := w.GetWalletProfile(a.ctx, client, *target.player)
+	if err != nil {
+
+		return err
+	}
+
+	return a.out.fields(prof,
+		[]string{"Player", "Name", "Balance", "Bonus", "Currency", "Language"},
+		[]string{prof.ID, prof.DisplayName, formatAmount(prof.Balance), formatAmount(prof.Bonus), prof.Currency, prof.Language})
+}
+
+func walletDebit(a *app, args []string) error {
+
+	fs := newFlagSet("wallet", "debit")
+	target := targetFlags(fs)
+	amount := fs.Float64("amount", 0, "amount")
+	txn := fs.String("txn", "", "transaction ID, generated when empty")
+	gameID := fs.String("game-id", "walletctl", "game ID")
+	gameName := fs.String("game-name", "walletctl", "game name")
+	sessionID := fs.String("session", "", "session ID")
+	roundID := fs.String("round", "", "round ID")
+
+	err := fs.Parse(args)
+	if err != nil {
+
+		return err
+	}
+
+	err = required(fs, "client", "player", "amount")
+	if err != nil {
+
+		return err
+	}
+
+	err = checkAmount(*amount)
+	if err != nil {
+
+		return err
+	}
+
+	debit := wallet.Debit{
+		PlayerID:      *target.player,
+		GameName:      *gameName,
+		GameID:        *gameID,
+		TransactionID: transactionID(*txn),
+		Amount:        *amount,
+		SessionID:     *sessionID,
+		RoundID:       *roundID,
+	}
+
+	w, client, err := a.resolve(target)
+	if err != nil {
+
+		return err
+	}
+
+	err = a.ask("debiting %v from player %s of client %d, transaction %s", debit.Amount, debit.PlayerID, client.ID, debit.TransactionID)
+	if err != nil {
+
+		return err
+	}
+
+	resp, err := w.DebitWalletProfile(a.ctx, client, debit)
+	if err != nil {
+
+		return fmt.Errorf("debit %s: %v", debit.TransactionID, err)
+	}
+
+	return a.printTransaction(transactionView{
+		Operation:     wallet.OperationDebit,
+		ClientID:      client.ID,
+		PlayerID:      debit.PlayerID,
+		TransactionID: debit.TransactionID,
+		Amount:        debit.Amount,
+		Status:        resp.Status,
+		Description:   resp.Description,
+		Balance:       resp.Balance,
+		Currency:      resp.Currency,
+	})
+}
+
+func walletCredit(a *app, args []string) error {
+
+	fs := newFlagSet("wallet", "credit")
+	target := targetFlags(fs)
+	amount := fs.Float64("amount", 0, "amount")
+	txn := fs.String("txn", "", "transaction ID, generated when empty")
+	debitTxn := fs.String("debit-txn", "", "transaction ID of the debit being credited")
+	gameID := fs.String("game-id", "walletctl", "game ID")
+	gameName := fs.String("game-name", "walletctl", "game name")
+	sessionID := fs.String("session", "", "session ID")
+	roundID := fs.String("round", "", "round ID")
+
+	err := fs.Parse(args)
+	if err != nil {
+
+		return err
+	}
+
+	err = required(fs, "client", "player", "amount", "debit-txn")
+	if err != nil {
+
+		return err
+	}
+
+	err = checkAmount(*amount)
+	if err != nil {
+
+		return err
+	}
+
+	credit := wallet.Credit{
+		PlayerID:           *target.player,
+		GameName:           *gameName,
+		GameID:             *gameID,
+		TransactionID:      transactionID(*txn),
+		DebitTransactionID: *debitTxn,
+		Amount:             *amount,
+		SessionID:          *sessionID,
+		RoundID:            *roundID,
+	}
+
+	w, client, err := a.resolve(target)
+	if err != nil {
+
+		return err
+	}
+
+	err = a.ask("crediting %v to player %s of client %d for debit %s, transaction %s", credit.Amount, credit.PlayerID, client.ID, credit.DebitTransactionID, credit.TransactionID)
+	if err != nil {
+
+		return err
+	}
+
+	resp, err := w.CreditWalletProfile(a.ctx, client, credit)
+	if err != nil {
+
+		return fmt.Errorf("credit %s: %v", credit.TransactionID, err)
+	}
+
+	return a.printTransaction(transactionView{
+		Operation:     wallet.OperationCredit,
+		ClientID:      client.ID,
+		PlayerID:      credit.PlayerID,
+		TransactionID: credit.TransactionID,
+		Amount:        credit.Amount,
+		Status:        resp.Status,
+		Description:   resp.Description,
+		Balance:       resp.Balance,
+		Currency:      resp.Currency,
+	})
+}
+
+func walletRollback(a *app, args []string) error {
+
+	fs := newFlagSet("wallet", "rollback")
+	target := targetFlags(fs)
+	amount := fs.Float64("amount", 0, "amount of the debit")
+	txn := fs.String("txn", "", "transaction ID, generated when empty")
+	debitTxn := fs.String("debit-txn", "", "transaction ID of the debit to roll back")
+	sessionID := fs.String("session", "", "session ID")
+	roundID := fs.String("round", "", "round ID")
+
+	err := fs.Parse(args)
+	if err != nil {
+
+		return err
+	}
+
+	err = required(fs, "client", "player", "amount", "debit-txn")
+	if err != nil {
+
+		return err
+	}
+
+	err = checkAmount(*amount)
+	if err != nil {
+
+		return err
+	}
+
+	rollback := wallet.Rollback{
+		PlayerID:           *target.player,
+		TransactionID:      transactionID(*txn),
+		Amount:             *amount,
+		SessionID:          *sessionID,
+		RoundID:            *roundID,
+		DebitTransactionID: *debitTxn,
+	}
+
+	w, client, err := a.resolve(target)
+	if err != nil {
+
+		return err
+	}
+
+	err = a.ask("rolling back debit %s of %v for player %s of client %d, transaction %s", rollback.DebitTransactionID, rollback.Amount, rollback.PlayerID, client.ID, rollback.TransactionID)
+	if err != nil {
+
+		return err
+	}
+
+	resp, err := w.BetRollback(a.ctx, client, rollback)
+	if err != nil {
+
+		return fmt.Errorf("rollback %s: %v", rollback.TransactionID, err)
+	}
+
+	return a.printTransaction(transactionView{
+		Operation:     wallet.OperationRollback,
+		ClientID:      client.ID,
+		PlayerID:      rollback.PlayerID,
+		TransactionID: rollback.TransactionID,
+		Amount:        rollback.Amount,
+		Status:        resp.Status,
+		Description:   resp.Description,
+		Balance:       resp.Balance,
+		Currency:      resp.Currency,
+	})
+}
+
+func walletSettle(a *app, args []string) error {
+
+	fs := newFlagSet("wallet", "settle")
+	target := targetFlags(fs)
+	debitTxn := fs.String("debit-txn", "", "transaction ID of the debit of the round")
+	status := fs.Int64("status", 1, "settlement status sent to the operator")
+	sessionID := fs.String("session", "", "session ID")
+	roundID := fs.String("round", "", "round ID")
+
+	err := fs.Parse(args)
+	if err != nil {
+
+		return err
+	}
+
+	err = required(fs, "client", "player", "debit-txn")
+	if err != nil {
+
+		return err
+	}
+
+	settlement := wallet.Settlement{
+		PlayerID:           *target.player,
+		Status:             *status,
+		SessionID:          *sessionID,
+		RoundID:            *roundID,
+		DebitTransactionID: *debitTxn,
+	}
+
+	w, client, err := a.resolve(target)
+	if err != nil {
+
+		return err
+	}
+
+	err = a.ask("settling debit %s of player %s of client %d with status %d", settlement.DebitTransactionID, settlement.PlayerID, client.ID, settlement.Status)
+	if err != nil {
+
+		return err
+	}
+
+	err = w.BetSettlement(a.ctx, client, settlement)
+	if err != nil {
+
+		return fmt.Errorf("settlement of %s: %v", settlement.DebitTransactionID, err)
+	}
+
+	return a.out.fields(settlement,
+		[]string{"Settled", "Client", "Player", "Status"},
+		[]string{settlement.DebitTransactionID, formatInt(client.ID), settlement.PlayerID, formatInt(settlement.Status)})
+}
+
+// checkAmount rejects amounts that are not a positive number.
+func checkAmount(amount float64) error {
+
+	if math.IsNaN(amount) || math.IsInf(amount, 0) || amount <= 0 {
+
+		return fmt.Errorf("-amount must be a positive number, got %v", amount)
+	}
+
+	return nil
+}
@@ -0,0 +1,534 @@
+package conformance
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	wallet "github.com/touchvas/casino-wallet"
+)
+
+const balanceTolerance = 1e-6
+
+const (
+	concurrentDebitAttempts   = 5
+	concurrentDebitRetryDelay = 200 * time.Millisecond
+)
+
+type check struct {
+	name string
+	run  func(s *session) error
+}
+
+// checks is the battery, in the order it runs. Later checks rely on the balance left by
+// earlier ones only through fresh profile lookups.
+var checks = []check{
+	{"balance", checkBalance},
+	{"debit", checkDebit},
+	{"duplicate_debit", checkDuplicateDebit},
+	{"credit", checkCredit},
+	{"duplicate_credit", checkDuplicateCredit},
+	{"rollback_after_credit", checkRollbackAfterCredit},
+	{"credit_without_debit", checkCreditWithoutDebit},
+	{"rollback", checkRollback},
+	{"rollback_unknown", checkRollbackUnknown},
+	{"insufficient_funds", checkInsufficientFunds},
+	{"concurrent_debits", checkConcurrentDebits},
+	{"settlement", checkSettlement},
+}
+
+// session carries the state shared by the checks of a run.
+type session struct {
+	runner *Runner
+	wallet *wallet.Wallet
+	ctx    context.Context
+
+	// debit is the last accepted debit, credited by checkCredit and settled by
+	// checkSettlement.
+	debit wallet.Debit
+	// credit is the credit of debit accepted by checkCredit.
+	credit wallet.Credit
+}
+
+func (s *session) balance() (float64, error) {
+
+	prof, err := s.wallet.GetWalletProfile(s.ctx, s.runner.Client, s.runner.PlayerID)
+	if err != nil {
+
+		return 0, fmt.Errorf("profile lookup failed: %v", err)
+	}
+
+	return prof.Balance, nil
+}
+
+func (s *session) newDebit(amount float64) wallet.Debit {
+
+	return wallet.Debit{
+		PlayerID:      s.runner.PlayerID,
+		GameName:      "conformance",
+		GameID:        "conformance",
+		TransactionID: s.runner.nextID("debit"),
+		Amount:        amount,
+		SessionID:     s.runner.nextID("session"),
+		RoundID:       s.runner.nextID("round"),
+	}
+}
+
+func (s *session) expectBalance(want float64) error {
+
+	got, err := s.balance()
+	if err != nil {
+
+		return err
+	}
+
+	if math.Abs(got-want) > balanceTolerance {
+
+		return fmt.Errorf("expected balance %v, got %v", want, got)
+	}
+
+	return nil
+}
+
+func accepted(status int64, err error) error {
+
+	if err != nil {
+
+		return fmt.Errorf("expected the operator to accept, got error: %v", err)
+	}
+
+	if status != 1 {
+
+		return fmt.Errorf("expected the operator to accept, got status %d", status)
+	}
+
+	return nil
+}
+
+func rejected(status int64, err error) error {
+
+	if err == nil && status == 1 {
+
+		return fmt.Errorf("expected the operator to reject, but it accepted")
+	}
+
+	return nil
+}
+
+func checkBalance(s *session) error {
+
+	prof, err := s.wallet.GetWalletProfile(s.ctx, s.runner.Client, s.runner.PlayerID)
+	if err != nil {
+
+		return fmt.Errorf("profile lookup failed: %v", err)
+	}
+
+	if prof.Balance < 10*s.runner.amount() {
+
+		return fmt.Errorf("test player balance %v is below %v, the battery needs more", prof.Balance, 10*s.runner.amount())
+	}
+
+	if len(prof.Currency) == 0 {
+
+		return fmt.Errorf("profile has no currency")
+	}
+
+	return nil
+}
+
+func checkDebit(s *session) error {
+
+	before, err := s.balance()
+	if err != nil {
+
+		return err
+	}
+
+	debit := s.newDebit(s.runner.amount())
+
+	resp, err := s.wallet.DebitWalletProfile(s.ctx, s.runner.Client, debit)
+	if err := accepted(status(resp), err); err != nil {
+
+		return err
+	}
+
+	s.debit = debit
+
+	if math.Abs(resp.Balance-(before-debit.Amount)) > balanceTolerance {
+
+		return fmt.Errorf("debit response balance %v, expected %v", resp.Balance, before-debit.Amount)
+	}
+
+	return s.expectBalance(before - debit.Amount)
+}
+
+// checkDuplicateDebit repeats the debit. The operator must not debit the player again and
+// may answer 409 or replay its answer to the original debit.
+func checkDuplicateDebit(s *session) error {
+
+	if len(s.debit.TransactionID) == 0 {
+
+		return fmt.Errorf("skipped, the debit check failed")
+	}
+
+	before, err := s.balance()
+	if err != nil {
+
+		return err
+	}
+
+	resp, err := s.wallet.DebitWalletProfile(s.ctx, s.runner.Client, s.debit)
+	if err != nil {
+
+		return fmt.Errorf("expected 409 or the original answer, got error: %v", err)
+	}
+
+	if resp.Status != http.StatusConflict && resp.Status != 1 {
+
+		return fmt.Errorf("expected 409 or the original answer, got status %d", resp.Status)
+	}
+
+	return s.expectBalance(before)
+}
+
+func checkCredit(s *session) error {
+
+	if len(s.debit.TransactionID) == 0 {
+
+		return fmt.Errorf("skipped, the debit check failed")
+	}
+
+	before, err := s.balance()
+	if err != nil {
+
+		return err
+	}
+
+	credit := wallet.Credit{
+		PlayerID:           s.runner.PlayerID,
+		GameName:           s.debit.GameName,
+		GameID:             s.debit.GameID,
+		TransactionID:      s.runner.nextID("credit"),
+		DebitTransactionID: s.debit.TransactionID,
+		Amount:             2 * s.debit.Amount,
+		SessionID:          s.debit.SessionID,
+		RoundID:            s.debit.RoundID,
+	}
+
+	resp, err := s.wallet.CreditWalletProfile(s.ctx, s.runner.Client, credit)
+	if err := accepted(status(resp), err); err != nil {
+
+		return err
+	}
+
+	s.credit = credit
+
+	return s.expectBalance(before + credit.Amount)
+}
+
+// checkDuplicateCredit repeats the credit. The operator must not pay the player again and
+// may answer 409 or replay its answer to the original credit.
+func checkDuplicateCredit(s *session) error {
+
+	if len(s.credit.TransactionID) == 0 {
+
+		return fmt.Errorf("skipped, the credit check failed")
+	}
+
+	before, err := s.balance()
+	if err != nil {
+
+		return err
+	}
+
+	resp, err := s.wallet.CreditWalletProfile(s.ctx, s.runner.Client, s.credit)
+	if err != nil {
+
+		return fmt.Errorf("expected 409 or the original answer, got error: %v", err)
+	}
+
+	if resp.Status != http.StatusConflict && resp.Status != 1 {
+
+		return fmt.Errorf("expected 409 or the original answer, got status %d", resp.Status)
+	}
+
+	return s.expectBalance(before)
+}
+
+// checkRollbackAfterCredit rolls back the credited debit, which must be rejected: refunding
+// a stake that was already paid out pays the round twice.
+func checkRollbackAfterCredit(s *session) error {
+
+	if len(s.credit.TransactionID) == 0 {
+
+		return fmt.Errorf("skipped, the credit check failed")
+	}
+
+	before, err := s.balance()
+	if err != nil {
+
+		return err
+	}
+
+	rollback := wallet.Rollback{
+		PlayerID:           s.runner.PlayerID,
+		TransactionID:      s.runner.nextID("rollback"),
+		DebitTransactionID: s.debit.TransactionID,
+		Amount:             s.debit.Amount,
+		SessionID:          s.debit.SessionID,
+		RoundID:            s.debit.RoundID,
+	}
+
+	rb, err := s.wallet.BetRollback(s.ctx, s.runner.Client, rollback)
+	if err := rejected(status(rb), err); err != nil {
+
+		return err
+	}
+
+	return s.expectBalance(before)
+}
+
+func checkCreditWithoutDebit(s *session) error {
+
+	before, err := s.balance()
+	if err != nil {
+
+		return err
+	}
+
+	credit := wallet.Credit{
+		PlayerID:           s.runner.PlayerID,
+		GameName:           "conformance",
+		GameID:             "conformance",
+		TransactionID:      s.runner.nextID("credit"),
+		DebitTransactionID: s.runner.nextID("missing-debit"),
+		Amount:             s.runner.amount(),
+		SessionID:          s.runner.nextID("session"),
+		RoundID:            s.runner.nextID("round"),
+	}
+
+	resp, err := s.wallet.CreditWalletProfile(s.ctx, s.runner.Client, credit)
+	if err := rejected(status(resp), err); err != nil {
+
+		return err
+	}
+
+	return s.expectBalance(before)
+}
+
+func checkRollback(s *session) error {
+
+	before, err := s.balance()
+	if err != nil {
+
+		return err
+	}
+
+	debit := s.newDebit(s.runner.amount())
+
+	resp, err := s.wallet.DebitWalletProfile(s.ctx, s.runner.Client, debit)
+	if err := accepted(status(resp), err); err != nil {
+
+		return fmt.Errorf("debit to roll back: %v", err)
+	}
+
+	rollback := wallet.Rollback{
+		PlayerID:           s.runner.PlayerID,
+		TransactionID:      s.runner.nextID("rollback"),
+		DebitTransactionID: debit.TransactionID,
+		Amount:             debit.Amount,
+		SessionID:          debit.SessionID,
+		RoundID:            debit.RoundID,
+	}
+
+	rb, err := s.wallet.BetRollback(s.ctx, s.runner.Client, rollback)
+	if err := accepted(status(rb), err); err != nil {
+
+		return err
+	}
+
+	return s.expectBalance(before)
+}
+
+func checkRollbackUnknown(s *session) error {
+
+	before, err := s.balance()
+	if err != nil {
+
+		return err
+	}
+
+	rollback := wallet.Rollback{
+		PlayerID:           s.runner.PlayerID,
+		TransactionID:      s.runner.nextID("rollback"),
+		DebitTransactionID: s.runner.nextID("missing-debit"),
+		Amount:             s.runner.amount(),
+		SessionID:          s.runner.nextID("session"),
+		RoundID:            s.runner.nextID("round"),
+	}
+
+	rb, err := s.wallet.BetRollback(s.ctx, s.runner.Client, rollback)
+	if err := rejected(status(rb), err); err != nil {
+
+		return err
+	}
+
+	return s.expectBalance(before)
+}
+
+func checkInsufficientFunds(s *session) error {
+
+	before, err := s.balance()
+	if err != nil {
+
+		return err
+	}
+
+	resp, err := s.wallet.DebitWalletProfile(s.ctx, s.runner.Client, s.newDebit(before+1000*s.runner.amount()))
+	if err != nil {
+
+		return fmt.Errorf("expected 402, got error: %v", err)
+	}
+
+	if resp.Status != http.StatusPaymentRequired {
+
+		return fmt.Errorf("expected 402, got status %d", resp.Status)
+	}
+
+	return s.expectBalance(before)
+}
+
+// checkConcurrentDebits sends the same debit several times at once. The player must be
+// debited once; the duplicates are answered 409 or with the answer to the debit that went
+// through. A duplicate that fails while that debit is still in flight is retried. The
+// debit is rolled back afterwards.
+func checkConcurrentDebits(s *session) error {
+
+	before, err := s.balance()
+	if err != nil {
+
+		return err
+	}
+
+	debit := s.newDebit(s.runner.amount())
+	n := s.runner.concurrency()
+
+	statuses := make([]int64, n)
+	errs := make([]error, n)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+
+		wg.Add(1)
+		go func(i int) {
+
+			defer wg.Done()
+
+			for attempt := 0; attempt < concurrentDebitAttempts; attempt++ {
+
+				if attempt > 0 {
+
+					time.Sleep(concurrentDebitRetryDelay)
+				}
+
+				resp, err := s.wallet.DebitWalletProfile(s.ctx, s.runner.Client, debit)
+				statuses[i], errs[i] = status(resp), err
+				if err == nil {
+
+					return
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	var ok, conflicts int
+	for i := range statuses {
+
+		switch {
+
+		case errs[i] != nil:
+			return fmt.Errorf("debit %d of %d failed: %v", i+1, n, errs[i])
+
+		case statuses[i] == 1:
+			ok++
+
+		case statuses[i] == http.StatusConflict:
+			conflicts++
+		}
+	}
+
+	result := s.expectBalance(before - debit.Amount)
+
+	if ok > 0 {
+
+		_, _ = s.wallet.BetRollback(s.ctx, s.runner.Client, wallet.Rollback{
+			PlayerID:           s.runner.PlayerID,
+			TransactionID:      s.runner.nextID("rollback"),
+			DebitTransactionID: debit.TransactionID,
+			Amount:             debit.Amount,
+			SessionID:          debit.SessionID,
+			RoundID:            debit.RoundID,
+		})
+	}
+
+	if ok == 0 || ok+conflicts != n {
+
+		return fmt.Errorf("expected every debit to be accepted once or answered 409, got %d accepted and %d conflicting of %d", ok, conflicts, n)
+	}
+
+	return result
+}
+
+func checkSettlement(s *session) error {
+
+	if len(s.debit.TransactionID) == 0 {
+
+		return fmt.Errorf("skipped, the debit check failed")
+	}
+
+	err := s.wallet.BetSettlement(s.ctx, s.runner.Client, wallet.Settlement{
+		PlayerID:           s.runner.PlayerID,
+		Status:             1,
+		SessionID:          s.debit.SessionID,
+		RoundID:            s.debit.RoundID,
+		DebitTransactionID: s.debit.TransactionID,
+	})
+	if err != nil {
+
+		return fmt.Errorf("settlement failed: %v", err)
+	}
+
+	return nil
+}
+
+// status returns the Status of a transaction response, or zero when there is none.
+func status(resp interface{}) int64 {
+
+	switch r := resp.(type) {
+
+	case *wallet.DebitTransactionResponse:
+		if r != nil {
+
+			return r.Status
+		}
+
+	case *wallet.CreditTransactionResponse:
+		if r != nil {
+
+			return r.Status
+		}
+
+	case *wallet.RollbackTransactionResponse:
+		if r != nil {
+
+			return r.Status
+		}
+	}
+
+	return 0
+}
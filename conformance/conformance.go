@@ -0,0 +1,274 @@
+// Package conformance checks that an operator implements the wallet contract the way the
+// wallet package expects. The runner drives a standard battery of wallet calls against a
+// test player through the library and reports every check with the HTTP exchanges it made.
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	wallet "github.com/touchvas/casino-wallet"
+)
+
+const defaultAmount = 1
+
+// Exchange is an HTTP request sent to the operator and its answer. Authentication headers
+// are redacted.
+type Exchange struct {
+	Method          string            `json:"method"`
+	URL             string            `json:"url"`
+	RequestHeaders  map[string]string `json:"request_headers"`
+	RequestBody     string            `json:"request_body"`
+	Status          int               `json:"status"`
+	ResponseBody    string            `json:"response_body"`
+	Error           string            `json:"error,omitempty"`
+	DurationSeconds float64           `json:"duration_seconds"`
+}
+
+type CheckResult struct {
+	Name            string     `json:"name"`
+	Passed          bool       `json:"passed"`
+	Message         string     `json:"message,omitempty"`
+	DurationSeconds float64    `json:"duration_seconds"`
+	Exchanges       []Exchange `json:"exchanges"`
+}
+
+type Report struct {
+	ClientID   int64         `json:"client_id"`
+	BaseURL    string        `json:"base_url"`
+	PlayerID   string        `json:"player_id"`
+	RunID      string        `json:"run_id"`
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt time.Time     `json:"finished_at"`
+	Checks     []CheckResult `json:"checks"`
+}
+
+// Passed reports whether every check passed.
+func (r Report) Passed() bool {
+
+	for _, c := range r.Checks {
+
+		if !c.Passed {
+
+			return false
+		}
+	}
+
+	return true
+}
+
+// WriteText writes a pass/fail line per check and, for failed checks, their exchanges.
+func (r Report) WriteText(w io.Writer) {
+
+	fmt.Fprintf(w, "operator %d (%s), player %s, run %s\n\n", r.ClientID, r.BaseURL, r.PlayerID, r.RunID)
+
+	var failed int
+
+	for _, c := range r.Checks {
+
+		result := "PASS"
+		if !c.Passed {
+
+			result = "FAIL"
+			failed++
+		}
+
+		fmt.Fprintf(w, "%s  %-24s %6.0fms  %s\n", result, c.Name, c.DurationSeconds*1000, c.Message)
+
+		if c.Passed {
+
+			continue
+		}
+
+		for _, e := range c.Exchanges {
+
+			fmt.Fprintf(w, "      %s %s -> %d %s\n", e.Method, e.URL, e.Status, e.Error)
+			fmt.Fprintf(w, "        request:  %s\n", e.RequestBody)
+			fmt.Fprintf(w, "        response: %s\n", e.ResponseBody)
+		}
+	}
+
+	fmt.Fprintf(w, "\n%d/%d checks passed\n", len(r.Checks)-failed, len(r.Checks))
+}
+
+// Runner runs the battery against Client for PlayerID, who needs a balance of at least a
+// few times Amount. Wallet supplies the provider identity and tracer; its HTTPClient is
+// replaced to capture the exchanges and its ProfileCache is not used.
+type Runner struct {
+	Wallet   *wallet.Wallet
+	Client   wallet.Client
+	PlayerID string
+	Amount   float64
+	// Concurrency is the number of identical debits sent at once by the concurrent
+	// debit check.
+	Concurrency int
+
+	mu       sync.Mutex
+	captured []Exchange
+	runID    string
+	sequence int
+}
+
+// Run runs every check in order and returns the report. The checks move real money on
+// the operator's side, so point it at a test player only.
+func (r *Runner) Run(ctx context.Context) Report {
+
+	w := *r.Wallet
+	w.ProfileCache = nil
+	w.Audit = nil
+	w.HTTPClient = &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &capturingTransport{runner: r, next: wallet.NewNetClient().Transport},
+	}
+
+	r.runID = uuid.New().String()[:8]
+
+	report := Report{
+		ClientID:  r.Client.ID,
+		BaseURL:   r.Client.BaseURL,
+		PlayerID:  r.PlayerID,
+		RunID:     r.runID,
+		StartedAt: time.Now().UTC(),
+	}
+
+	s := &session{runner: r, wallet: &w, ctx: ctx}
+
+	for _, c := range checks {
+
+		r.mu.Lock()
+		r.captured = nil
+		r.mu.Unlock()
+
+		started := time.Now()
+		err := c.run(s)
+
+		r.mu.Lock()
+		result := CheckResult{
+			Name:            c.name,
+			Passed:          err == nil,
+			DurationSeconds: time.Since(started).Seconds(),
+			Exchanges:       r.captured,
+		}
+		r.mu.Unlock()
+
+		if err != nil {
+
+			result.Message = err.Error()
+		}
+
+		report.Checks = append(report.Checks, result)
+	}
+
+	report.FinishedAt = time.Now().UTC()
+	return report
+}
+
+func (r *Runner) amount() float64 {
+
+	if r.Amount > 0 {
+
+		return r.Amount
+	}
+
+	return defaultAmount
+}
+
+func (r *Runner) concurrency() int {
+
+	if r.Concurrency > 1 {
+
+		return r.Concurrency
+	}
+
+	return 5
+}
+
+// nextID returns a transaction or round ID unique to this run.
+func (r *Runner) nextID(kind string) string {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sequence++
+	return fmt.Sprintf("conformance-%s-%s-%d", r.runID, kind, r.sequence)
+}
+
+func (r *Runner) redacted(header http.Header) map[string]string {
+
+	secret := map[string]bool{strings.ToLower(r.Client.AuthenticationHeader): true}
+	for _, c := range r.Client.Credentials {
+
+		secret[strings.ToLower(c.Header)] = true
+	}
+
+	out := make(map[string]string, len(header))
+	for name := range header {
+
+		out[name] = header.Get(name)
+		if secret[strings.ToLower(name)] {
+
+			out[name] = "[REDACTED]"
+		}
+	}
+
+	return out
+}
+
+type capturingTransport struct {
+	runner *Runner
+	next   http.RoundTripper
+}
+
+func (t *capturingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	exchange := Exchange{
+		Method:         req.Method,
+		URL:            req.URL.String(),
+		RequestHeaders: t.runner.redacted(req.Header),
+	}
+
+	if req.Body != nil {
+
+		body, _ := io.ReadAll(req.Body)
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		exchange.RequestBody = string(body)
+	}
+
+	started := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	exchange.DurationSeconds = time.Since(started).Seconds()
+
+	if err != nil {
+
+		exchange.Error = err.Error()
+
+	} else {
+
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		exchange.Status = resp.StatusCode
+		exchange.ResponseBody = string(body)
+	}
+
+	t.runner.mu.Lock()
+	t.runner.captured = append(t.runner.captured, exchange)
+	t.runner.mu.Unlock()
+
+	return resp, err
+}
+
+// MarshalIndent returns the report as indented JSON.
+func (r Report) MarshalIndent() ([]byte, error) {
+
+	return json.MarshalIndent(r, "", "  ")
+}
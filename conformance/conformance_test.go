@@ -0,0 +1,55 @@
+package conformance
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	wallet "github.com/touchvas/casino-wallet"
+	"github.com/touchvas/casino-wallet/simulator"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestRunnerAgainstSimulator(t *testing.T) {
+
+	// Like the CLI, the runner must work with the default codec and no ACCOUNT_PREFIX.
+	t.Setenv("ACCOUNT_PREFIX", "")
+
+	sim := simulator.New("X-Api-Key", "secret")
+	sim.SetPlayer("player-1", 100)
+
+	server := sim.Start()
+	defer server.Close()
+
+	w, err := wallet.NewWallet(noop.NewTracerProvider().Tracer("test"), wallet.ProviderIdentity{ID: 1, Name: "test"})
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	runner := &Runner{
+		Wallet: w,
+		Client: wallet.Client{
+			ID:                   101,
+			BaseURL:              server.URL,
+			AuthenticationHeader: "X-Api-Key",
+			AuthenticationString: "secret",
+		},
+		PlayerID: "player-1",
+		Amount:   1,
+	}
+
+	report := runner.Run(context.Background())
+
+	if !report.Passed() {
+
+		var out strings.Builder
+		report.WriteText(&out)
+		t.Fatalf("the simulator fails the battery:\n%s", out.String())
+	}
+
+	if len(report.Checks) != len(checks) {
+
+		t.Fatalf("report has %d checks, want %d", len(report.Checks), len(checks))
+	}
+}
@@ -0,0 +1,312 @@
+package wallet
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var ErrCredentialNotFound = errors.New("credential not found")
+
+type CredentialState string
+
+const (
+	// CredentialStateStaged credentials are tried only after the primary is rejected.
+	CredentialStateStaged  CredentialState = "staged"
+	CredentialStateActive  CredentialState = "active"
+	CredentialStateRetired CredentialState = "retired"
+)
+
+// Credential is one authentication header/secret pair of an operator. A client may hold
+// several at once so that keys can be rotated without downtime.
+type Credential struct {
+	ID         int64
+	ClientID   int64
+	Header     string
+	Secret     string
+	KeyID      string
+	State      CredentialState
+	Primary    bool
+	ValidFrom  time.Time
+	ValidUntil time.Time
+	LastUsedAt time.Time
+}
+
+// Usable reports whether the credential may be sent at now.
+func (c Credential) Usable(now time.Time) bool {
+
+	if c.State == CredentialStateRetired {
+
+		return false
+	}
+
+	if !c.ValidFrom.IsZero() && now.Before(c.ValidFrom) {
+
+		return false
+	}
+
+	if !c.ValidUntil.IsZero() && !now.Before(c.ValidUntil) {
+
+		return false
+	}
+
+	return true
+}
+
+// CredentialRecorder is told which credential an operator accepted after the primary was
+// rejected. ClientRegistry implements it.
+type CredentialRecorder interface {
+	RecordCredentialUse(ctx context.Context, clientID int64, credentialID int64)
+}
+
+// outboundCredentials returns the credentials to try for client in order. Until a stored
+// credential is promoted, the legacy AuthenticationHeader and AuthenticationString are the
+// implicit primary and staged credentials are fallbacks, newest first. Once one is promoted
+// it goes first, followed by the other usable credentials.
+func (client Client) outboundCredentials(now time.Time) []Credential {
+
+	legacy := Credential{ClientID: client.ID, Header: client.AuthenticationHeader, Secret: client.AuthenticationString}
+
+	var usable []Credential
+	promoted := false
+
+	for _, c := range client.Credentials {
+
+		if c.Usable(now) {
+
+			usable = append(usable, c)
+			promoted = promoted || c.Primary
+		}
+	}
+
+	sort.SliceStable(usable, func(i, j int) bool {
+
+		if usable[i].Primary != usable[j].Primary {
+
+			return usable[i].Primary
+		}
+
+		return usable[i].ValidFrom.After(usable[j].ValidFrom)
+	})
+
+	if !promoted {
+
+		return append([]Credential{legacy}, usable...)
+	}
+
+	return usable
+}
+
+const credentialColumns = "id, account, authentication_header, authentication_string, authentication_key_id, state, is_primary, valid_from, valid_until, last_used_at"
+
+func (s *ClientStore) ListCredentials(ctx context.Context, clientID int64) ([]Credential, error) {
+
+	ctx, span := s.Tracer.Start(ctx, "ListClientCredentials")
+	defer span.End()
+
+	rows, err := s.query(ctx, "SELECT "+credentialColumns+" FROM client_credentials WHERE account = ? ORDER BY id", clientID)
+	if err != nil {
+
+		s.log().Error(ctx, "error listing client credentials", err, LogFields{
+			LogFieldClientID: clientID,
+		})
+
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var credentials []Credential
+
+	for rows.Next() {
+
+		var c Credential
+		var header, secret, keyID, state sql.NullString
+		var primary bool
+		var validFrom, validUntil, lastUsedAt sql.NullTime
+
+		err = rows.Scan(&c.ID, &c.ClientID, &header, &secret, &keyID, &state, &primary, &validFrom, &validUntil, &lastUsedAt)
+		if err != nil {
+
+			return nil, err
+		}
+
+		c.Header = header.String
+		c.Secret = secret.String
+		c.KeyID = keyID.String
+		c.State = CredentialState(state.String)
+		c.Primary = primary
+		c.ValidFrom = validFrom.Time
+		c.ValidUntil = validUntil.Time
+		c.LastUsedAt = lastUsedAt.Time
+
+		credentials = append(credentials, c)
+	}
+
+	return credentials, rows.Err()
+}
+
+func nullTime(t time.Time) interface{} {
+
+	if t.IsZero() {
+
+		return nil
+	}
+
+	return t.UTC()
+}
+
+// StageCredential stores a new, non-primary credential and returns its ID.
+func (s *ClientStore) StageCredential(ctx context.Context, credential Credential) (int64, error) {
+
+	ctx, span := s.Tracer.Start(ctx, "StageClientCredential")
+	defer span.End()
+
+	query := "INSERT INTO client_credentials (account, authentication_header, authentication_string, authentication_key_id, state, is_primary, valid_from, valid_until) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+	params := []interface{}{credential.ClientID, credential.Header, credential.Secret, credential.KeyID, string(CredentialStateStaged), false, nullTime(credential.ValidFrom), nullTime(credential.ValidUntil)}
+
+	var id int64
+	var err error
+
+	if s.Dialect.insertReturningID() {
+
+		err = s.queryRow(ctx, query+" RETURNING id", params...).Scan(&id)
+
+	} else {
+
+		var result sql.Result
+		result, err = s.exec(ctx, query, params...)
+		if err == nil {
+
+			id, err = result.LastInsertId()
+		}
+	}
+
+	if err != nil {
+
+		s.log().Error(ctx, "error staging client credential", err, LogFields{
+			LogFieldClientID: credential.ClientID,
+		})
+
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// PromoteCredential makes the credential the primary one. The previous primary stays
+// active, so calls keep succeeding whichever key the operator currently accepts. Retired
+// credentials and credentials outside their validity window cannot be promoted.
+func (s *ClientStore) PromoteCredential(ctx context.Context, clientID, credentialID int64) error {
+
+	ctx, span := s.Tracer.Start(ctx, "PromoteClientCredential")
+	defer span.End()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+
+		return err
+	}
+
+	defer tx.Rollback()
+
+	// Promoting the row before checking it locks it, so a credential cannot be retired
+	// between the check and the commit.
+	result, err := tx.ExecContext(ctx, s.Dialect.Rebind("UPDATE client_credentials SET is_primary = ?, state = ? WHERE id = ? AND account = ? AND (state IS NULL OR state <> ?)"),
+		true, string(CredentialStateActive), credentialID, clientID, string(CredentialStateRetired))
+	if err != nil {
+
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+
+		return err
+	}
+
+	var c Credential
+	var state sql.NullString
+	var validFrom, validUntil sql.NullTime
+
+	err = tx.QueryRowContext(ctx, s.Dialect.Rebind("SELECT state, valid_from, valid_until FROM client_credentials WHERE id = ? AND account = ?"), credentialID, clientID).Scan(&state, &validFrom, &validUntil)
+	if err != nil {
+
+		if errors.Is(err, sql.ErrNoRows) {
+
+			return ErrCredentialNotFound
+		}
+
+		return err
+	}
+
+	if affected == 0 {
+
+		return fmt.Errorf("credential %d of client %d is %s", credentialID, clientID, state.String)
+	}
+
+	c.ValidFrom = validFrom.Time
+	c.ValidUntil = validUntil.Time
+
+	if !c.Usable(time.Now()) {
+
+		return fmt.Errorf("credential %d of client %d is outside its validity window", credentialID, clientID)
+	}
+
+	_, err = tx.ExecContext(ctx, s.Dialect.Rebind("UPDATE client_credentials SET is_primary = ? WHERE account = ? AND id <> ?"), false, clientID, credentialID)
+	if err != nil {
+
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RetireCredential stops a non-primary credential from being sent.
+func (s *ClientStore) RetireCredential(ctx context.Context, clientID, credentialID int64) error {
+
+	ctx, span := s.Tracer.Start(ctx, "RetireClientCredential")
+	defer span.End()
+
+	result, err := s.exec(ctx, "UPDATE client_credentials SET state = ?, valid_until = ? WHERE id = ? AND account = ? AND is_primary = ?",
+		string(CredentialStateRetired), time.Now().UTC(), credentialID, clientID, false)
+	if err != nil {
+
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+
+		return err
+	}
+
+	if affected == 0 {
+
+		return fmt.Errorf("credential %d of client %d is primary or does not exist: %w", credentialID, clientID, ErrCredentialNotFound)
+	}
+
+	return nil
+}
+
+func (s *ClientStore) TouchCredential(ctx context.Context, clientID, credentialID int64) error {
+
+	ctx, span := s.Tracer.Start(ctx, "TouchClientCredential")
+	defer span.End()
+
+	_, err := s.exec(ctx, "UPDATE client_credentials SET last_used_at = ? WHERE id = ? AND account = ?", time.Now().UTC(), credentialID, clientID)
+	return err
+}
+
+func (s *ClientStore) UpdateCredentialSecret(ctx context.Context, credential Credential) error {
+
+	ctx, span := s.Tracer.Start(ctx, "UpdateClientCredentialSecret")
+	defer span.End()
+
+	_, err := s.exec(ctx, "UPDATE client_credentials SET authentication_string = ?, authentication_key_id = ? WHERE id = ? AND account = ?",
+		credential.Secret, credential.KeyID, credential.ID, credential.ClientID)
+	return err
+}
@@ -0,0 +1,174 @@
+package wallet
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func secrets(credentials []Credential) []string {
+
+	var out []string
+	for _, c := range credentials {
+
+		out = append(out, c.Secret)
+	}
+
+	return out
+}
+
+func TestCredentialRotation(t *testing.T) {
+
+	ctx := context.Background()
+	registry := &ClientRegistry{Store: newTestClientStore(t)}
+
+	err := registry.Create(ctx, Client{ID: 1, BaseURL: "http://one", AuthenticationHeader: "X-Auth", AuthenticationString: "legacy"})
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	outbound := func() []string {
+
+		t.Helper()
+
+		client, err := registry.Get(ctx, 1)
+		if err != nil {
+
+			t.Fatal(err)
+		}
+
+		return secrets(client.outboundCredentials(time.Now()))
+	}
+
+	steps := []struct {
+		name string
+		run  func() error
+		want []string
+	}{
+		{"legacy only", func() error { return nil }, []string{"legacy"}},
+		{"staged", func() error {
+
+			_, err := registry.StageCredential(ctx, Credential{ClientID: 1, Header: "X-Auth", Secret: "first", ValidFrom: time.Now().Add(-time.Hour)})
+			if err != nil {
+
+				return err
+			}
+
+			_, err = registry.StageCredential(ctx, Credential{ClientID: 1, Header: "X-Auth", Secret: "second", ValidFrom: time.Now().Add(-time.Minute)})
+			return err
+		}, []string{"legacy", "second", "first"}},
+		{"promoted", func() error { return registry.PromoteCredential(ctx, 1, 1) }, []string{"first", "second"}},
+		{"retired", func() error { return registry.RetireCredential(ctx, 1, 2) }, []string{"first"}},
+	}
+
+	for _, step := range steps {
+
+		err := step.run()
+		if err != nil {
+
+			t.Fatalf("%s: %v", step.name, err)
+		}
+
+		got := outbound()
+		if len(got) != len(step.want) {
+
+			t.Fatalf("%s: outbound credentials %v, want %v", step.name, got, step.want)
+		}
+
+		for i := range got {
+
+			if got[i] != step.want[i] {
+
+				t.Fatalf("%s: outbound credentials %v, want %v", step.name, got, step.want)
+			}
+		}
+	}
+
+	err = registry.RetireCredential(ctx, 1, 1)
+	if err == nil {
+
+		t.Fatal("retired the primary credential")
+	}
+}
+
+func TestOutboundCredentialsSkipsUnusable(t *testing.T) {
+
+	now := time.Now()
+
+	client := Client{
+		ID:                   1,
+		AuthenticationHeader: "X-Auth",
+		AuthenticationString: "legacy",
+		Credentials: []Credential{
+			{ID: 1, Secret: "future", State: CredentialStateStaged, ValidFrom: now.Add(time.Hour)},
+			{ID: 2, Secret: "expired", State: CredentialStateStaged, ValidUntil: now.Add(-time.Hour)},
+			{ID: 3, Secret: "retired", State: CredentialStateRetired},
+		},
+	}
+
+	got := secrets(client.outboundCredentials(now))
+	if len(got) != 1 || got[0] != "legacy" {
+
+		t.Fatalf("outbound credentials %v, want [legacy]", got)
+	}
+}
+
+func TestPromoteCredentialChecksState(t *testing.T) {
+
+	ctx := context.Background()
+	store := newTestClientStore(t)
+
+	err := store.Create(ctx, Client{ID: 1, BaseURL: "http://one", AuthenticationHeader: "X-Auth", AuthenticationString: "legacy"})
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	future, err := store.StageCredential(ctx, Credential{ClientID: 1, Header: "X-Auth", Secret: "future", ValidFrom: time.Now().Add(time.Hour)})
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	retired, err := store.StageCredential(ctx, Credential{ClientID: 1, Header: "X-Auth", Secret: "retired"})
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	err = store.RetireCredential(ctx, 1, retired)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	for _, id := range []int64{future, retired} {
+
+		err = store.PromoteCredential(ctx, 1, id)
+		if err == nil {
+
+			t.Fatalf("promoted unusable credential %d", id)
+		}
+	}
+
+	err = store.PromoteCredential(ctx, 1, 99)
+	if err != ErrCredentialNotFound {
+
+		t.Fatalf("PromoteCredential(unknown) = %v, want ErrCredentialNotFound", err)
+	}
+
+	credentials, err := store.ListCredentials(ctx, 1)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	for _, c := range credentials {
+
+		if c.Primary || c.State == CredentialStateActive {
+
+			t.Fatalf("credential %d changed by a refused promotion: %+v", c.ID, c)
+		}
+	}
+}
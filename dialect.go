@@ -0,0 +1,131 @@
+package wallet
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Dialect string
+
+const (
+	DialectMySQL    Dialect = "mysql"
+	DialectPostgres Dialect = "postgres"
+	DialectSQLite   Dialect = "sqlite"
+)
+
+// ParseDialect accepts a dialect name or the name of a common database/sql driver.
+func ParseDialect(name string) (Dialect, error) {
+
+	switch strings.ToLower(strings.TrimSpace(name)) {
+
+	case "mysql", "mariadb":
+		return DialectMySQL, nil
+
+	case "postgres", "postgresql", "pgx", "pq":
+		return DialectPostgres, nil
+
+	case "sqlite", "sqlite3":
+		return DialectSQLite, nil
+	}
+
+	return "", fmt.Errorf("unsupported sql dialect %q", name)
+}
+
+// Rebind rewrites the ? placeholders of query into the dialect's placeholder syntax.
+// Queries must not contain literal question marks.
+func (d Dialect) Rebind(query string) string {
+
+	if d != DialectPostgres {
+
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+
+	for _, r := range query {
+
+		if r == '?' {
+
+			n++
+			b.WriteString("$")
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// Upsert returns an insert statement for columns that updates the update columns when a
+// row with the same conflict columns exists.
+func (d Dialect) Upsert(table string, columns, conflict, update []string) string {
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(columns)), ",")
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(columns, ", "), placeholders)
+
+	sets := make([]string, len(update))
+
+	switch d {
+
+	case DialectMySQL:
+		for i, c := range update {
+
+			sets[i] = fmt.Sprintf("%s = VALUES(%s)", c, c)
+		}
+
+		query = query + " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+
+	default:
+		for i, c := range update {
+
+			sets[i] = fmt.Sprintf("%s = excluded.%s", c, c)
+		}
+
+		query = query + fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(conflict, ", "), strings.Join(sets, ", "))
+	}
+
+	return d.Rebind(query)
+}
+
+// insertReturningID reports whether inserts must use RETURNING to learn the new row ID
+// because the driver does not implement LastInsertId.
+func (d Dialect) insertReturningID() bool {
+
+	return d == DialectPostgres
+}
+
+// tableExistsQuery returns a query counting the tables of the current database or schema
+// that are named by its one parameter.
+func (d Dialect) tableExistsQuery() string {
+
+	switch d {
+
+	case DialectMySQL:
+		return "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?"
+
+	case DialectPostgres:
+		return "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?"
+	}
+
+	return "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+}
+
+// columnExistsQuery returns a query counting the columns of the current database or schema
+// named by its second parameter in the table named by its first.
+func (d Dialect) columnExistsQuery() string {
+
+	switch d {
+
+	case DialectMySQL:
+		return "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?"
+
+	case DialectPostgres:
+		return "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?"
+	}
+
+	return "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?"
+}
@@ -0,0 +1,324 @@
+// Package echosession authenticates Echo requests with wallet session tokens.
+package echosession
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	wallet "github.com/touchvas/casino-wallet"
+)
+
+const (
+	contextKey = "wallet.session"
+
+	defaultTokenLookup   = "header:Authorization,query:token,cookie:session_token"
+	defaultRefreshHeader = "X-Session-Token"
+)
+
+// ErrMissingToken is passed to the error handler when a request carries no token.
+var ErrMissingToken = errors.New("missing session token")
+
+// Session is the authenticated session of a request.
+type Session struct {
+	Token     string
+	PlayerID  string
+	ClientID  int64
+	SessionID string
+	GameID    string
+	ExpiresAt time.Time
+}
+
+// SessionStore validates and refreshes tokens. wallet.SessionStore implements it.
+type SessionStore interface {
+	Validate(ctx context.Context, token string) (*wallet.SessionClaims, error)
+	Refresh(ctx context.Context, token string, claims *wallet.SessionClaims) (string, error)
+}
+
+// Config configures MiddlewareWithConfig. Only Sessions is required.
+type Config struct {
+	Skipper  middleware.Skipper
+	Sessions SessionStore
+
+	// TokenLookup lists where the token is read from, first match wins, as comma
+	// separated "header:<name>", "query:<name>" and "cookie:<name>" sources. A "Bearer "
+	// prefix is stripped from header values. Defaults to the Authorization header, the
+	// token query parameter and the session_token cookie.
+	TokenLookup string
+
+	// Sliding refreshes the session on every authenticated request. When the token
+	// changes, the new one is returned in RefreshHeader, X-Session-Token by default, and
+	// replaces the cookie it was read from, if any.
+	Sliding       bool
+	RefreshHeader string
+
+	// ErrorHandler answers requests that fail authentication. The default answers 401
+	// with a JSON message for missing, invalid, expired and revoked tokens, and 503 when
+	// the session store fails, so that an outage does not log players out.
+	ErrorHandler func(c echo.Context, err error) error
+}
+
+type tokenSource struct {
+	from string
+	name string
+}
+
+// Middleware authenticates requests against sessions with the default configuration.
+func Middleware(sessions SessionStore) echo.MiddlewareFunc {
+
+	return MiddlewareWithConfig(Config{Sessions: sessions})
+}
+
+// MiddlewareWithConfig authenticates requests, answering 401 through config.ErrorHandler
+// when the token is missing or invalid. The session is available to handlers through
+// FromEcho and to code below them through FromContext.
+func MiddlewareWithConfig(config Config) echo.MiddlewareFunc {
+
+	if config.Sessions == nil {
+
+		panic("echosession: middleware requires a session store")
+	}
+
+	if config.Skipper == nil {
+
+		config.Skipper = middleware.DefaultSkipper
+	}
+
+	if len(config.TokenLookup) == 0 {
+
+		config.TokenLookup = defaultTokenLookup
+	}
+
+	if len(config.RefreshHeader) == 0 {
+
+		config.RefreshHeader = defaultRefreshHeader
+	}
+
+	if config.ErrorHandler == nil {
+
+		config.ErrorHandler = defaultErrorHandler
+	}
+
+	sources, err := parseTokenLookup(config.TokenLookup)
+	if err != nil {
+
+		panic("echosession: " + err.Error())
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+
+		return func(c echo.Context) error {
+
+			if config.Skipper(c) {
+
+				return next(c)
+			}
+
+			token, source := extractToken(c, sources)
+			if len(token) == 0 {
+
+				return config.ErrorHandler(c, ErrMissingToken)
+			}
+
+			ctx := c.Request().Context()
+
+			claims, err := config.Sessions.Validate(ctx, token)
+			if err != nil {
+
+				return config.ErrorHandler(c, err)
+			}
+
+			if config.Sliding {
+
+				refreshed, err := config.Sessions.Refresh(ctx, token, claims)
+				if err != nil {
+
+					return config.ErrorHandler(c, err)
+				}
+
+				if refreshed != token {
+
+					claims, err = config.Sessions.Validate(ctx, refreshed)
+					if err != nil {
+
+						return config.ErrorHandler(c, err)
+					}
+
+					c.Response().Header().Set(config.RefreshHeader, refreshed)
+					token = refreshed
+
+					if source.from == "cookie" {
+
+						refreshCookie(c, source.name, refreshed, claims)
+					}
+				}
+			}
+
+			session := &Session{
+				Token:     token,
+				PlayerID:  claims.PlayerID,
+				ClientID:  claims.ClientID,
+				SessionID: claims.SessionID,
+				GameID:    claims.GameID,
+			}
+
+			if claims.ExpiresAt > 0 {
+
+				session.ExpiresAt = time.Unix(claims.ExpiresAt, 0)
+			}
+
+			c.Set(contextKey, session)
+			c.SetRequest(c.Request().WithContext(NewContext(ctx, session)))
+
+			return next(c)
+		}
+	}
+}
+
+func parseTokenLookup(lookup string) ([]tokenSource, error) {
+
+	var sources []tokenSource
+
+	for _, part := range strings.Split(lookup, ",") {
+
+		from, name, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok || len(name) == 0 {
+
+			return nil, fmt.Errorf("invalid token source %q", part)
+		}
+
+		switch from {
+
+		case "header", "query", "cookie":
+			sources = append(sources, tokenSource{from: from, name: name})
+
+		default:
+			return nil, fmt.Errorf("unsupported token source %q", from)
+		}
+	}
+
+	return sources, nil
+}
+
+// extractToken returns the first token found and the source it was read from.
+func extractToken(c echo.Context, sources []tokenSource) (string, tokenSource) {
+
+	for _, s := range sources {
+
+		var token string
+
+		switch s.from {
+
+		case "header":
+			token = c.Request().Header.Get(s.name)
+			if len(token) > 7 && strings.EqualFold(token[:7], "bearer ") {
+
+				token = token[7:]
+			}
+
+		case "query":
+			token = c.QueryParam(s.name)
+
+		case "cookie":
+			cookie, err := c.Cookie(s.name)
+			if err == nil {
+
+				token = cookie.Value
+			}
+		}
+
+		token = strings.TrimSpace(token)
+		if len(token) > 0 {
+
+			return token, s
+		}
+	}
+
+	return "", tokenSource{}
+}
+
+func refreshCookie(c echo.Context, name, token string, claims *wallet.SessionClaims) {
+
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   c.IsTLS(),
+		SameSite: http.SameSiteLaxMode,
+	}
+
+	if claims.ExpiresAt > 0 {
+
+		cookie.Expires = time.Unix(claims.ExpiresAt, 0)
+	}
+
+	c.SetCookie(cookie)
+}
+
+func defaultErrorHandler(c echo.Context, err error) error {
+
+	var message string
+
+	switch {
+
+	case errors.Is(err, ErrMissingToken):
+		message = ErrMissingToken.Error()
+
+	case errors.Is(err, wallet.ErrTokenExpired):
+		message = "session expired"
+
+	case errors.Is(err, wallet.ErrTokenRevoked):
+		message = "session revoked"
+
+	case errors.Is(err, wallet.ErrInvalidToken):
+		message = "invalid session token"
+
+	default:
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "session store unavailable")
+	}
+
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="session"`)
+	return echo.NewHTTPError(http.StatusUnauthorized, message)
+}
+
+// FromEcho returns the session set by the middleware.
+func FromEcho(c echo.Context) (*Session, bool) {
+
+	session, ok := c.Get(contextKey).(*Session)
+	return session, ok
+}
+
+// MustFromEcho returns the session set by the middleware and panics without one, for
+// handlers that are only mounted behind it.
+func MustFromEcho(c echo.Context) *Session {
+
+	session, ok := FromEcho(c)
+	if !ok {
+
+		panic("echosession: no session in context, is the middleware installed?")
+	}
+
+	return session
+}
+
+type sessionKey struct{}
+
+// NewContext returns a context carrying session.
+func NewContext(ctx context.Context, session *Session) context.Context {
+
+	return context.WithValue(ctx, sessionKey{}, session)
+}
+
+// FromContext returns the session of a request context, for code below the handler
+// that only receives a context.Context.
+func FromContext(ctx context.Context) (*Session, bool) {
+
+	session, ok := ctx.Value(sessionKey{}).(*Session)
+	return session, ok
+}
@@ -0,0 +1,63 @@
+package echosession
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	wallet "github.com/touchvas/casino-wallet"
+)
+
+// failingStore fails every validation with err.
+type failingStore struct {
+	err error
+}
+
+func (s failingStore) Validate(ctx context.Context, token string) (*wallet.SessionClaims, error) {
+
+	return nil, s.err
+}
+
+func (s failingStore) Refresh(ctx context.Context, token string, claims *wallet.SessionClaims) (string, error) {
+
+	return "", s.err
+}
+
+func TestMiddlewareErrorStatus(t *testing.T) {
+
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{wallet.ErrInvalidToken, http.StatusUnauthorized},
+		{wallet.ErrTokenExpired, http.StatusUnauthorized},
+		{wallet.ErrTokenRevoked, http.StatusUnauthorized},
+		{fmt.Errorf("%w: %w", wallet.ErrInvalidToken, wallet.ErrUnknownKeyID), http.StatusUnauthorized},
+		{errors.New("dial tcp: connection refused"), http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+
+		e := echo.New()
+		e.Use(Middleware(failingStore{err: tt.err}))
+		e.GET("/", func(c echo.Context) error {
+
+			return c.NoContent(http.StatusOK)
+		})
+
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", "Bearer token")
+
+		rw := httptest.NewRecorder()
+		e.ServeHTTP(rw, r)
+
+		if rw.Code != tt.status {
+
+			t.Errorf("%v answered %d, want %d", tt.err, rw.Code, tt.status)
+		}
+	}
+}
@@ -0,0 +1,630 @@
+package wallet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	defaultHealthInterval         = 30 * time.Second
+	defaultHealthTimeout          = 5 * time.Second
+	defaultHealthWindow           = 100
+	defaultHealthFailureThreshold = 3
+)
+
+// ClientLister lists operator configs with their secrets decrypted and their credentials
+// loaded, as ClientRegistry does. ClientStore returns neither and must not be used: a
+// prober on it would send ciphertext and demote healthy operators.
+type ClientLister interface {
+	List(ctx context.Context, filter ClientFilter) ([]Client, error)
+}
+
+// ClientStatusSetter changes the status of an operator. ClientStore and ClientRegistry
+// implement it.
+type ClientStatusSetter interface {
+	SetStatus(ctx context.Context, id int64, status ClientStatus) error
+}
+
+// OperatorHealth is the health of one operator over the last Window probes.
+type OperatorHealth struct {
+	ClientID            int64
+	Healthy             bool
+	Availability        float64
+	LatencyP50          time.Duration
+	LatencyP95          time.Duration
+	LatencyP99          time.Duration
+	Probes              int
+	ConsecutiveFailures int
+	LastCheckedAt       time.Time
+	LastError           string
+	LastErrorAt         time.Time
+}
+
+// HealthProber periodically probes every operator that is not suspended. Operators with a
+// player in TestPlayers are probed with a profile lookup of that player; the others with a
+// GET of HealthPath relative to their BaseURL, sent with their primary credential.
+// Operators with neither are not probed.
+//
+// An operator becomes unhealthy after FailureThreshold consecutive failed probes and
+// healthy again on the next successful one. When Statuses is set, an active operator that
+// becomes unhealthy is put in maintenance, and put back to active once it recovers;
+// operators placed in maintenance by someone else are never reactivated.
+//
+// Which operators the prober put in maintenance is kept in Redis when it is set, so that
+// any replica, including one started later, reactivates them. Without Redis it is kept in
+// memory and only the replica that demoted an operator reactivates it.
+//
+// HealthProber is an http.Handler serving the health of every operator as JSON, or of a
+// single one with the client_id query parameter, so lobbies can hide games of operators
+// that are down. The last error is left out, since it may carry an operator's response;
+// use Health or Snapshot to read it.
+type HealthProber struct {
+	Wallet           *Wallet
+	Clients          ClientLister
+	Statuses         ClientStatusSetter
+	Redis            redis.UniversalClient
+	KeySpace         KeySpace
+	HealthPath       string
+	TestPlayers      map[int64]string
+	Interval         time.Duration
+	Timeout          time.Duration
+	Window           int
+	FailureThreshold int
+
+	mu      sync.RWMutex
+	health  map[int64]*operatorHealth
+	demoted map[int64]bool
+}
+
+type operatorHealth struct {
+	OperatorHealth
+	samples []healthSample
+}
+
+type healthSample struct {
+	latency time.Duration
+	ok      bool
+}
+
+func NewHealthProber(w *Wallet, clients ClientLister) *HealthProber {
+
+	return &HealthProber{
+		Wallet:           w,
+		Clients:          clients,
+		Interval:         defaultHealthInterval,
+		Timeout:          defaultHealthTimeout,
+		Window:           defaultHealthWindow,
+		FailureThreshold: defaultHealthFailureThreshold,
+	}
+}
+
+func (p *HealthProber) interval() time.Duration {
+
+	if p.Interval > 0 {
+
+		return p.Interval
+	}
+
+	return defaultHealthInterval
+}
+
+func (p *HealthProber) timeout() time.Duration {
+
+	if p.Timeout > 0 {
+
+		return p.Timeout
+	}
+
+	return defaultHealthTimeout
+}
+
+func (p *HealthProber) window() int {
+
+	if p.Window > 0 {
+
+		return p.Window
+	}
+
+	return defaultHealthWindow
+}
+
+func (p *HealthProber) failureThreshold() int {
+
+	if p.FailureThreshold > 0 {
+
+		return p.FailureThreshold
+	}
+
+	return defaultHealthFailureThreshold
+}
+
+// Run probes every operator each Interval until ctx is cancelled.
+func (p *HealthProber) Run(ctx context.Context) error {
+
+	ticker := time.NewTicker(p.interval())
+	defer ticker.Stop()
+
+	for {
+
+		err := p.ProbeAll(ctx)
+		if err != nil {
+
+			p.Wallet.log().Error(ctx, "error probing operators", err, nil)
+		}
+
+		select {
+
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProbeAll probes every operator that is not suspended once, concurrently.
+func (p *HealthProber) ProbeAll(ctx context.Context) error {
+
+	clients, err := p.Clients.List(ctx, ClientFilter{})
+	if err != nil {
+
+		return err
+	}
+
+	var wg sync.WaitGroup
+
+	for _, client := range clients {
+
+		if client.Status == ClientStatusSuspended {
+
+			continue
+		}
+
+		if len(client.AuthenticationKeyID) > 0 {
+
+			p.Wallet.log().Error(ctx, "error probing operator", fmt.Errorf("secret of client %d is still encrypted, list clients through a ClientRegistry", client.ID), LogFields{
+				LogFieldClientID: client.ID,
+			})
+
+			continue
+		}
+
+		wg.Add(1)
+		go func(client Client) {
+
+			defer wg.Done()
+			p.Probe(ctx, client)
+		}(client)
+	}
+
+	wg.Wait()
+	return nil
+}
+
+// Probe probes client once and returns its updated health.
+func (p *HealthProber) Probe(ctx context.Context, client Client) OperatorHealth {
+
+	player, hasPlayer := p.TestPlayers[client.ID]
+	if !hasPlayer && len(p.HealthPath) == 0 {
+
+		h, _ := p.Health(client.ID)
+		return h
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout())
+	defer cancel()
+
+	ctx, span := p.Wallet.startSpan(ctx, "ProbeOperator", OperationProfile, client)
+
+	var err error
+	started := time.Now()
+
+	if hasPlayer {
+
+		_, err = p.Wallet.fetchWalletProfile(ctx, client, player)
+
+	} else {
+
+		err = p.get(ctx, client)
+	}
+
+	latency := time.Since(started)
+	endSpan(span, 0, err)
+
+	// A healthy operator in maintenance may have been demoted by another replica, which
+	// saw it fail while this one did not.
+	h, changed := p.record(client.ID, latency, err)
+	if changed || (h.Healthy && client.Status == ClientStatusMaintenance && p.Statuses != nil) {
+
+		p.updateStatus(ctx, client, h.Healthy)
+	}
+
+	return h
+}
+
+func (p *HealthProber) get(ctx context.Context, client Client) error {
+
+	endpoint := strings.TrimRight(client.BaseURL, "/") + "/" + strings.TrimLeft(p.HealthPath, "/")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+
+		return err
+	}
+
+	credential := client.outboundCredentials(time.Now())[0]
+	if len(credential.Header) > 0 {
+
+		req.Header.Set(credential.Header, credential.Secret)
+	}
+
+	req.Header.Set("User-Agent", p.Wallet.Provider.userAgent())
+	p.Wallet.propagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := p.Wallet.httpClient().Do(req)
+	if err != nil {
+
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+
+		return fmt.Errorf("health check returned %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// record adds a probe result to the health of clientID and reports whether the operator
+// changed between healthy and unhealthy.
+func (p *HealthProber) record(clientID int64, latency time.Duration, err error) (OperatorHealth, bool) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.health == nil {
+
+		p.health = make(map[int64]*operatorHealth)
+	}
+
+	h, ok := p.health[clientID]
+	if !ok {
+
+		h = &operatorHealth{OperatorHealth: OperatorHealth{ClientID: clientID, Healthy: true}}
+		p.health[clientID] = h
+	}
+
+	now := time.Now()
+	wasHealthy := h.Healthy
+
+	h.samples = append(h.samples, healthSample{latency: latency, ok: err == nil})
+	if len(h.samples) > p.window() {
+
+		h.samples = h.samples[len(h.samples)-p.window():]
+	}
+
+	h.Probes++
+	h.LastCheckedAt = now
+
+	if err != nil {
+
+		h.ConsecutiveFailures++
+		h.LastError = err.Error()
+		h.LastErrorAt = now
+
+	} else {
+
+		h.ConsecutiveFailures = 0
+	}
+
+	h.Healthy = h.ConsecutiveFailures < p.failureThreshold()
+
+	var succeeded int
+	latencies := make([]time.Duration, 0, len(h.samples))
+
+	for _, s := range h.samples {
+
+		if s.ok {
+
+			succeeded++
+		}
+
+		latencies = append(latencies, s.latency)
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	h.Availability = float64(succeeded) / float64(len(h.samples))
+	h.LatencyP50 = percentile(latencies, 0.50)
+	h.LatencyP95 = percentile(latencies, 0.95)
+	h.LatencyP99 = percentile(latencies, 0.99)
+
+	return h.OperatorHealth, wasHealthy != h.Healthy
+}
+
+func percentile(sorted []time.Duration, q float64) time.Duration {
+
+	if len(sorted) == 0 {
+
+		return 0
+	}
+
+	i := int(q*float64(len(sorted))+0.5) - 1
+	if i < 0 {
+
+		i = 0
+	}
+
+	if i >= len(sorted) {
+
+		i = len(sorted) - 1
+	}
+
+	return sorted[i]
+}
+
+func healthDemotedKey(clientID int64) string {
+
+	return fmt.Sprintf("health-demoted:%d", clientID)
+}
+
+// markDemoted records that the prober put clientID in maintenance.
+func (p *HealthProber) markDemoted(ctx context.Context, clientID int64) error {
+
+	if p.Redis != nil {
+
+		return p.Redis.Set(ctx, p.KeySpace.Key(healthDemotedKey(clientID)), "1", 0).Err()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.demoted == nil {
+
+		p.demoted = make(map[int64]bool)
+	}
+
+	p.demoted[clientID] = true
+	return nil
+}
+
+func (p *HealthProber) isDemoted(ctx context.Context, clientID int64) (bool, error) {
+
+	if p.Redis != nil {
+
+		n, err := p.Redis.Exists(ctx, p.KeySpace.Key(healthDemotedKey(clientID))).Result()
+		return n > 0, err
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.demoted[clientID], nil
+}
+
+func (p *HealthProber) clearDemoted(ctx context.Context, clientID int64) error {
+
+	if p.Redis != nil {
+
+		return p.Redis.Del(ctx, p.KeySpace.Key(healthDemotedKey(clientID))).Err()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.demoted, clientID)
+	return nil
+}
+
+func (p *HealthProber) updateStatus(ctx context.Context, client Client, healthy bool) {
+
+	if p.Statuses == nil {
+
+		p.Wallet.log().Warn(ctx, "operator health changed", LogFields{
+			LogFieldClientID: client.ID,
+			"healthy":        healthy,
+		})
+
+		return
+	}
+
+	var status ClientStatus
+
+	switch {
+
+	case !healthy && client.Status == ClientStatusActive:
+		// The operator is only demoted once the demotion is recorded, or nothing would
+		// ever reactivate it.
+		err := p.markDemoted(ctx, client.ID)
+		if err != nil {
+
+			p.Wallet.log().Error(ctx, "error recording operator demotion", err, LogFields{
+				LogFieldClientID: client.ID,
+			})
+
+			return
+		}
+
+		status = ClientStatusMaintenance
+
+	case healthy && client.Status == ClientStatusMaintenance:
+		demoted, err := p.isDemoted(ctx, client.ID)
+		if err != nil {
+
+			p.Wallet.log().Error(ctx, "error reading operator demotion", err, LogFields{
+				LogFieldClientID: client.ID,
+			})
+
+			return
+		}
+
+		if !demoted {
+
+			return
+		}
+
+		status = ClientStatusActive
+	}
+
+	if len(status) == 0 {
+
+		return
+	}
+
+	p.Wallet.log().Warn(ctx, "operator health changed", LogFields{
+		LogFieldClientID: client.ID,
+		"healthy":        healthy,
+		"status":         string(status),
+	})
+
+	err := p.Statuses.SetStatus(ctx, client.ID, status)
+	if err != nil {
+
+		p.Wallet.log().Error(ctx, "error updating operator status", err, LogFields{
+			LogFieldClientID: client.ID,
+		})
+
+		return
+	}
+
+	if status == ClientStatusActive {
+
+		err = p.clearDemoted(ctx, client.ID)
+		if err != nil {
+
+			p.Wallet.log().Error(ctx, "error clearing operator demotion", err, LogFields{
+				LogFieldClientID: client.ID,
+			})
+		}
+	}
+}
+
+// Health returns the health of clientID, reporting false when it has not been probed.
+func (p *HealthProber) Health(clientID int64) (OperatorHealth, bool) {
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	h, ok := p.health[clientID]
+	if !ok {
+
+		return OperatorHealth{ClientID: clientID, Healthy: true}, false
+	}
+
+	return h.OperatorHealth, true
+}
+
+// Healthy reports whether clientID is healthy. Operators that have not been probed are
+// assumed healthy.
+func (p *HealthProber) Healthy(clientID int64) bool {
+
+	h, _ := p.Health(clientID)
+	return h.Healthy
+}
+
+// Snapshot returns the health of every probed operator ordered by client ID.
+func (p *HealthProber) Snapshot() []OperatorHealth {
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	out := make([]OperatorHealth, 0, len(p.health))
+	for _, h := range p.health {
+
+		out = append(out, h.OperatorHealth)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].ClientID < out[j].ClientID })
+	return out
+}
+
+type operatorHealthResponse struct {
+	ClientID            int64      `json:"client_id"`
+	Healthy             bool       `json:"healthy"`
+	Availability        float64    `json:"availability"`
+	LatencyP50          float64    `json:"latency_p50_ms"`
+	LatencyP95          float64    `json:"latency_p95_ms"`
+	LatencyP99          float64    `json:"latency_p99_ms"`
+	Probes              int        `json:"probes"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastCheckedAt       *time.Time `json:"last_checked_at"`
+	LastErrorAt         *time.Time `json:"last_error_at,omitempty"`
+}
+
+func newOperatorHealthResponse(h OperatorHealth) operatorHealthResponse {
+
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	at := func(t time.Time) *time.Time {
+
+		if t.IsZero() {
+
+			return nil
+		}
+
+		return &t
+	}
+
+	return operatorHealthResponse{
+		ClientID:            h.ClientID,
+		Healthy:             h.Healthy,
+		Availability:        h.Availability,
+		LatencyP50:          ms(h.LatencyP50),
+		LatencyP95:          ms(h.LatencyP95),
+		LatencyP99:          ms(h.LatencyP99),
+		Probes:              h.Probes,
+		ConsecutiveFailures: h.ConsecutiveFailures,
+		LastCheckedAt:       at(h.LastCheckedAt),
+		LastErrorAt:         at(h.LastErrorAt),
+	}
+}
+
+func (p *HealthProber) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+
+		rw.Header().Set("Allow", http.MethodGet)
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body interface{}
+
+	if id := r.URL.Query().Get("client_id"); len(id) > 0 {
+
+		clientID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+
+			http.Error(rw, "invalid client_id", http.StatusBadRequest)
+			return
+		}
+
+		h, _ := p.Health(clientID)
+		body = newOperatorHealthResponse(h)
+
+	} else {
+
+		snapshot := p.Snapshot()
+		out := make([]operatorHealthResponse, 0, len(snapshot))
+		for _, h := range snapshot {
+
+			out = append(out, newOperatorHealthResponse(h))
+		}
+
+		body = out
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(rw).Encode(body)
+}
@@ -0,0 +1,160 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// statusRecorder is a ClientStatusSetter keeping the latest status of each operator.
+type statusRecorder struct {
+	mu       sync.Mutex
+	statuses map[int64]ClientStatus
+}
+
+func (r *statusRecorder) SetStatus(ctx context.Context, id int64, status ClientStatus) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.statuses == nil {
+
+		r.statuses = make(map[int64]ClientStatus)
+	}
+
+	r.statuses[id] = status
+	return nil
+}
+
+func (r *statusRecorder) status(id int64) ClientStatus {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.statuses[id]
+}
+
+func TestHealthProberReactivatesAcrossReplicas(t *testing.T) {
+
+	ctx := context.Background()
+	_, conn := newTestRedis(t)
+
+	var down atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+
+		if down.Load() {
+
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	w, err := NewWallet(noop.NewTracerProvider().Tracer("test"), ProviderIdentity{ID: 1, Name: "test"})
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	statuses := &statusRecorder{}
+	replica := func() *HealthProber {
+
+		p := NewHealthProber(w, nil)
+		p.Statuses = statuses
+		p.Redis = conn
+		p.KeySpace = KeySpace{Prefix: "test"}
+		p.HealthPath = "/health"
+		p.FailureThreshold = 2
+		return p
+	}
+
+	first, second := replica(), replica()
+	client := Client{ID: 7, BaseURL: server.URL, Status: ClientStatusActive}
+
+	down.Store(true)
+	first.Probe(ctx, client)
+	first.Probe(ctx, client)
+
+	if got := statuses.status(7); got != ClientStatusMaintenance {
+
+		t.Fatalf("status after failures = %q, want maintenance", got)
+	}
+
+	// The replica that demoted the operator is gone; another one sees it recover.
+	down.Store(false)
+	client.Status = ClientStatusMaintenance
+	second.Probe(ctx, client)
+
+	if got := statuses.status(7); got != ClientStatusActive {
+
+		t.Fatalf("status after recovery on another replica = %q, want active", got)
+	}
+
+	// Operators put in maintenance by someone else stay there.
+	statuses.SetStatus(ctx, 7, ClientStatusMaintenance)
+	second.Probe(ctx, client)
+
+	if got := statuses.status(7); got != ClientStatusMaintenance {
+
+		t.Fatalf("status of a manually demoted operator = %q, want maintenance", got)
+	}
+}
+
+// clientList is a ClientLister over a fixed set of operators.
+type clientList []Client
+
+func (l clientList) List(ctx context.Context, filter ClientFilter) ([]Client, error) {
+
+	return l, nil
+}
+
+func TestHealthProberHidesErrorsAndCiphertext(t *testing.T) {
+
+	ctx := context.Background()
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+
+		requests.Add(1)
+	}))
+	defer server.Close()
+
+	w, err := NewWallet(noop.NewTracerProvider().Tracer("test"), ProviderIdentity{ID: 1, Name: "test"})
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	sealed := Client{ID: 7, BaseURL: server.URL, AuthenticationHeader: "X-Auth", AuthenticationString: "v2:sealed", AuthenticationKeyID: "k1", Status: ClientStatusActive}
+
+	p := NewHealthProber(w, clientList{sealed})
+	p.HealthPath = "/health"
+
+	err = p.ProbeAll(ctx)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	if requests.Load() > 0 {
+
+		t.Fatal("probed an operator with its secret still encrypted")
+	}
+
+	p.record(8, time.Millisecond, errors.New(`operator said {"internal":"details"}`))
+
+	rw := httptest.NewRecorder()
+	p.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/health?client_id=8", nil))
+
+	if strings.Contains(rw.Body.String(), "internal") {
+
+		t.Fatalf("status endpoint exposes the operator's error: %s", rw.Body.String())
+	}
+}
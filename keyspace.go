@@ -0,0 +1,103 @@
+package wallet
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+type KeyFamily string
+
+const (
+	KeyFamilyToken      KeyFamily = "token"
+	KeyFamilySession    KeyFamily = "session"
+	KeyFamilyLaunch     KeyFamily = "launch"
+	KeyFamilyLaunchUsed KeyFamily = "launch-used"
+	KeyFamilyRevoked    KeyFamily = "revoked"
+	KeyFamilyProfile    KeyFamily = "profile"
+)
+
+var defaultKeyTTLs = map[KeyFamily]time.Duration{
+	KeyFamilyToken:      5 * time.Hour,
+	KeyFamilySession:    5 * time.Hour,
+	KeyFamilyLaunch:     60 * time.Second,
+	KeyFamilyLaunchUsed: 24 * time.Hour,
+	KeyFamilyRevoked:    30 * 24 * time.Hour,
+	KeyFamilyProfile:    5 * time.Second,
+}
+
+// KeySpace namespaces every Redis key the library writes and holds the TTL of each key
+// family. Keys are laid out as <prefix>:<tenant>:v<version>:<key>, with empty segments
+// left out. Version 0 is the unversioned layout used before KeySpace existed, so
+// DefaultKeySpace keeps reading keys written by older releases.
+type KeySpace struct {
+	Prefix  string
+	Tenant  string
+	Version int
+	TTLs    map[KeyFamily]time.Duration
+}
+
+// DefaultKeySpace returns the legacy key space configured through REDIS_KEY_PREFIX.
+func DefaultKeySpace() KeySpace {
+
+	return KeySpace{Prefix: os.Getenv("REDIS_KEY_PREFIX")}
+}
+
+func (k KeySpace) Validate() error {
+
+	for _, segment := range []string{k.Prefix, k.Tenant} {
+
+		if strings.ContainsAny(segment, "{}") {
+
+			return fmt.Errorf("key space segment %q must not contain hash tag braces", segment)
+		}
+	}
+
+	if k.Version < 0 {
+
+		return fmt.Errorf("key space version must not be negative")
+	}
+
+	return nil
+}
+
+func (k KeySpace) Key(key string) string {
+
+	segments := make([]string, 0, 4)
+
+	if len(k.Prefix) > 0 {
+
+		segments = append(segments, k.Prefix)
+	}
+
+	if len(k.Tenant) > 0 {
+
+		segments = append(segments, k.Tenant)
+	}
+
+	if k.Version > 0 {
+
+		segments = append(segments, fmt.Sprintf("v%d", k.Version))
+	}
+
+	return strings.Join(append(segments, key), ":")
+}
+
+// TTL returns the configured lifetime of keys in family, falling back to the library default.
+func (k KeySpace) TTL(family KeyFamily) time.Duration {
+
+	if ttl, ok := k.TTLs[family]; ok && ttl > 0 {
+
+		return ttl
+	}
+
+	return defaultKeyTTLs[family]
+}
+
+// TTLSeconds returns TTL in whole seconds, rounded up so that a sub-second TTL does not
+// become 0, which Redis treats as no expiry.
+func (k KeySpace) TTLSeconds(family KeyFamily) int {
+
+	return int((k.TTL(family) + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,48 @@
+package wallet
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeySpaceTTLSeconds(t *testing.T) {
+
+	tests := []struct {
+		ttl  time.Duration
+		want int
+	}{
+		{500 * time.Millisecond, 1},
+		{time.Second, 1},
+		{1500 * time.Millisecond, 2},
+		{5 * time.Hour, 5 * 3600},
+	}
+
+	for _, tt := range tests {
+
+		ks := KeySpace{TTLs: map[KeyFamily]time.Duration{KeyFamilyProfile: tt.ttl}}
+		if got := ks.TTLSeconds(KeyFamilyProfile); got != tt.want {
+
+			t.Errorf("TTLSeconds(%v) = %d, want %d", tt.ttl, got, tt.want)
+		}
+	}
+}
+
+func TestConstructorsValidateKeySpace(t *testing.T) {
+
+	ks := KeySpace{Prefix: "{bad}"}
+
+	if _, err := NewProfileCache(nil, ks); err == nil {
+
+		t.Error("NewProfileCache accepted an invalid key space")
+	}
+
+	if _, err := NewClientRegistry(nil, nil, ks); err == nil {
+
+		t.Error("NewClientRegistry accepted an invalid key space")
+	}
+
+	if _, err := NewSessionStore(TokenModeSigned, nil, ks, &TokenSigner{}); err == nil {
+
+		t.Error("NewSessionStore accepted an invalid key space")
+	}
+}
@@ -0,0 +1,273 @@
+package wallet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrLaunchTokenInvalid  = errors.New("launch token invalid or expired")
+	ErrLaunchTokenReplayed = errors.New("launch token already used")
+)
+
+// OperationLaunchReplay is the audit operation of a rejected launch token replay.
+const OperationLaunchReplay = "launch_replay"
+
+type launchTokenRecord struct {
+	Claims   SessionClaims `json:"claims"`
+	IssuedAt int64         `json:"issued_at"`
+}
+
+type launchTokenUse struct {
+	SessionID  string `json:"session_id"`
+	ClientID   int64  `json:"client_id"`
+	PlayerID   string `json:"player_id"`
+	ConsumedAt int64  `json:"consumed_at"`
+}
+
+// The launch token and its used marker share a hash tag, so that consumeLaunchToken can
+// touch both in one script on Redis Cluster.
+func launchTokenKey(token string) string {
+
+	return fmt.Sprintf("%s:{%s}", KeyFamilyLaunch, token)
+}
+
+func launchTokenUsedKey(token string) string {
+
+	return fmt.Sprintf("%s:{%s}", KeyFamilyLaunchUsed, token)
+}
+
+func legacyLaunchTokenKey(token string) string {
+
+	return fmt.Sprintf("%s:%s", KeyFamilyLaunch, token)
+}
+
+// consumeLaunchTokenScript deletes the launch token in KEYS[1] and marks it used in
+// KEYS[2] in one step, returning {1, record, remaining ttl in ms}. A missing token returns
+// {0, used marker}, where the marker is empty when the token never existed or expired.
+var consumeLaunchTokenScript = redis.NewScript(`
+local data = redis.call("GET", KEYS[1])
+if not data then
+	return {0, redis.call("GET", KEYS[2]) or ""}
+end
+local ttl = redis.call("PTTL", KEYS[1])
+redis.call("DEL", KEYS[1])
+redis.call("SET", KEYS[2], ARGV[1], "PX", ARGV[2])
+return {1, data, ttl}
+`)
+
+// IssueLaunchToken creates a short-lived, single-use token to embed in a game launch URL.
+// The game exchanges it for a session token with ExchangeLaunchToken. A ttl of zero uses
+// the KeyFamilyLaunch TTL of the key space; a negative ttl is rejected.
+func (s *SessionStore) IssueLaunchToken(ctx context.Context, claims SessionClaims, ttl time.Duration) (string, error) {
+
+	if s.Redis == nil {
+
+		return "", fmt.Errorf("launch tokens require a redis connection")
+	}
+
+	if ttl < 0 {
+
+		return "", fmt.Errorf("launch token ttl %v is negative", ttl)
+	}
+
+	if ttl == 0 {
+
+		ttl = s.KeySpace.TTL(KeyFamilyLaunch)
+	}
+
+	record, err := json.Marshal(launchTokenRecord{Claims: claims, IssuedAt: time.Now().Unix()})
+	if err != nil {
+
+		return "", err
+	}
+
+	token := uuid.New().String()
+
+	err = setRedisKeyWithTTL(s.Redis, s.KeySpace, launchTokenKey(token), string(record), ttl, s.log(), ctx)
+	if err != nil {
+
+		return "", err
+	}
+
+	return token, nil
+}
+
+// ExchangeLaunchToken atomically consumes launchToken and returns a new game session token
+// with its claims. The token is marked used in the same step, so a second exchange of
+// the same launch token fails with ErrLaunchTokenReplayed and is logged and audited as a
+// replay attempt. If the session cannot be issued, the launch token is restored.
+func (s *SessionStore) ExchangeLaunchToken(ctx context.Context, launchToken string) (string, *SessionClaims, error) {
+
+	if s.Redis == nil {
+
+		return "", nil, fmt.Errorf("launch tokens require a redis connection")
+	}
+
+	data, ttl, err := s.consumeLaunchToken(ctx, launchToken)
+	if err != nil {
+
+		return "", nil, err
+	}
+
+	record := new(launchTokenRecord)
+	err = json.Unmarshal([]byte(data), record)
+	if err != nil {
+
+		return "", nil, ErrLaunchTokenInvalid
+	}
+
+	claims := record.Claims
+	claims.SessionID = ""
+	claims.IssuedAt = 0
+	claims.ExpiresAt = 0
+
+	sessionToken, err := s.Issue(ctx, claims)
+	if err != nil {
+
+		s.restoreLaunchToken(ctx, launchToken, data, ttl)
+		return "", nil, err
+	}
+
+	if s.Mode == TokenModeRedis {
+
+		claims.SessionID = sessionToken
+
+	} else {
+
+		signed, err := s.Signer.Verify(sessionToken)
+		if err != nil {
+
+			return "", nil, err
+		}
+
+		claims = *signed
+	}
+
+	use, _ := json.Marshal(launchTokenUse{SessionID: claims.SessionID, ClientID: claims.ClientID, PlayerID: claims.PlayerID, ConsumedAt: time.Now().Unix()})
+
+	err = s.Redis.SetArgs(ctx, s.KeySpace.Key(launchTokenUsedKey(launchToken)), string(use), redis.SetArgs{Mode: "XX", KeepTTL: true}).Err()
+	if err != nil && !errors.Is(err, redis.Nil) {
+
+		s.log().Error(ctx, "error recording launch token use", err, LogFields{
+			LogFieldPlayerID: claims.PlayerID,
+		})
+	}
+
+	return sessionToken, &claims, nil
+}
+
+// consumeLaunchToken deletes launchToken and marks it used, returning its record and
+// remaining lifetime. Tokens issued before the keys were hash tagged are consumed from
+// their legacy key.
+func (s *SessionStore) consumeLaunchToken(ctx context.Context, launchToken string) (string, time.Duration, error) {
+
+	marker, _ := json.Marshal(launchTokenUse{ConsumedAt: time.Now().Unix()})
+	usedTTL := s.KeySpace.TTL(KeyFamilyLaunchUsed)
+
+	keys := []string{s.KeySpace.Key(launchTokenKey(launchToken)), s.KeySpace.Key(launchTokenUsedKey(launchToken))}
+
+	result, err := consumeLaunchTokenScript.Run(ctx, s.Redis, keys, string(marker), usedTTL.Milliseconds()).Slice()
+	if err != nil {
+
+		return "", 0, fmt.Errorf("error consuming launch token: %w", err)
+	}
+
+	if len(result) == 3 && result[0] == int64(1) {
+
+		data, _ := result[1].(string)
+		ttl, _ := result[2].(int64)
+		return data, time.Duration(ttl) * time.Millisecond, nil
+	}
+
+	used, _ := result[1].(string)
+	if len(used) > 0 {
+
+		s.replayed(ctx, used)
+		return "", 0, ErrLaunchTokenReplayed
+	}
+
+	data, err := GetDelRedisKey(s.Redis, s.KeySpace, legacyLaunchTokenKey(launchToken), ctx)
+	if err != nil {
+
+		if errors.Is(err, redis.Nil) {
+
+			return "", 0, ErrLaunchTokenInvalid
+		}
+
+		return "", 0, err
+	}
+
+	err = setRedisKeyWithTTL(s.Redis, s.KeySpace, launchTokenUsedKey(launchToken), string(marker), usedTTL, s.log(), ctx)
+	if err != nil {
+
+		s.log().Error(ctx, "error recording launch token use", err, nil)
+	}
+
+	return data, s.KeySpace.TTL(KeyFamilyLaunch), nil
+}
+
+// restoreLaunchToken puts back a launch token consumed by an exchange that failed, so the
+// game can retry it.
+func (s *SessionStore) restoreLaunchToken(ctx context.Context, launchToken string, data string, ttl time.Duration) {
+
+	if ttl <= 0 {
+
+		ttl = s.KeySpace.TTL(KeyFamilyLaunch)
+	}
+
+	_, err := s.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+
+		pipe.Set(ctx, s.KeySpace.Key(launchTokenKey(launchToken)), data, ttl)
+		pipe.Del(ctx, s.KeySpace.Key(launchTokenUsedKey(launchToken)))
+		return nil
+	})
+	if err != nil {
+
+		s.log().Error(ctx, "error restoring launch token", err, nil)
+	}
+}
+
+// replayed logs and audits a replay of a launch token whose use is recorded in used.
+func (s *SessionStore) replayed(ctx context.Context, used string) {
+
+	use := new(launchTokenUse)
+	_ = json.Unmarshal([]byte(used), use)
+
+	s.log().Warn(ctx, ErrLaunchTokenReplayed.Error(), LogFields{
+		"description":    "launch token replay attempt",
+		"audit":          true,
+		LogFieldPlayerID: use.PlayerID,
+		"session_id":     use.SessionID,
+		"consumed_at":    time.Unix(use.ConsumedAt, 0).UTC(),
+	})
+
+	if s.Audit == nil {
+
+		return
+	}
+
+	now := time.Now()
+
+	err := s.Audit.Record(ctx, AuditRecord{
+		Operation:   OperationLaunchReplay,
+		Actor:       "session-store",
+		ClientID:    use.ClientID,
+		PlayerID:    use.PlayerID,
+		SessionID:   use.SessionID,
+		Result:      "replayed",
+		Error:       ErrLaunchTokenReplayed.Error(),
+		StartedAt:   now,
+		CompletedAt: now,
+	})
+	if err != nil {
+
+		s.log().Error(ctx, "error writing audit record", err, nil)
+	}
+}
@@ -0,0 +1,121 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIssueLaunchTokenTTL(t *testing.T) {
+
+	server, conn := newTestRedis(t)
+	ctx := context.Background()
+
+	signer, err := NewTokenSigner(hmacKey("k1"))
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	store := &SessionStore{Mode: TokenModeSigned, Redis: conn, KeySpace: KeySpace{Prefix: "test"}, Signer: signer}
+
+	token, err := store.IssueLaunchToken(ctx, SessionClaims{PlayerID: "p1", ClientID: 7}, 500*time.Millisecond)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	ttl := server.TTL(store.KeySpace.Key(launchTokenKey(token)))
+	if ttl <= 0 || ttl > 500*time.Millisecond {
+
+		t.Fatalf("sub-second launch token TTL = %v, want 500ms", ttl)
+	}
+
+	_, err = store.IssueLaunchToken(ctx, SessionClaims{PlayerID: "p1"}, -time.Second)
+	if err == nil {
+
+		t.Fatal("negative ttl accepted")
+	}
+
+	_, claims, err := store.ExchangeLaunchToken(ctx, token)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	if claims.PlayerID != "p1" || claims.ClientID != 7 {
+
+		t.Fatalf("exchanged claims = %+v", claims)
+	}
+
+	_, _, err = store.ExchangeLaunchToken(ctx, token)
+	if !errors.Is(err, ErrLaunchTokenReplayed) {
+
+		t.Fatalf("second exchange = %v, want ErrLaunchTokenReplayed", err)
+	}
+}
+
+// auditRecords is an AuditSink keeping records in memory.
+type auditRecords []AuditRecord
+
+func (a *auditRecords) Record(ctx context.Context, record AuditRecord) error {
+
+	*a = append(*a, record)
+	return nil
+}
+
+func TestExchangeLaunchTokenRestoresAndAuditsReplay(t *testing.T) {
+
+	_, conn := newTestRedis(t)
+	ctx := context.Background()
+
+	signer, err := NewTokenSigner(hmacKey("k1"))
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	audit := new(auditRecords)
+	store := &SessionStore{Mode: TokenModeSigned, Redis: conn, KeySpace: KeySpace{Prefix: "test"}, Signer: signer, Audit: audit}
+
+	token, err := store.IssueLaunchToken(ctx, SessionClaims{PlayerID: "p1", ClientID: 7}, 0)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	// A session that cannot be issued must not burn the launch token.
+	store.Signer = nil
+
+	_, _, err = store.ExchangeLaunchToken(ctx, token)
+	if err == nil {
+
+		t.Fatal("exchange without a signer succeeded")
+	}
+
+	store.Signer = signer
+
+	_, claims, err := store.ExchangeLaunchToken(ctx, token)
+	if err != nil {
+
+		t.Fatalf("exchange after a failed one = %v", err)
+	}
+
+	_, _, err = store.ExchangeLaunchToken(ctx, token)
+	if !errors.Is(err, ErrLaunchTokenReplayed) {
+
+		t.Fatalf("replay = %v, want ErrLaunchTokenReplayed", err)
+	}
+
+	if len(*audit) != 1 {
+
+		t.Fatalf("%d audit records, want 1", len(*audit))
+	}
+
+	record := (*audit)[0]
+	if record.Operation != OperationLaunchReplay || record.PlayerID != "p1" || record.ClientID != 7 || record.SessionID != claims.SessionID {
+
+		t.Fatalf("replay audit record = %+v", record)
+	}
+}
@@ -0,0 +1,272 @@
+package wallet
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrLaunchURLSignature = errors.New("launch url signature mismatch")
+	ErrLaunchURLExpired   = errors.New("launch url expired")
+)
+
+// launchURLClockSkew is how far in the future a launch URL timestamp may be, to allow for
+// clocks of the wallet and the game drifting apart.
+const launchURLClockSkew = 30 * time.Second
+
+// Game is a game catalog entry as needed to launch it.
+type Game struct {
+	ID            string
+	Name          string
+	LaunchURL     string
+	DemoSupported bool
+}
+
+// LaunchParameterNames maps each launch parameter to the query parameter name an operator
+// expects. Empty fields fall back to DefaultLaunchParameterNames.
+type LaunchParameterNames struct {
+	Token      string
+	ClientID   string
+	GameID     string
+	Language   string
+	Currency   string
+	LobbyURL   string
+	CashierURL string
+	Demo       string
+	Timestamp  string
+	Signature  string
+}
+
+func DefaultLaunchParameterNames() LaunchParameterNames {
+
+	return LaunchParameterNames{
+		Token:      "token",
+		ClientID:   "operator",
+		GameID:     "game",
+		Language:   "lang",
+		Currency:   "currency",
+		LobbyURL:   "lobby_url",
+		CashierURL: "cashier_url",
+		Demo:       "demo",
+		Timestamp:  "ts",
+		Signature:  "sig",
+	}
+}
+
+func (n LaunchParameterNames) withDefaults() LaunchParameterNames {
+
+	d := DefaultLaunchParameterNames()
+
+	pick := func(v, def string) string {
+
+		if len(v) > 0 {
+
+			return v
+		}
+
+		return def
+	}
+
+	return LaunchParameterNames{
+		Token:      pick(n.Token, d.Token),
+		ClientID:   pick(n.ClientID, d.ClientID),
+		GameID:     pick(n.GameID, d.GameID),
+		Language:   pick(n.Language, d.Language),
+		Currency:   pick(n.Currency, d.Currency),
+		LobbyURL:   pick(n.LobbyURL, d.LobbyURL),
+		CashierURL: pick(n.CashierURL, d.CashierURL),
+		Demo:       pick(n.Demo, d.Demo),
+		Timestamp:  pick(n.Timestamp, d.Timestamp),
+		Signature:  pick(n.Signature, d.Signature),
+	}
+}
+
+// reserved returns the set of query parameter names carrying launch parameters.
+func (n LaunchParameterNames) reserved() map[string]bool {
+
+	return map[string]bool{
+		n.Token: true, n.ClientID: true, n.GameID: true, n.Language: true,
+		n.Currency: true, n.LobbyURL: true, n.CashierURL: true, n.Demo: true,
+		n.Timestamp: true, n.Signature: true,
+	}
+}
+
+// LaunchParameters are the values carried by a launch URL. Extra may not use the name of
+// a launch parameter.
+type LaunchParameters struct {
+	Token      string
+	ClientID   int64
+	GameID     string
+	Language   string
+	Currency   string
+	LobbyURL   string
+	CashierURL string
+	Demo       bool
+	Timestamp  time.Time
+	Extra      map[string]string
+}
+
+// LaunchURLBuilder builds signed launch URLs for one operator and game. Secret is shared
+// with the game, which checks it with ParseLaunchURL.
+type LaunchURLBuilder struct {
+	Client Client
+	Game   Game
+	Secret []byte
+	Names  LaunchParameterNames
+}
+
+// Build returns the game's launch URL carrying the session token from params, signed with
+// the builder secret. ClientID, GameID and Timestamp are taken from the builder. Extra
+// parameters named like a launch parameter are rejected, as an empty launch parameter
+// would leave them in its place.
+func (b *LaunchURLBuilder) Build(params LaunchParameters) (string, error) {
+
+	if len(b.Secret) == 0 {
+
+		return "", fmt.Errorf("launch url builder has no secret")
+	}
+
+	if params.Demo && !b.Game.DemoSupported {
+
+		return "", fmt.Errorf("game %s does not support demo mode", b.Game.ID)
+	}
+
+	if !params.Demo && len(params.Token) == 0 {
+
+		return "", fmt.Errorf("launch token is required outside demo mode")
+	}
+
+	base, err := url.Parse(b.Game.LaunchURL)
+	if err != nil {
+
+		return "", fmt.Errorf("invalid launch url for game %s: %v", b.Game.ID, err)
+	}
+
+	names := b.Names.withDefaults()
+	reserved := names.reserved()
+	query := base.Query()
+
+	for k, v := range params.Extra {
+
+		if reserved[k] {
+
+			return "", fmt.Errorf("extra launch parameter %s is reserved", k)
+		}
+
+		query.Set(k, v)
+	}
+
+	set := func(name, value string) {
+
+		if len(value) > 0 {
+
+			query.Set(name, value)
+		}
+	}
+
+	set(names.Token, params.Token)
+	set(names.ClientID, strconv.FormatInt(b.Client.ID, 10))
+	set(names.GameID, b.Game.ID)
+	set(names.Language, params.Language)
+	set(names.Currency, params.Currency)
+	set(names.LobbyURL, params.LobbyURL)
+	set(names.CashierURL, params.CashierURL)
+	set(names.Demo, strconv.FormatBool(params.Demo))
+	set(names.Timestamp, strconv.FormatInt(time.Now().Unix(), 10))
+
+	query.Del(names.Signature)
+	query.Set(names.Signature, signLaunchQuery(b.Secret, query))
+
+	base.RawQuery = query.Encode()
+	return base.String(), nil
+}
+
+// signLaunchQuery signs the encoded query without the signature parameter. url.Values.Encode
+// sorts by key, so the result does not depend on parameter order.
+func signLaunchQuery(secret []byte, query url.Values) string {
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(query.Encode()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ParseLaunchURL validates the signature of a launch URL built by LaunchURLBuilder and
+// returns its parameters. URLs older than maxAge are rejected; a maxAge of zero disables
+// the check. URLs dated in the future are always rejected.
+func ParseLaunchURL(raw string, secret []byte, names LaunchParameterNames, maxAge time.Duration) (*LaunchParameters, error) {
+
+	if len(secret) == 0 {
+
+		return nil, fmt.Errorf("launch url secret is empty")
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+
+		return nil, fmt.Errorf("invalid launch url: %v", err)
+	}
+
+	names = names.withDefaults()
+	query := u.Query()
+
+	signature := query.Get(names.Signature)
+	query.Del(names.Signature)
+
+	expected := signLaunchQuery(secret, query)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+
+		return nil, ErrLaunchURLSignature
+	}
+
+	ts, err := strconv.ParseInt(query.Get(names.Timestamp), 10, 64)
+	if err != nil {
+
+		return nil, fmt.Errorf("invalid launch url timestamp: %v", err)
+	}
+
+	params := &LaunchParameters{
+		Token:      query.Get(names.Token),
+		GameID:     query.Get(names.GameID),
+		Language:   query.Get(names.Language),
+		Currency:   query.Get(names.Currency),
+		LobbyURL:   query.Get(names.LobbyURL),
+		CashierURL: query.Get(names.CashierURL),
+		Demo:       query.Get(names.Demo) == "true",
+		Timestamp:  time.Unix(ts, 0),
+		Extra:      make(map[string]string),
+	}
+
+	if time.Until(params.Timestamp) > launchURLClockSkew {
+
+		return nil, fmt.Errorf("launch url timestamp %v is in the future", params.Timestamp.UTC())
+	}
+
+	if maxAge > 0 && time.Since(params.Timestamp) > maxAge {
+
+		return nil, ErrLaunchURLExpired
+	}
+
+	params.ClientID, err = strconv.ParseInt(query.Get(names.ClientID), 10, 64)
+	if err != nil {
+
+		return nil, fmt.Errorf("invalid launch url operator: %v", err)
+	}
+
+	known := names.reserved()
+
+	for k := range query {
+
+		if !known[k] {
+
+			params.Extra[k] = query.Get(k)
+		}
+	}
+
+	return params, nil
+}
@@ -0,0 +1,58 @@
+package wallet
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLaunchURLReservedExtra(t *testing.T) {
+
+	b := &LaunchURLBuilder{
+		Client: Client{ID: 7},
+		Game:   Game{ID: "g1", LaunchURL: "https://game.example/launch"},
+		Secret: []byte("secret"),
+	}
+
+	_, err := b.Build(LaunchParameters{Token: "t1", Extra: map[string]string{"lang": "fr"}})
+	if err == nil {
+
+		t.Fatal("extra parameter named like the language accepted")
+	}
+
+	raw, err := b.Build(LaunchParameters{Token: "t1", Extra: map[string]string{"skin": "dark"}})
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	params, err := ParseLaunchURL(raw, b.Secret, LaunchParameterNames{}, time.Minute)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	if params.Extra["skin"] != "dark" || params.Token != "t1" || params.ClientID != 7 {
+
+		t.Fatalf("parsed parameters = %+v", params)
+	}
+}
+
+func TestParseLaunchURLFutureTimestamp(t *testing.T) {
+
+	secret := []byte("secret")
+	names := DefaultLaunchParameterNames()
+
+	query := url.Values{}
+	query.Set(names.Token, "t1")
+	query.Set(names.ClientID, "7")
+	query.Set(names.Timestamp, strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+	query.Set(names.Signature, signLaunchQuery(secret, query))
+
+	_, err := ParseLaunchURL("https://game.example/launch?"+query.Encode(), secret, names, time.Minute)
+	if err == nil {
+
+		t.Fatal("launch url dated an hour ahead accepted")
+	}
+}
@@ -0,0 +1,228 @@
+package wallet
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type LogLevel int
+
+const (
+	LogLevelDebug LogLevel = iota
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+)
+
+// Field names shared by every log entry of the package.
+const (
+	LogFieldOperation     = "operation"
+	LogFieldClientID      = "client_id"
+	LogFieldPlayerID      = "player_id"
+	LogFieldRoundID       = "round_id"
+	LogFieldTransactionID = "transaction_id"
+	LogFieldTraceID       = "trace_id"
+	LogFieldError         = "error"
+)
+
+type LogFields map[string]interface{}
+
+// Logger receives the log entries of the wallet, session and client store components.
+// Entries already carry the fields of the operation in ctx and its trace_id.
+type Logger interface {
+	Log(ctx context.Context, level LogLevel, msg string, fields LogFields)
+}
+
+// LogrusLogger writes to Logger, or to the logrus standard logger when it is nil.
+type LogrusLogger struct {
+	Logger *logrus.Logger
+}
+
+func (l LogrusLogger) Log(ctx context.Context, level LogLevel, msg string, fields LogFields) {
+
+	logger := l.Logger
+	if logger == nil {
+
+		logger = logrus.StandardLogger()
+	}
+
+	entry := logger.WithContext(ctx).WithFields(logrus.Fields(fields))
+
+	switch level {
+
+	case LogLevelDebug:
+		entry.Debug(msg)
+
+	case LogLevelInfo:
+		entry.Info(msg)
+
+	case LogLevelWarn:
+		entry.Warn(msg)
+
+	default:
+		entry.Error(msg)
+	}
+}
+
+// SlogLogger writes to Logger, or to slog.Default() when it is nil.
+type SlogLogger struct {
+	Logger *slog.Logger
+}
+
+func (l SlogLogger) Log(ctx context.Context, level LogLevel, msg string, fields LogFields) {
+
+	logger := l.Logger
+	if logger == nil {
+
+		logger = slog.Default()
+	}
+
+	attrs := make([]slog.Attr, 0, len(fields))
+	for k, v := range fields {
+
+		attrs = append(attrs, slog.Any(k, v))
+	}
+
+	var lvl slog.Level
+
+	switch level {
+
+	case LogLevelDebug:
+		lvl = slog.LevelDebug
+
+	case LogLevelInfo:
+		lvl = slog.LevelInfo
+
+	case LogLevelWarn:
+		lvl = slog.LevelWarn
+
+	default:
+		lvl = slog.LevelError
+	}
+
+	logger.LogAttrs(ctx, lvl, msg, attrs...)
+}
+
+type logFieldsKey struct{}
+
+// withLogFields returns a context whose log entries carry fields in addition to those
+// already set on ctx.
+func withLogFields(ctx context.Context, fields LogFields) context.Context {
+
+	merged := LogFields{}
+
+	if parent, ok := ctx.Value(logFieldsKey{}).(LogFields); ok {
+
+		for k, v := range parent {
+
+			merged[k] = v
+		}
+	}
+
+	for k, v := range fields {
+
+		merged[k] = v
+	}
+
+	return context.WithValue(ctx, logFieldsKey{}, merged)
+}
+
+// operationContext tags the log entries of a wallet operation with its business identifiers.
+func operationContext(ctx context.Context, operation string, clientID int64, playerID, roundID, transactionID string) context.Context {
+
+	fields := LogFields{
+		LogFieldOperation: operation,
+		LogFieldClientID:  clientID,
+		LogFieldPlayerID:  playerID,
+	}
+
+	if len(roundID) > 0 {
+
+		fields[LogFieldRoundID] = roundID
+	}
+
+	if len(transactionID) > 0 {
+
+		fields[LogFieldTransactionID] = transactionID
+	}
+
+	return withLogFields(ctx, fields)
+}
+
+// contextLogger adds the fields of the context to every entry sent to a Logger.
+type contextLogger struct {
+	logger Logger
+}
+
+// logTo returns a contextLogger for l, logging through logrus when l is nil as the
+// package always has.
+func logTo(l Logger) contextLogger {
+
+	if l == nil {
+
+		l = LogrusLogger{}
+	}
+
+	return contextLogger{logger: l}
+}
+
+func (c contextLogger) log(ctx context.Context, level LogLevel, msg string, fields LogFields) {
+
+	entry := LogFields{}
+
+	if parent, ok := ctx.Value(logFieldsKey{}).(LogFields); ok {
+
+		for k, v := range parent {
+
+			entry[k] = v
+		}
+	}
+
+	spanContext := trace.SpanContextFromContext(ctx)
+	if spanContext.HasTraceID() {
+
+		entry[LogFieldTraceID] = spanContext.TraceID().String()
+	}
+
+	for k, v := range fields {
+
+		entry[k] = v
+	}
+
+	c.logger.Log(ctx, level, msg, entry)
+}
+
+func (c contextLogger) Debug(ctx context.Context, msg string, fields LogFields) {
+
+	c.log(ctx, LogLevelDebug, msg, fields)
+}
+
+func (c contextLogger) Info(ctx context.Context, msg string, fields LogFields) {
+
+	c.log(ctx, LogLevelInfo, msg, fields)
+}
+
+func (c contextLogger) Warn(ctx context.Context, msg string, fields LogFields) {
+
+	c.log(ctx, LogLevelWarn, msg, fields)
+}
+
+// Error logs msg with err in the error field.
+func (c contextLogger) Error(ctx context.Context, msg string, err error, fields LogFields) {
+
+	entry := LogFields{}
+	for k, v := range fields {
+
+		entry[k] = v
+	}
+
+	if err != nil {
+
+		entry[LogFieldError] = err.Error()
+	}
+
+	c.log(ctx, LogLevelError, msg, entry)
+}
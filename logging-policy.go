@@ -0,0 +1,165 @@
+package wallet
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const redactedValue = "[REDACTED]"
+
+// LoggingPolicy controls what HTTPPost writes about each operator call. Fields and headers
+// are matched case-insensitively. Failed calls are always logged with the complete (but
+// still redacted) payloads; successful calls are logged for SuccessSampleRate of calls,
+// with payloads truncated to MaxBodyBytes.
+type LoggingPolicy struct {
+	RedactFields      []string
+	LoggedHeaders     []string
+	MaxBodyBytes      int
+	SuccessSampleRate float64
+}
+
+// DefaultLoggingPolicy redacts player names, contact details and tokens, logs only
+// non-secret headers, keeps 4KB of each payload and logs every successful call.
+func DefaultLoggingPolicy() LoggingPolicy {
+
+	return LoggingPolicy{
+		RedactFields: []string{
+			"display_name", "name", "first_name", "last_name", "email", "phone", "msisdn",
+			"token", "access_token", "refresh_token", "password", "secret",
+		},
+		LoggedHeaders: []string{
+			"Content-Type", "Accept", "User-Agent", "span-id", "trace-id", "traceparent", "tracestate",
+		},
+		MaxBodyBytes:      4096,
+		SuccessSampleRate: 1,
+	}
+}
+
+func (p LoggingPolicy) sampleSuccess() bool {
+
+	if p.SuccessSampleRate >= 1 {
+
+		return true
+	}
+
+	return p.SuccessSampleRate > 0 && rand.Float64() < p.SuccessSampleRate
+}
+
+func (p LoggingPolicy) redactField(name string) bool {
+
+	for _, f := range p.RedactFields {
+
+		if strings.EqualFold(f, name) {
+
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p LoggingPolicy) redact(v interface{}) interface{} {
+
+	switch value := v.(type) {
+
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(value))
+		for k, item := range value {
+
+			if p.redactField(k) {
+
+				out[k] = redactedValue
+				continue
+			}
+
+			out[k] = p.redact(item)
+		}
+
+		return out
+
+	case []interface{}:
+		out := make([]interface{}, len(value))
+		for i, item := range value {
+
+			out[i] = p.redact(item)
+		}
+
+		return out
+	}
+
+	return v
+}
+
+// body returns the loggable form of a JSON payload: decoded and redacted, or as a string
+// when it is not JSON. Unless full is set, payloads longer than MaxBodyBytes are cut.
+func (p LoggingPolicy) body(data []byte, full bool) interface{} {
+
+	var decoded interface{}
+
+	err := json.Unmarshal(data, &decoded)
+	if err == nil {
+
+		decoded = p.redact(decoded)
+
+		if full || p.MaxBodyBytes <= 0 {
+
+			return decoded
+		}
+
+		encoded, err := json.Marshal(decoded)
+		if err == nil && len(encoded) <= p.MaxBodyBytes {
+
+			return decoded
+		}
+
+		return truncate(string(encoded), p.MaxBodyBytes)
+	}
+
+	if full || p.MaxBodyBytes <= 0 {
+
+		return string(data)
+	}
+
+	return truncate(string(data), p.MaxBodyBytes)
+}
+
+func (p LoggingPolicy) headers(h http.Header) map[string]string {
+
+	out := make(map[string]string, len(h))
+
+	for name := range h {
+
+		out[name] = redactedValue
+
+		for _, logged := range p.LoggedHeaders {
+
+			if strings.EqualFold(logged, name) {
+
+				out[name] = h.Get(name)
+				break
+			}
+		}
+	}
+
+	return out
+}
+
+// truncate cuts s to at most max bytes, backing up to the start of a rune so that a
+// multi-byte character is not split.
+func truncate(s string, max int) string {
+
+	if len(s) <= max {
+
+		return s
+	}
+
+	for max > 0 && !utf8.RuneStart(s[max]) {
+
+		max--
+	}
+
+	return s[:max] + "...(truncated)"
+}
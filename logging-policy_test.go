@@ -0,0 +1,26 @@
+package wallet
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateKeepsRunes(t *testing.T) {
+
+	s := strings.Repeat("é", 10)
+
+	for max := 0; max < len(s); max++ {
+
+		got := truncate(s, max)
+		if !utf8.ValidString(got) {
+
+			t.Fatalf("truncate(%d) = %q, not valid UTF-8", max, got)
+		}
+	}
+
+	if got := truncate("abc", 3); got != "abc" {
+
+		t.Fatalf("truncate of a short string = %q", got)
+	}
+}
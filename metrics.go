@@ -0,0 +1,170 @@
+package wallet
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const meterName = "github.com/touchvas/casino-wallet"
+
+const (
+	OperationProfile    = "profile"
+	OperationDebit      = "debit"
+	OperationCredit     = "credit"
+	OperationSettlement = "settlement"
+	OperationAdjustment = "adjustment"
+	OperationRollback   = "rollback"
+)
+
+// Outcome codes used as the error_code metric label.
+const (
+	OutcomeSuccess           = "success"
+	OutcomeInsufficientFunds = "insufficient_funds"
+	OutcomeDuplicate         = "duplicate"
+	OutcomeError             = "error"
+)
+
+// WalletMetrics records wallet operations and the HTTP calls they make through the
+// instruments of a caller supplied MeterProvider. A nil *WalletMetrics records nothing.
+type WalletMetrics struct {
+	operationDuration metric.Float64Histogram
+	operations        metric.Int64Counter
+	inflight          metric.Int64UpDownCounter
+	httpDuration      metric.Float64Histogram
+	retries           metric.Int64Counter
+}
+
+func NewWalletMetrics(mp metric.MeterProvider) (*WalletMetrics, error) {
+
+	if mp == nil {
+
+		return nil, fmt.Errorf("wallet metrics require a meter provider")
+	}
+
+	meter := mp.Meter(meterName)
+	m := new(WalletMetrics)
+	var err error
+
+	m.operationDuration, err = meter.Float64Histogram("wallet.operation.duration",
+		metric.WithDescription("Duration of wallet operations sent to operators"),
+		metric.WithUnit("s"))
+	if err != nil {
+
+		return nil, err
+	}
+
+	m.operations, err = meter.Int64Counter("wallet.operation.requests",
+		metric.WithDescription("Wallet operations by outcome"),
+		metric.WithUnit("{request}"))
+	if err != nil {
+
+		return nil, err
+	}
+
+	m.inflight, err = meter.Int64UpDownCounter("wallet.operation.inflight",
+		metric.WithDescription("Wallet operations currently waiting on an operator"),
+		metric.WithUnit("{request}"))
+	if err != nil {
+
+		return nil, err
+	}
+
+	m.httpDuration, err = meter.Float64Histogram("wallet.http.duration",
+		metric.WithDescription("Duration of individual HTTP calls to operators"),
+		metric.WithUnit("s"))
+	if err != nil {
+
+		return nil, err
+	}
+
+	m.retries, err = meter.Int64Counter("wallet.http.retries",
+		metric.WithDescription("HTTP calls repeated with a fallback credential"),
+		metric.WithUnit("{request}"))
+	if err != nil {
+
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// begin marks an operation in flight and returns the function that completes it.
+func (m *WalletMetrics) begin(ctx context.Context, operation string, clientID int64) func(status int64, err error) {
+
+	if m == nil {
+
+		return func(int64, error) {}
+	}
+
+	attrs := []attribute.KeyValue{
+		attribute.String("operation", operation),
+		attribute.Int64("client_id", clientID),
+	}
+
+	started := time.Now()
+	m.inflight.Add(ctx, 1, metric.WithAttributes(attrs...))
+
+	return func(status int64, err error) {
+
+		m.inflight.Add(ctx, -1, metric.WithAttributes(attrs...))
+
+		attrs := append(attrs, attribute.String("error_code", outcomeCode(status, err)))
+		m.operationDuration.Record(ctx, time.Since(started).Seconds(), metric.WithAttributes(attrs...))
+		m.operations.Add(ctx, 1, metric.WithAttributes(attrs...))
+	}
+}
+
+func (m *WalletMetrics) recordHTTP(ctx context.Context, operation string, clientID int64, status int, elapsed time.Duration, retry bool) {
+
+	if m == nil {
+
+		return
+	}
+
+	attrs := metric.WithAttributes(
+		attribute.String("operation", operation),
+		attribute.Int64("client_id", clientID),
+		attribute.String("http_status_class", statusClass(status)),
+	)
+
+	m.httpDuration.Record(ctx, elapsed.Seconds(), attrs)
+
+	if retry {
+
+		m.retries.Add(ctx, 1, attrs)
+	}
+}
+
+// outcomeCode maps the Status of a transaction response, or the error, to an outcome.
+func outcomeCode(status int64, err error) string {
+
+	if err != nil {
+
+		return OutcomeError
+	}
+
+	switch status {
+
+	case 402:
+		return OutcomeInsufficientFunds
+
+	case 409:
+		return OutcomeDuplicate
+	}
+
+	return OutcomeSuccess
+}
+
+func statusClass(status int) string {
+
+	if status < 100 || status > 599 {
+
+		return "none"
+	}
+
+	return fmt.Sprintf("%dxx", status/100)
+}
@@ -0,0 +1,314 @@
+package wallet
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+const migrationsTable = "wallet_schema_migrations"
+
+// migrationLockID is the Postgres advisory lock key held while migrating.
+const migrationLockID int64 = 0x77616c6c6574
+
+// migrationLockTimeout is how long MySQL waits for another process's migration to finish.
+const migrationLockTimeout = 5 * time.Minute
+
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// Migrate applies the library's pending schema migrations to db, detecting the dialect
+// from the registered driver. Use MigrateDialect when the driver is not recognised.
+func Migrate(ctx context.Context, db *sql.DB) error {
+
+	dialect, err := DetectDialect(db)
+	if err != nil {
+
+		return err
+	}
+
+	return MigrateDialect(ctx, db, dialect)
+}
+
+// DetectDialect guesses the dialect of db from the type name of its driver.
+func DetectDialect(db *sql.DB) (Dialect, error) {
+
+	driver := strings.ToLower(fmt.Sprintf("%T", db.Driver()))
+
+	switch {
+
+	case strings.Contains(driver, "mysql"):
+		return DialectMySQL, nil
+
+	case strings.Contains(driver, "pq."), strings.Contains(driver, "pgx"), strings.Contains(driver, "stdlib."):
+		return DialectPostgres, nil
+
+	case strings.Contains(driver, "sqlite"):
+		return DialectSQLite, nil
+	}
+
+	return "", fmt.Errorf("cannot detect sql dialect of driver %s", driver)
+}
+
+// MigrateDialect applies every embedded migration of dialect that is not yet recorded in
+// the wallet_schema_migrations table, in version order. On MySQL and Postgres it holds a
+// database lock while it runs, so services starting together apply each migration once.
+func MigrateDialect(ctx context.Context, db *sql.DB, dialect Dialect) error {
+
+	return migrateDialect(ctx, db, dialect, logTo(nil))
+}
+
+// Migrate applies the pending schema migrations to the store's database, logging to the
+// store's Logger.
+func (s *ClientStore) Migrate(ctx context.Context) error {
+
+	return migrateDialect(ctx, s.DB, s.Dialect, s.log())
+}
+
+func migrateDialect(ctx context.Context, db *sql.DB, dialect Dialect, log contextLogger) error {
+
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+
+		return err
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+
+		return err
+	}
+
+	defer conn.Close()
+
+	unlock, err := lockMigrations(ctx, conn, dialect)
+	if err != nil {
+
+		return err
+	}
+
+	defer unlock()
+
+	_, err = conn.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version INTEGER NOT NULL PRIMARY KEY, name VARCHAR(255) NOT NULL, applied_at VARCHAR(64) NOT NULL)", migrationsTable))
+	if err != nil {
+
+		return fmt.Errorf("error creating %s: %v", migrationsTable, err)
+	}
+
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+
+		return err
+	}
+
+	for _, m := range migrations {
+
+		if applied[m.version] {
+
+			continue
+		}
+
+		err = applyMigration(ctx, conn, dialect, m)
+		if err != nil {
+
+			return fmt.Errorf("migration %04d_%s failed: %v", m.version, m.name, err)
+		}
+
+		log.Info(ctx, "migration applied", LogFields{
+			"description": "applied schema migration",
+			"version":     m.version,
+			"name":        m.name,
+		})
+	}
+
+	return nil
+}
+
+// lockMigrations takes the migration lock of dialect on conn and returns the function that
+// releases it. SQLite has no such lock; its databases are not shared between services.
+func lockMigrations(ctx context.Context, conn *sql.Conn, dialect Dialect) (func(), error) {
+
+	switch dialect {
+
+	case DialectMySQL:
+		var locked sql.NullInt64
+		err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", migrationsTable, int(migrationLockTimeout/time.Second)).Scan(&locked)
+		if err != nil {
+
+			return nil, fmt.Errorf("error taking the migration lock: %v", err)
+		}
+
+		if locked.Int64 != 1 {
+
+			return nil, fmt.Errorf("timed out waiting for the migration lock held by another process")
+		}
+
+		return func() {
+
+			conn.ExecContext(context.Background(), "DO RELEASE_LOCK(?)", migrationsTable)
+		}, nil
+
+	case DialectPostgres:
+		_, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID)
+		if err != nil {
+
+			return nil, fmt.Errorf("error taking the migration lock: %v", err)
+		}
+
+		return func() {
+
+			conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+		}, nil
+	}
+
+	return func() {}, nil
+}
+
+func loadMigrations(dialect Dialect) ([]migration, error) {
+
+	dir := path.Join("migrations", string(dialect))
+
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+
+		return nil, fmt.Errorf("no migrations for dialect %s", dialect)
+	}
+
+	var migrations []migration
+
+	for _, entry := range entries {
+
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".sql") {
+
+			continue
+		}
+
+		prefix, rest, found := strings.Cut(strings.TrimSuffix(name, ".sql"), "_")
+		version, err := strconv.Atoi(prefix)
+		if !found || err != nil {
+
+			return nil, fmt.Errorf("migration file %s is not named <version>_<name>.sql", name)
+		}
+
+		data, err := migrationFiles.ReadFile(path.Join(dir, name))
+		if err != nil {
+
+			return nil, err
+		}
+
+		migrations = append(migrations, migration{version: version, name: rest, sql: string(data)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+
+		return migrations[i].version < migrations[j].version
+	})
+
+	return migrations, nil
+}
+
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int]bool, error) {
+
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT version FROM %s", migrationsTable))
+	if err != nil {
+
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+
+	for rows.Next() {
+
+		var version int
+		err = rows.Scan(&version)
+		if err != nil {
+
+			return nil, err
+		}
+
+		applied[version] = true
+	}
+
+	return applied, rows.Err()
+}
+
+// applyMigration runs the statements of m and records it in one transaction. MySQL commits
+// DDL implicitly, so a failed MySQL migration may be partially applied; the MySQL
+// migrations check the schema before each change so that they can be run again.
+func applyMigration(ctx context.Context, conn *sql.Conn, dialect Dialect, m migration) error {
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+
+		return err
+	}
+
+	defer tx.Rollback()
+
+	for _, statement := range splitStatements(m.sql) {
+
+		_, err = tx.ExecContext(ctx, statement)
+		if err != nil {
+
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, dialect.Rebind(fmt.Sprintf("INSERT INTO %s (version, name, applied_at) VALUES (?, ?, ?)", migrationsTable)),
+		m.version, m.name, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// splitStatements splits a migration file on semicolons that end a line, since not every
+// driver accepts several statements in one Exec.
+func splitStatements(script string) []string {
+
+	var statements []string
+	var current strings.Builder
+
+	for _, line := range strings.Split(script, "\n") {
+
+		trimmed := strings.TrimSpace(line)
+		if len(trimmed) == 0 || strings.HasPrefix(trimmed, "--") {
+
+			continue
+		}
+
+		current.WriteString(line)
+		current.WriteString("\n")
+
+		if strings.HasSuffix(trimmed, ";") {
+
+			statements = append(statements, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+			current.Reset()
+		}
+	}
+
+	if rest := strings.TrimSpace(current.String()); len(rest) > 0 {
+
+		statements = append(statements, rest)
+	}
+
+	return statements
+}
@@ -0,0 +1,114 @@
+package wallet
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordingLogger keeps the messages it is given.
+type recordingLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) Log(ctx context.Context, level LogLevel, msg string, fields LogFields) {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.messages = append(l.messages, msg)
+}
+
+func TestClientStoreMigrateLogs(t *testing.T) {
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "wallet.db"))
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	logger := &recordingLogger{}
+	store := NewClientStore(noop.NewTracerProvider().Tracer("test"), db, DialectSQLite)
+	store.Logger = logger
+
+	err = store.Migrate(context.Background())
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	migrations, err := loadMigrations(DialectSQLite)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	if len(logger.messages) != len(migrations) {
+
+		t.Fatalf("store logger got %v, want one entry per migration", logger.messages)
+	}
+}
+
+func TestMigrateTwice(t *testing.T) {
+
+	store := newTestClientStore(t)
+
+	err := MigrateDialect(context.Background(), store.DB, DialectSQLite)
+	if err != nil {
+
+		t.Fatalf("second MigrateDialect: %v", err)
+	}
+
+	var count int
+	err = store.DB.QueryRow("SELECT COUNT(*) FROM " + migrationsTable).Scan(&count)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	migrations, err := loadMigrations(DialectSQLite)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	if count != len(migrations) {
+
+		t.Fatalf("%d migrations recorded, want %d", count, len(migrations))
+	}
+}
+
+// The MySQL migrations that alter tables guard each change with a prepared statement, which
+// only works when every statement is split out on its own.
+func TestMySQLMigrationStatements(t *testing.T) {
+
+	migrations, err := loadMigrations(DialectMySQL)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	for _, m := range migrations {
+
+		for _, statement := range splitStatements(m.sql) {
+
+			if strings.Contains(statement, ";") {
+
+				t.Errorf("migration %04d_%s: statement %q was not split", m.version, m.name, statement)
+			}
+
+			if strings.HasPrefix(statement, "ALTER TABLE") {
+
+				t.Errorf("migration %04d_%s: unguarded %q cannot be run again", m.version, m.name, statement)
+			}
+		}
+	}
+}
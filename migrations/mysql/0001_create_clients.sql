@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS clients (
+    account BIGINT NOT NULL,
+    base_url VARCHAR(255) NOT NULL DEFAULT '',
+    authentication_header VARCHAR(128) NOT NULL DEFAULT '',
+    authentication_string TEXT NULL,
+    PRIMARY KEY (account)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
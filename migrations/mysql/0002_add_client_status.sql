@@ -0,0 +1,13 @@
+-- MySQL has no ADD COLUMN IF NOT EXISTS, so each change is skipped when it is already in
+-- place and the migration can be run again after a partial failure.
+SET @ddl = IF((SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = 'clients' AND column_name = 'status') = 0,
+    'ALTER TABLE clients ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT ''active''', 'DO 0');
+PREPARE migration FROM @ddl;
+EXECUTE migration;
+DEALLOCATE PREPARE migration;
+
+SET @ddl = IF((SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = 'clients' AND index_name = 'idx_clients_status') = 0,
+    'CREATE INDEX idx_clients_status ON clients (status)', 'DO 0');
+PREPARE migration FROM @ddl;
+EXECUTE migration;
+DEALLOCATE PREPARE migration;
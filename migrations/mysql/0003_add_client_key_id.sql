@@ -0,0 +1,6 @@
+-- Skipped when the column exists, see 0002.
+SET @ddl = IF((SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = 'clients' AND column_name = 'authentication_key_id') = 0,
+    'ALTER TABLE clients ADD COLUMN authentication_key_id VARCHAR(64) NOT NULL DEFAULT ''''', 'DO 0');
+PREPARE migration FROM @ddl;
+EXECUTE migration;
+DEALLOCATE PREPARE migration;
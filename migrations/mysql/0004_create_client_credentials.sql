@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS client_credentials (
+    id BIGINT NOT NULL AUTO_INCREMENT,
+    account BIGINT NOT NULL,
+    authentication_header VARCHAR(128) NOT NULL DEFAULT '',
+    authentication_string TEXT NULL,
+    authentication_key_id VARCHAR(64) NOT NULL DEFAULT '',
+    state VARCHAR(16) NOT NULL DEFAULT 'staged',
+    is_primary TINYINT(1) NOT NULL DEFAULT 0,
+    valid_from DATETIME NULL,
+    valid_until DATETIME NULL,
+    last_used_at DATETIME NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY idx_client_credentials_account (account)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS clients (
+    account BIGINT NOT NULL PRIMARY KEY,
+    base_url VARCHAR(255) NOT NULL DEFAULT '',
+    authentication_header VARCHAR(128) NOT NULL DEFAULT '',
+    authentication_string TEXT NULL
+);
@@ -0,0 +1 @@
+ALTER TABLE clients ADD COLUMN IF NOT EXISTS authentication_key_id VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS client_credentials (
+    id BIGSERIAL PRIMARY KEY,
+    account BIGINT NOT NULL,
+    authentication_header VARCHAR(128) NOT NULL DEFAULT '',
+    authentication_string TEXT NULL,
+    authentication_key_id VARCHAR(64) NOT NULL DEFAULT '',
+    state VARCHAR(16) NOT NULL DEFAULT 'staged',
+    is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+    valid_from TIMESTAMPTZ NULL,
+    valid_until TIMESTAMPTZ NULL,
+    last_used_at TIMESTAMPTZ NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_client_credentials_account ON client_credentials (account);
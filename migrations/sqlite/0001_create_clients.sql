@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS clients (
+    account INTEGER NOT NULL PRIMARY KEY,
+    base_url TEXT NOT NULL DEFAULT '',
+    authentication_header TEXT NOT NULL DEFAULT '',
+    authentication_string TEXT NULL
+);
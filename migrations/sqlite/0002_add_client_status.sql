@@ -0,0 +1,3 @@
+ALTER TABLE clients ADD COLUMN status TEXT NOT NULL DEFAULT 'active';
+
+CREATE INDEX IF NOT EXISTS idx_clients_status ON clients (status);
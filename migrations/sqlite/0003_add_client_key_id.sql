@@ -0,0 +1 @@
+ALTER TABLE clients ADD COLUMN authentication_key_id TEXT NOT NULL DEFAULT '';
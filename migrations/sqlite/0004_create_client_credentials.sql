@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS client_credentials (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    account INTEGER NOT NULL,
+    authentication_header TEXT NOT NULL DEFAULT '',
+    authentication_string TEXT NULL,
+    authentication_key_id TEXT NOT NULL DEFAULT '',
+    state TEXT NOT NULL DEFAULT 'staged',
+    is_primary BOOLEAN NOT NULL DEFAULT 0,
+    valid_from DATETIME NULL,
+    valid_until DATETIME NULL,
+    last_used_at DATETIME NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_client_credentials_account ON client_credentials (account);
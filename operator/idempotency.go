@@ -0,0 +1,236 @@
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	wallet "github.com/touchvas/casino-wallet"
+)
+
+const (
+	defaultIdempotencyTTL   = 7 * 24 * time.Hour
+	defaultIdempotencyLease = 5 * time.Minute
+)
+
+// Outcome is the answer a Server gave to a transaction, replayed to its duplicates.
+type Outcome struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// IdempotencyEntry is what an IdempotencyStore keeps for a key: the Token of the claim
+// holding it, the Fingerprint of the request that claimed it and, once that request
+// completed, its Outcome.
+type IdempotencyEntry struct {
+	Token       string   `json:"token"`
+	Fingerprint string   `json:"fingerprint"`
+	Outcome     *Outcome `json:"outcome,omitempty"`
+}
+
+// IdempotencyStore remembers the transactions a Server has processed and their outcome.
+type IdempotencyStore interface {
+	// Claim records entry under key and reports whether key was not recorded before. For a
+	// key that was, it returns the recorded entry, whose Outcome is nil while the claiming
+	// request is still in flight.
+	Claim(ctx context.Context, key string, entry IdempotencyEntry) (bool, *IdempotencyEntry, error)
+	// Complete stores entry, now carrying the outcome of its request, for the duplicates
+	// of key.
+	Complete(ctx context.Context, key string, entry IdempotencyEntry) error
+	// Release forgets key if it is still in flight under the claim token, so that a failed
+	// transaction can be retried without dropping the claim of another request.
+	Release(ctx context.Context, key string, token string) error
+}
+
+// MemoryIdempotencyStore keeps keys in process memory, which suits tests and
+// single-instance deployments. Completed keys are kept for TTL and in-flight keys for
+// Lease, after which a request that never completed may be retried.
+type MemoryIdempotencyStore struct {
+	TTL   time.Duration
+	Lease time.Duration
+
+	mu     sync.Mutex
+	keys   map[string]memoryIdempotencyEntry
+	claims int
+}
+
+type memoryIdempotencyEntry struct {
+	entry   IdempotencyEntry
+	expires time.Time
+}
+
+// memorySweepInterval is the number of claims between sweeps of expired keys.
+const memorySweepInterval = 1024
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+
+	return &MemoryIdempotencyStore{
+		TTL:   defaultIdempotencyTTL,
+		Lease: defaultIdempotencyLease,
+		keys:  make(map[string]memoryIdempotencyEntry),
+	}
+}
+
+func (m *MemoryIdempotencyStore) Claim(ctx context.Context, key string, entry IdempotencyEntry) (bool, *IdempotencyEntry, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.keys == nil {
+
+		m.keys = make(map[string]memoryIdempotencyEntry)
+	}
+
+	now := time.Now()
+
+	m.claims++
+	if m.claims >= memorySweepInterval {
+
+		m.claims = 0
+		for k, e := range m.keys {
+
+			if !now.Before(e.expires) {
+
+				delete(m.keys, k)
+			}
+		}
+	}
+
+	if e, ok := m.keys[key]; ok && now.Before(e.expires) {
+
+		recorded := e.entry
+		return false, &recorded, nil
+	}
+
+	m.keys[key] = memoryIdempotencyEntry{entry: entry, expires: now.Add(idempotencyTTL(m.Lease, defaultIdempotencyLease))}
+	return true, nil, nil
+}
+
+func (m *MemoryIdempotencyStore) Complete(ctx context.Context, key string, entry IdempotencyEntry) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.keys == nil {
+
+		m.keys = make(map[string]memoryIdempotencyEntry)
+	}
+
+	m.keys[key] = memoryIdempotencyEntry{entry: entry, expires: time.Now().Add(idempotencyTTL(m.TTL, defaultIdempotencyTTL))}
+	return nil
+}
+
+func (m *MemoryIdempotencyStore) Release(ctx context.Context, key string, token string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e, ok := m.keys[key]; ok && e.entry.Token == token && e.entry.Outcome == nil {
+
+		delete(m.keys, key)
+	}
+
+	return nil
+}
+
+// RedisIdempotencyStore shares keys between the instances of a server. Completed keys are
+// kept for TTL, which should outlive the retries of any game round, and in-flight keys
+// for Lease.
+type RedisIdempotencyStore struct {
+	Redis    redis.UniversalClient
+	KeySpace wallet.KeySpace
+	TTL      time.Duration
+	Lease    time.Duration
+}
+
+func NewRedisIdempotencyStore(redisConn redis.UniversalClient, ks wallet.KeySpace) *RedisIdempotencyStore {
+
+	return &RedisIdempotencyStore{Redis: redisConn, KeySpace: ks, TTL: defaultIdempotencyTTL, Lease: defaultIdempotencyLease}
+}
+
+func (s *RedisIdempotencyStore) key(key string) string {
+
+	return s.KeySpace.Key("idempotency:" + key)
+}
+
+// releaseIdempotencyScript deletes KEYS[1] only while it is in flight under the claim token
+// ARGV[1]. A claim whose lease expired may have been taken over by another request, whose
+// claim must survive the release of the first.
+var releaseIdempotencyScript = redis.NewScript(`
+local data = redis.call("GET", KEYS[1])
+if not data then
+	return 0
+end
+local entry = cjson.decode(data)
+if entry.token == ARGV[1] and entry.outcome == nil then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+func (s *RedisIdempotencyStore) Claim(ctx context.Context, key string, entry IdempotencyEntry) (bool, *IdempotencyEntry, error) {
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+
+		return false, nil, err
+	}
+
+	claimed, err := s.Redis.SetNX(ctx, s.key(key), data, idempotencyTTL(s.Lease, defaultIdempotencyLease)).Result()
+	if err != nil || claimed {
+
+		return claimed, nil, err
+	}
+
+	data, err = s.Redis.Get(ctx, s.key(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+
+		// The claim expired in between; the request is answered as in flight and retried.
+		return false, &IdempotencyEntry{Fingerprint: entry.Fingerprint}, nil
+	}
+
+	if err != nil {
+
+		return false, nil, err
+	}
+
+	recorded := new(IdempotencyEntry)
+	err = json.Unmarshal(data, recorded)
+	if err != nil {
+
+		return false, nil, fmt.Errorf("malformed idempotency entry of %s: %v", key, err)
+	}
+
+	return false, recorded, nil
+}
+
+func (s *RedisIdempotencyStore) Complete(ctx context.Context, key string, entry IdempotencyEntry) error {
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+
+		return err
+	}
+
+	return s.Redis.Set(ctx, s.key(key), data, idempotencyTTL(s.TTL, defaultIdempotencyTTL)).Err()
+}
+
+func (s *RedisIdempotencyStore) Release(ctx context.Context, key string, token string) error {
+
+	return releaseIdempotencyScript.Run(ctx, s.Redis, []string{s.key(key)}, token).Err()
+}
+
+func idempotencyTTL(ttl, fallback time.Duration) time.Duration {
+
+	if ttl > 0 {
+
+		return ttl
+	}
+
+	return fallback
+}
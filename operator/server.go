@@ -0,0 +1,455 @@
+// Package operator is the operator side of the wallet contract: an http.Handler serving
+// the /profile, /debit, /credit, /settlement, /adjust and /rollback endpoints that the
+// wallet package calls, backed by the operator's own WalletBackend.
+package operator
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/google/uuid"
+	wallet "github.com/touchvas/casino-wallet"
+)
+
+const maxRequestBytes = 1 << 20
+
+var (
+	// ErrInsufficientFunds declines a debit with 402 Payment Required.
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	// ErrDuplicateTransaction answers 409 Conflict. The server answers it to a repeated
+	// transaction ID whose first request is still in flight or carried another amount, and
+	// replays the answer of a completed one; backends return it for duplicates they detect
+	// themselves.
+	ErrDuplicateTransaction = errors.New("duplicate transaction")
+	ErrPlayerNotFound       = errors.New("player not found")
+	// ErrTransactionNotFound rejects a credit or rollback of a debit the backend does not know.
+	ErrTransactionNotFound = errors.New("transaction not found")
+	ErrInvalidRequest      = errors.New("invalid request")
+	// ErrTransactionInProgress answers a duplicate of a transaction that is still being
+	// processed. It is an ErrDuplicateTransaction, answered 409 with Retry-After, so that a
+	// retry once the first request completed gets its answer.
+	ErrTransactionInProgress = fmt.Errorf("%w: transaction in progress", ErrDuplicateTransaction)
+	// ErrTransactionMismatch answers a repeated transaction ID sent with another amount or
+	// reference than its first request. It is an ErrDuplicateTransaction.
+	ErrTransactionMismatch = fmt.Errorf("%w: transaction id reused with different details", ErrDuplicateTransaction)
+)
+
+// inProgressRetryAfter is the Retry-After, in seconds, of ErrTransactionInProgress.
+const inProgressRetryAfter = "1"
+
+// WalletBackend holds the player balances of an operator. Errors wrapping the errors of
+// this package are answered with their status code, any other error with 500.
+type WalletBackend interface {
+	Profile(ctx context.Context, req wallet.ProfileRequest) (*wallet.WalletProfile, error)
+	Debit(ctx context.Context, req wallet.DebitRequest) (*wallet.DebitTransactionResponse, error)
+	Credit(ctx context.Context, req wallet.CreditRequest) (*wallet.CreditTransactionResponse, error)
+	Settle(ctx context.Context, req wallet.SettlementRequest) error
+	Adjust(ctx context.Context, req wallet.AdjustmentRequest) (*wallet.AdjustmentTransactionResponse, error)
+	Rollback(ctx context.Context, req wallet.RollbackRequest) (*wallet.RollbackTransactionResponse, error)
+}
+
+// Server serves the wallet contract for Backend. Requests must carry one of Secrets in
+// AuthHeader; listing several secrets lets the provider rotate its credential without
+// downtime. Debit, credit, adjustment and rollback transaction IDs are claimed in
+// Idempotency, per provider and player, before reaching the backend, so a repeated ID
+// never touches balances: it is answered with the outcome of the first request, or with
+// 409 while that request is still in flight or when it carried another amount. A
+// transaction the backend fails is released so that it can be retried.
+type Server struct {
+	Backend     WalletBackend
+	AuthHeader  string
+	Secrets     []string
+	Idempotency IdempotencyStore
+
+	init sync.Once
+	mux  *http.ServeMux
+}
+
+// NewServer returns a server for backend accepting secret in header, with in-memory
+// idempotency.
+func NewServer(backend WalletBackend, header, secret string) *Server {
+
+	return &Server{
+		Backend:     backend,
+		AuthHeader:  header,
+		Secrets:     []string{secret},
+		Idempotency: NewMemoryIdempotencyStore(),
+	}
+}
+
+func (s *Server) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+
+	s.init.Do(func() {
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /profile", s.profile)
+		mux.HandleFunc("POST /debit", s.debit)
+		mux.HandleFunc("POST /credit", s.credit)
+		mux.HandleFunc("POST /settlement", s.settlement)
+		mux.HandleFunc("POST /adjust", s.adjust)
+		mux.HandleFunc("POST /rollback", s.rollback)
+		s.mux = mux
+	})
+
+	if !s.authenticated(r) {
+
+		writeError(rw, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	s.mux.ServeHTTP(rw, r)
+}
+
+func (s *Server) authenticated(r *http.Request) bool {
+
+	if len(s.AuthHeader) == 0 {
+
+		return false
+	}
+
+	got := []byte(r.Header.Get(s.AuthHeader))
+	if len(got) == 0 {
+
+		return false
+	}
+
+	var ok bool
+	for _, secret := range s.Secrets {
+
+		if len(secret) > 0 && subtle.ConstantTimeCompare(got, []byte(secret)) == 1 {
+
+			ok = true
+		}
+	}
+
+	return ok
+}
+
+func (s *Server) profile(rw http.ResponseWriter, r *http.Request) {
+
+	req := new(wallet.ProfileRequest)
+	if !decode(rw, r, req) {
+
+		return
+	}
+
+	if len(req.PlayerID) == 0 {
+
+		writeError(rw, http.StatusBadRequest, "player_id is required")
+		return
+	}
+
+	resp, err := s.Backend.Profile(r.Context(), *req)
+	respond(rw, resp, err)
+}
+
+func (s *Server) debit(rw http.ResponseWriter, r *http.Request) {
+
+	req := new(wallet.DebitRequest)
+	if !decode(rw, r, req) {
+
+		return
+	}
+
+	err := validateTransaction(req.PlayerID, req.TransactionID, req.Amount, false)
+	if err != nil {
+
+		respond(rw, nil, err)
+		return
+	}
+
+	key := idempotencyKey("debit", req.ProviderID, req.PlayerID, req.TransactionID)
+
+	s.idempotent(rw, r, key, fingerprint(req.Amount, ""), func(ctx context.Context) (interface{}, error) {
+
+		return s.Backend.Debit(ctx, *req)
+	})
+}
+
+func (s *Server) credit(rw http.ResponseWriter, r *http.Request) {
+
+	req := new(wallet.CreditRequest)
+	if !decode(rw, r, req) {
+
+		return
+	}
+
+	err := validateTransaction(req.PlayerID, req.TransactionID, req.Amount, false)
+	if err != nil {
+
+		respond(rw, nil, err)
+		return
+	}
+
+	key := idempotencyKey("credit", req.ProviderID, req.PlayerID, req.TransactionID)
+
+	s.idempotent(rw, r, key, fingerprint(req.Amount, req.DebitTransactionID), func(ctx context.Context) (interface{}, error) {
+
+		return s.Backend.Credit(ctx, *req)
+	})
+}
+
+func (s *Server) adjust(rw http.ResponseWriter, r *http.Request) {
+
+	req := new(wallet.AdjustmentRequest)
+	if !decode(rw, r, req) {
+
+		return
+	}
+
+	err := validateTransaction(req.PlayerID, req.TransactionID, req.Amount, true)
+	if err != nil {
+
+		respond(rw, nil, err)
+		return
+	}
+
+	key := idempotencyKey("adjust", req.ProviderID, req.PlayerID, req.TransactionID)
+
+	s.idempotent(rw, r, key, fingerprint(req.Amount, ""), func(ctx context.Context) (interface{}, error) {
+
+		return s.Backend.Adjust(ctx, *req)
+	})
+}
+
+func (s *Server) rollback(rw http.ResponseWriter, r *http.Request) {
+
+	req := new(wallet.RollbackRequest)
+	if !decode(rw, r, req) {
+
+		return
+	}
+
+	err := validateTransaction(req.PlayerID, req.TransactionID, req.Amount, false)
+	if err != nil {
+
+		respond(rw, nil, err)
+		return
+	}
+
+	key := idempotencyKey("rollback", req.ProviderID, req.PlayerID, req.TransactionID)
+
+	s.idempotent(rw, r, key, fingerprint(req.Amount, req.DebitTransactionID), func(ctx context.Context) (interface{}, error) {
+
+		return s.Backend.Rollback(ctx, *req)
+	})
+}
+
+// settlement answers a repeated settlement of the same debit with 200, since the client
+// treats every other status as a failure and the round is settled either way.
+func (s *Server) settlement(rw http.ResponseWriter, r *http.Request) {
+
+	req := new(wallet.SettlementRequest)
+	if !decode(rw, r, req) {
+
+		return
+	}
+
+	if len(req.PlayerID) == 0 || len(req.DebitTransactionID) == 0 {
+
+		writeError(rw, http.StatusBadRequest, "player_id and debit_transaction_id are required")
+		return
+	}
+
+	key := idempotencyKey("settlement", req.ProviderID, req.PlayerID, fmt.Sprintf("%d:%s:%s", len(req.RoundID), req.RoundID, req.DebitTransactionID))
+
+	s.idempotent(rw, r, key, "", func(ctx context.Context) (interface{}, error) {
+
+		return nil, s.Backend.Settle(ctx, *req)
+	})
+}
+
+// idempotencyKey scopes a transaction ID to its operation, provider and player, so that
+// the same ID sent for another player is not answered with someone else's outcome. The
+// player ID is length-prefixed since it may contain the separator.
+func idempotencyKey(operation string, providerID int64, playerID, transactionID string) string {
+
+	return fmt.Sprintf("%s:%d:%d:%s:%s", operation, providerID, len(playerID), playerID, transactionID)
+}
+
+// fingerprint identifies the details of a transaction that a retry must repeat.
+func fingerprint(amount float64, reference string) string {
+
+	return strconv.FormatFloat(amount, 'f', -1, 64) + ":" + reference
+}
+
+// idempotent runs fn unless key was already claimed, in which case the stored outcome is
+// replayed if the first request had the same fingerprint.
+func (s *Server) idempotent(rw http.ResponseWriter, r *http.Request, key, fingerprint string, fn func(ctx context.Context) (interface{}, error)) {
+
+	entry := IdempotencyEntry{Token: uuid.New().String(), Fingerprint: fingerprint}
+
+	claimed, recorded, err := s.claim(r.Context(), key, entry)
+	if err != nil {
+
+		respond(rw, nil, err)
+		return
+	}
+
+	if !claimed {
+
+		switch {
+
+		case recorded.Fingerprint != fingerprint:
+			respond(rw, nil, ErrTransactionMismatch)
+
+		case recorded.Outcome == nil:
+			rw.Header().Set("Retry-After", inProgressRetryAfter)
+			respond(rw, nil, ErrTransactionInProgress)
+
+		default:
+			writeOutcome(rw, *recorded.Outcome)
+		}
+
+		return
+	}
+
+	resp, err := fn(r.Context())
+	if err != nil {
+
+		s.release(r.Context(), key, entry.Token)
+		respond(rw, nil, err)
+		return
+	}
+
+	result := newOutcome(resp, nil)
+	entry.Outcome = &result
+
+	// The transaction has been applied whether or not its outcome is stored; duplicates
+	// are answered 409 until the claim expires.
+	if s.Idempotency != nil {
+
+		_ = s.Idempotency.Complete(r.Context(), key, entry)
+	}
+
+	writeOutcome(rw, result)
+}
+
+func (s *Server) claim(ctx context.Context, key string, entry IdempotencyEntry) (bool, *IdempotencyEntry, error) {
+
+	if s.Idempotency == nil {
+
+		return true, nil, nil
+	}
+
+	return s.Idempotency.Claim(ctx, key, entry)
+}
+
+func (s *Server) release(ctx context.Context, key, token string) {
+
+	if s.Idempotency != nil {
+
+		_ = s.Idempotency.Release(ctx, key, token)
+	}
+}
+
+func validateTransaction(playerID, transactionID string, amount float64, signed bool) error {
+
+	if len(playerID) == 0 || len(transactionID) == 0 {
+
+		return fmt.Errorf("%w: player_id and transaction_id are required", ErrInvalidRequest)
+	}
+
+	if math.IsNaN(amount) || math.IsInf(amount, 0) || (!signed && amount < 0) {
+
+		return fmt.Errorf("%w: invalid amount %v", ErrInvalidRequest, amount)
+	}
+
+	return nil
+}
+
+func decode(rw http.ResponseWriter, r *http.Request, v interface{}) bool {
+
+	err := json.NewDecoder(http.MaxBytesReader(rw, r.Body, maxRequestBytes)).Decode(v)
+	if err != nil {
+
+		writeError(rw, http.StatusBadRequest, "malformed request body")
+		return false
+	}
+
+	return true
+}
+
+// StatusCode returns the HTTP status the server answers err with.
+func StatusCode(err error) int {
+
+	switch {
+
+	case err == nil:
+		return http.StatusOK
+
+	case errors.Is(err, ErrInsufficientFunds):
+		return http.StatusPaymentRequired
+
+	case errors.Is(err, ErrDuplicateTransaction):
+		return http.StatusConflict
+
+	case errors.Is(err, ErrPlayerNotFound), errors.Is(err, ErrTransactionNotFound):
+		return http.StatusNotFound
+
+	case errors.Is(err, ErrInvalidRequest):
+		return http.StatusBadRequest
+	}
+
+	return http.StatusInternalServerError
+}
+
+// respond writes resp as JSON, or err as plain text, which the client passes on as the
+// Description of 402 and 409 answers and as the error message of the others.
+func respond(rw http.ResponseWriter, resp interface{}, err error) {
+
+	writeOutcome(rw, newOutcome(resp, err))
+}
+
+// newOutcome returns the answer respond gives to resp and err. A nil resp without an error
+// is answered with an empty 200.
+func newOutcome(resp interface{}, err error) Outcome {
+
+	if err != nil {
+
+		status := StatusCode(err)
+		message := err.Error()
+		if status == http.StatusInternalServerError {
+
+			message = "internal server error"
+		}
+
+		return Outcome{Status: status, ContentType: "text/plain; charset=utf-8", Body: []byte(message)}
+	}
+
+	if resp == nil {
+
+		return Outcome{Status: http.StatusOK}
+	}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+
+		return newOutcome(nil, err)
+	}
+
+	return Outcome{Status: http.StatusOK, ContentType: "application/json", Body: append(body, '\n')}
+}
+
+func writeOutcome(rw http.ResponseWriter, outcome Outcome) {
+
+	if len(outcome.ContentType) > 0 {
+
+		rw.Header().Set("Content-Type", outcome.ContentType)
+	}
+
+	rw.WriteHeader(outcome.Status)
+	_, _ = rw.Write(outcome.Body)
+}
+
+func writeError(rw http.ResponseWriter, status int, message string) {
+
+	writeOutcome(rw, Outcome{Status: status, ContentType: "text/plain; charset=utf-8", Body: []byte(message)})
+}
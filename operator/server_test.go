@@ -0,0 +1,237 @@
+package operator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	wallet "github.com/touchvas/casino-wallet"
+)
+
+// debitBackend is a WalletBackend counting debits. When release is set, a debit signals
+// entered and blocks until release is closed.
+type debitBackend struct {
+	WalletBackend
+
+	debits  atomic.Int64
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (b *debitBackend) Debit(ctx context.Context, req wallet.DebitRequest) (*wallet.DebitTransactionResponse, error) {
+
+	if b.release != nil {
+
+		b.entered <- struct{}{}
+		<-b.release
+	}
+
+	n := b.debits.Add(1)
+	return &wallet.DebitTransactionResponse{Status: 1, Balance: 100 - float64(n)*req.Amount}, nil
+}
+
+func postDebit(t *testing.T, server *Server, transactionID string) *httptest.ResponseRecorder {
+
+	t.Helper()
+
+	return postDebitRequest(t, server, wallet.DebitRequest{PlayerID: "p1", TransactionID: transactionID, Amount: 10})
+}
+
+func postDebitRequest(t *testing.T, server *Server, req wallet.DebitRequest) *httptest.ResponseRecorder {
+
+	t.Helper()
+
+	body, err := json.Marshal(req)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/debit", bytes.NewReader(body))
+	r.Header.Set("X-Secret", "secret")
+
+	rw := httptest.NewRecorder()
+	server.ServeHTTP(rw, r)
+	return rw
+}
+
+func TestServerReplaysDuplicateDebit(t *testing.T) {
+
+	backend := &debitBackend{}
+	server := NewServer(backend, "X-Secret", "secret")
+
+	first := postDebit(t, server, "t1")
+	second := postDebit(t, server, "t1")
+
+	if first.Code != http.StatusOK || second.Code != http.StatusOK {
+
+		t.Fatalf("statuses = %d, %d, want 200 twice", first.Code, second.Code)
+	}
+
+	if second.Body.String() != first.Body.String() {
+
+		t.Fatalf("duplicate answered %q, want the original %q", second.Body.String(), first.Body.String())
+	}
+
+	if n := backend.debits.Load(); n != 1 {
+
+		t.Fatalf("backend debited %d times, want once", n)
+	}
+}
+
+func TestServerDuplicateDebitInFlight(t *testing.T) {
+
+	backend := &debitBackend{entered: make(chan struct{}, 1), release: make(chan struct{})}
+	server := NewServer(backend, "X-Secret", "secret")
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+
+		done <- postDebit(t, server, "t1")
+	}()
+
+	<-backend.entered
+	duplicate := postDebit(t, server, "t1")
+
+	close(backend.release)
+	first := <-done
+
+	if duplicate.Code != http.StatusConflict || len(duplicate.Header().Get("Retry-After")) == 0 {
+
+		t.Fatalf("in-flight duplicate = %d, Retry-After %q, want 409 with Retry-After", duplicate.Code, duplicate.Header().Get("Retry-After"))
+	}
+
+	if first.Code != http.StatusOK {
+
+		t.Fatalf("first debit = %d, want 200", first.Code)
+	}
+
+	if n := backend.debits.Load(); n != 1 {
+
+		t.Fatalf("backend debited %d times, want once", n)
+	}
+}
+
+func TestServerScopesTransactionIDs(t *testing.T) {
+
+	backend := &debitBackend{}
+	server := NewServer(backend, "X-Secret", "secret")
+
+	first := postDebitRequest(t, server, wallet.DebitRequest{PlayerID: "p1", TransactionID: "t1", Amount: 10})
+	other := postDebitRequest(t, server, wallet.DebitRequest{PlayerID: "p2", TransactionID: "t1", Amount: 10})
+
+	if first.Code != http.StatusOK || other.Code != http.StatusOK {
+
+		t.Fatalf("statuses = %d, %d, want 200 twice", first.Code, other.Code)
+	}
+
+	if n := backend.debits.Load(); n != 2 {
+
+		t.Fatalf("backend debited %d times, want once per player", n)
+	}
+
+	changed := postDebitRequest(t, server, wallet.DebitRequest{PlayerID: "p1", TransactionID: "t1", Amount: 50})
+	if changed.Code != http.StatusConflict {
+
+		t.Fatalf("repeated transaction with another amount = %d, want 409", changed.Code)
+	}
+
+	if n := backend.debits.Load(); n != 2 {
+
+		t.Fatalf("backend debited %d times after a mismatching duplicate, want 2", n)
+	}
+}
+
+func TestMemoryIdempotencyStoreExpiry(t *testing.T) {
+
+	ctx := context.Background()
+	store := NewMemoryIdempotencyStore()
+	store.TTL = 10 * time.Millisecond
+
+	entry := IdempotencyEntry{Token: "c1", Fingerprint: "10:"}
+
+	claimed, _, err := store.Claim(ctx, "k", entry)
+	if err != nil || !claimed {
+
+		t.Fatalf("Claim = %v, %v", claimed, err)
+	}
+
+	entry.Outcome = &Outcome{Status: http.StatusOK}
+
+	err = store.Complete(ctx, "k", entry)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	claimed, recorded, err := store.Claim(ctx, "k", IdempotencyEntry{Token: "c2"})
+	if err != nil || claimed || recorded == nil || recorded.Outcome == nil {
+
+		t.Fatalf("Claim of a completed key = %v, %+v, %v, want its outcome", claimed, recorded, err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	claimed, _, err = store.Claim(ctx, "k", IdempotencyEntry{Token: "c3"})
+	if err != nil || !claimed {
+
+		t.Fatalf("Claim after the TTL = %v, %v, want the key forgotten", claimed, err)
+	}
+}
+
+func TestRedisIdempotencyStoreRelease(t *testing.T) {
+
+	ctx := context.Background()
+
+	mr := miniredis.RunT(t)
+	conn := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { conn.Close() })
+
+	store := NewRedisIdempotencyStore(conn, wallet.KeySpace{Prefix: "test"})
+
+	claimed, _, err := store.Claim(ctx, "k", IdempotencyEntry{Token: "c1", Fingerprint: "10:"})
+	if err != nil || !claimed {
+
+		t.Fatalf("Claim = %v, %v", claimed, err)
+	}
+
+	// The lease of the first claim expired and another request claimed the key.
+	mr.FastForward(defaultIdempotencyLease)
+
+	claimed, _, err = store.Claim(ctx, "k", IdempotencyEntry{Token: "c2", Fingerprint: "10:"})
+	if err != nil || !claimed {
+
+		t.Fatalf("Claim after the lease = %v, %v", claimed, err)
+	}
+
+	err = store.Release(ctx, "k", "c1")
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	claimed, recorded, err := store.Claim(ctx, "k", IdempotencyEntry{Token: "c3", Fingerprint: "10:"})
+	if err != nil || claimed || recorded.Token != "c2" {
+
+		t.Fatalf("Claim after a stale release = %v, %+v, %v, want the second claim kept", claimed, recorded, err)
+	}
+
+	err = store.Release(ctx, "k", "c2")
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	claimed, _, err = store.Claim(ctx, "k", IdempotencyEntry{Token: "c4", Fingerprint: "10:"})
+	if err != nil || !claimed {
+
+		t.Fatalf("Claim after the release = %v, %v, want the key free", claimed, err)
+	}
+}
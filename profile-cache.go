@@ -0,0 +1,337 @@
+package wallet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ProfileCache keeps recently fetched wallet profiles in Redis for the KeyFamilyProfile TTL
+// of its key space. Wallet refreshes cached balances from every successful transaction
+// response and drops the entry when a transaction fails. Concurrent misses for the same
+// player share one upstream call.
+type ProfileCache struct {
+	Redis    redis.UniversalClient
+	KeySpace KeySpace
+	Logger   Logger
+
+	mu       sync.Mutex
+	inflight map[string]*profileCall
+}
+
+const maxProfileUpdateAttempts = 3
+
+type profileCall struct {
+	done    chan struct{}
+	profile *WalletProfile
+	err     error
+}
+
+func NewProfileCache(redisConn redis.UniversalClient, ks KeySpace) (*ProfileCache, error) {
+
+	err := ks.Validate()
+	if err != nil {
+
+		return nil, err
+	}
+
+	return &ProfileCache{Redis: redisConn, KeySpace: ks}, nil
+}
+
+func (c *ProfileCache) log() contextLogger {
+
+	return logTo(c.Logger)
+}
+
+func profileCacheKey(clientID int64, playerID string) string {
+
+	return fmt.Sprintf("%s:{%s}:%d:%s", KeyFamilyProfile, playerHashTag(playerID), clientID, playerID)
+}
+
+func (c *ProfileCache) Get(ctx context.Context, clientID int64, playerID string) (*WalletProfile, bool) {
+
+	data, err := GetRedisKey(c.Redis, c.KeySpace, profileCacheKey(clientID, playerID), ctx)
+	if err != nil {
+
+		return nil, false
+	}
+
+	prof := new(WalletProfile)
+	err = json.Unmarshal([]byte(data), prof)
+	if err != nil {
+
+		return nil, false
+	}
+
+	return prof, true
+}
+
+func (c *ProfileCache) Set(ctx context.Context, clientID int64, playerID string, prof *WalletProfile) {
+
+	data, err := json.Marshal(prof)
+	if err != nil {
+
+		return
+	}
+
+	err = setRedisKeyWithExpiry(c.Redis, c.KeySpace, profileCacheKey(clientID, playerID), string(data), c.KeySpace.TTLSeconds(KeyFamilyProfile), c.log(), ctx)
+	if err != nil {
+
+		c.log().Error(ctx, "error caching wallet profile", err, LogFields{
+			LogFieldPlayerID: playerID,
+		})
+	}
+}
+
+// profileVersionKey counts the changes made to a player's balance. Fetch only caches a
+// profile when the count did not move while it was being fetched, so a profile read
+// before a transaction cannot overwrite the balance that transaction left. It shares the
+// hash tag of the profile key so both can be watched in one transaction on a cluster.
+func profileVersionKey(clientID int64, playerID string) string {
+
+	return fmt.Sprintf("%s-version:{%s}:%d:%s", KeyFamilyProfile, playerHashTag(playerID), clientID, playerID)
+}
+
+// versionTTL outlives the profile entry so that slow fetches still see the changes made
+// while they were running.
+func (c *ProfileCache) versionTTL() time.Duration {
+
+	ttl := c.KeySpace.TTL(KeyFamilyProfile)
+	if ttl < time.Minute {
+
+		ttl = time.Minute
+	}
+
+	return ttl
+}
+
+func (c *ProfileCache) version(ctx context.Context, clientID int64, playerID string) (string, error) {
+
+	version, err := c.Redis.Get(ctx, c.KeySpace.Key(profileVersionKey(clientID, playerID))).Result()
+	if errors.Is(err, redis.Nil) {
+
+		return "", nil
+	}
+
+	return version, err
+}
+
+// bump records a change of balance in pipe.
+func (c *ProfileCache) bump(ctx context.Context, pipe redis.Pipeliner, clientID int64, playerID string) {
+
+	key := c.KeySpace.Key(profileVersionKey(clientID, playerID))
+	pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, c.versionTTL())
+}
+
+// UpdateBalance refreshes the balances of a cached profile. Players without a cached
+// profile are left alone since a transaction response does not carry the full profile.
+// The update is applied atomically against concurrent fetches and updates; when it keeps
+// conflicting the entry is dropped instead.
+func (c *ProfileCache) UpdateBalance(ctx context.Context, clientID int64, playerID string, balance, bonus float64) {
+
+	key := c.KeySpace.Key(profileCacheKey(clientID, playerID))
+	versionKey := c.KeySpace.Key(profileVersionKey(clientID, playerID))
+
+	update := func(tx *redis.Tx) error {
+
+		var prof *WalletProfile
+
+		data, err := tx.Get(ctx, key).Result()
+		if err == nil {
+
+			prof = new(WalletProfile)
+			if json.Unmarshal([]byte(data), prof) != nil {
+
+				prof = nil
+			}
+
+		} else if !errors.Is(err, redis.Nil) {
+
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+
+			c.bump(ctx, pipe, clientID, playerID)
+
+			if prof == nil {
+
+				pipe.Del(ctx, key)
+				return nil
+			}
+
+			prof.Balance = balance
+			prof.Bonus = bonus
+
+			updated, err := json.Marshal(prof)
+			if err != nil {
+
+				return err
+			}
+
+			pipe.Set(ctx, key, updated, c.KeySpace.TTL(KeyFamilyProfile))
+			return nil
+		})
+
+		return err
+	}
+
+	var err error
+	for attempt := 0; attempt < maxProfileUpdateAttempts; attempt++ {
+
+		err = c.Redis.Watch(ctx, update, key, versionKey)
+		if !errors.Is(err, redis.TxFailedErr) {
+
+			break
+		}
+	}
+
+	if err != nil {
+
+		c.log().Warn(ctx, "error updating cached balance, dropping cached profile", LogFields{
+			LogFieldPlayerID: playerID,
+			LogFieldError:    err.Error(),
+		})
+
+		c.Invalidate(ctx, clientID, playerID)
+	}
+}
+
+func (c *ProfileCache) Invalidate(ctx context.Context, clientID int64, playerID string) {
+
+	_, err := c.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+
+		pipe.Del(ctx, c.KeySpace.Key(profileCacheKey(clientID, playerID)))
+		c.bump(ctx, pipe, clientID, playerID)
+		return nil
+	})
+	if err != nil {
+
+		c.log().Error(ctx, "error invalidating cached wallet profile", err, LogFields{
+			LogFieldPlayerID: playerID,
+		})
+	}
+}
+
+// setIfUnchanged caches prof unless the balance changed since version was read.
+func (c *ProfileCache) setIfUnchanged(ctx context.Context, clientID int64, playerID string, prof *WalletProfile, version string) {
+
+	data, err := json.Marshal(prof)
+	if err != nil {
+
+		return
+	}
+
+	key := c.KeySpace.Key(profileCacheKey(clientID, playerID))
+	versionKey := c.KeySpace.Key(profileVersionKey(clientID, playerID))
+
+	err = c.Redis.Watch(ctx, func(tx *redis.Tx) error {
+
+		current, err := tx.Get(ctx, versionKey).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+
+			return err
+		}
+
+		if current != version {
+
+			return nil
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+
+			pipe.Set(ctx, key, data, c.KeySpace.TTL(KeyFamilyProfile))
+			return nil
+		})
+
+		return err
+	}, versionKey)
+
+	if err != nil && !errors.Is(err, redis.TxFailedErr) {
+
+		c.log().Error(ctx, "error caching wallet profile", err, LogFields{
+			LogFieldPlayerID: playerID,
+		})
+	}
+}
+
+// Fetch returns the cached profile or loads it with fetch, sharing a single in-flight
+// fetch between concurrent callers asking for the same player.
+func (c *ProfileCache) Fetch(ctx context.Context, clientID int64, playerID string, fetch func() (*WalletProfile, error)) (*WalletProfile, error) {
+
+	if prof, ok := c.Get(ctx, clientID, playerID); ok {
+
+		return prof, nil
+	}
+
+	key := profileCacheKey(clientID, playerID)
+
+	c.mu.Lock()
+
+	if c.inflight == nil {
+
+		c.inflight = make(map[string]*profileCall)
+	}
+
+	if call, ok := c.inflight[key]; ok {
+
+		c.mu.Unlock()
+
+		select {
+
+		case <-call.done:
+			if call.err != nil {
+
+				return nil, call.err
+			}
+
+			prof := *call.profile
+			return &prof, nil
+
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	call := &profileCall{done: make(chan struct{})}
+	c.inflight[key] = call
+	c.mu.Unlock()
+
+	// A panicking fetch still releases the callers waiting on it before panicking on.
+	defer func() {
+
+		if r := recover(); r != nil {
+
+			call.profile, call.err = nil, fmt.Errorf("wallet profile fetch panicked: %v", r)
+			c.finish(key, call)
+			panic(r)
+		}
+	}()
+
+	version, versionErr := c.version(ctx, clientID, playerID)
+
+	call.profile, call.err = fetch()
+
+	if call.err == nil && versionErr == nil {
+
+		c.setIfUnchanged(ctx, clientID, playerID, call.profile, version)
+	}
+
+	c.finish(key, call)
+	return call.profile, call.err
+}
+
+// finish removes call from the in-flight fetches and hands its result to its waiters.
+func (c *ProfileCache) finish(key string, call *profileCall) {
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	c.mu.Unlock()
+	close(call.done)
+}
@@ -0,0 +1,160 @@
+package wallet
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestProfileCacheUpdateBalance(t *testing.T) {
+
+	_, conn := newTestRedis(t)
+	ctx := context.Background()
+
+	cache, err := NewProfileCache(conn, KeySpace{Prefix: "test"})
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	cache.UpdateBalance(ctx, 7, "p1", 50, 0)
+	if _, ok := cache.Get(ctx, 7, "p1"); ok {
+
+		t.Fatal("UpdateBalance cached a profile that was not cached")
+	}
+
+	cache.Set(ctx, 7, "p1", &WalletProfile{ID: "p1", Balance: 100, Currency: "KES"})
+	cache.UpdateBalance(ctx, 7, "p1", 90, 5)
+
+	prof, ok := cache.Get(ctx, 7, "p1")
+	if !ok || prof.Balance != 90 || prof.Bonus != 5 || prof.Currency != "KES" {
+
+		t.Fatalf("cached profile after UpdateBalance = %+v, %v", prof, ok)
+	}
+}
+
+// TestProfileCacheStaleFetch checks that a profile fetched before a transaction does not
+// overwrite the balance the transaction left in the cache.
+func TestProfileCacheStaleFetch(t *testing.T) {
+
+	_, conn := newTestRedis(t)
+	ctx := context.Background()
+
+	cache, err := NewProfileCache(conn, KeySpace{Prefix: "test"})
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		change func()
+	}{
+		{"update", func() {
+
+			cache.Set(ctx, 7, "p1", &WalletProfile{ID: "p1", Balance: 100})
+			cache.UpdateBalance(ctx, 7, "p1", 90, 0)
+		}},
+		{"invalidate", func() {
+
+			cache.Invalidate(ctx, 7, "p1")
+		}},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			cache.Invalidate(ctx, 7, "p1")
+
+			prof, err := cache.Fetch(ctx, 7, "p1", func() (*WalletProfile, error) {
+
+				tt.change()
+				return &WalletProfile{ID: "p1", Balance: 100}, nil
+			})
+			if err != nil || prof.Balance != 100 {
+
+				t.Fatalf("Fetch = %+v, %v", prof, err)
+			}
+
+			cached, ok := cache.Get(ctx, 7, "p1")
+			if ok && cached.Balance == 100 {
+
+				t.Fatal("stale fetch overwrote the cached balance")
+			}
+		})
+	}
+
+	_, err = cache.Fetch(ctx, 7, "p2", func() (*WalletProfile, error) {
+
+		return &WalletProfile{ID: "p2", Balance: 10}, nil
+	})
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	if _, ok := cache.Get(ctx, 7, "p2"); !ok {
+
+		t.Fatal("undisturbed fetch was not cached")
+	}
+}
+
+// TestProfileCacheFetchPanic checks that callers waiting on a fetch that panics are
+// released with an error.
+func TestProfileCacheFetchPanic(t *testing.T) {
+
+	_, conn := newTestRedis(t)
+	ctx := context.Background()
+
+	cache, err := NewProfileCache(conn, KeySpace{Prefix: "test"})
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	panicked := make(chan any, 1)
+
+	go func() {
+
+		defer func() { panicked <- recover() }()
+
+		cache.Fetch(ctx, 7, "p1", func() (*WalletProfile, error) {
+
+			close(started)
+			<-release
+			panic("fetch failed")
+		})
+	}()
+
+	<-started
+
+	waiter := make(chan error, 1)
+	go func() {
+
+		_, err := cache.Fetch(ctx, 7, "p1", func() (*WalletProfile, error) {
+
+			return &WalletProfile{ID: "p1"}, nil
+		})
+		waiter <- err
+	}()
+
+	// Let the waiter join the in-flight fetch before it panics.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if r := <-panicked; r == nil {
+
+		t.Fatal("the panic of the fetch was swallowed")
+	}
+
+	select {
+
+	case <-waiter:
+
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiter still blocked after the fetch panicked")
+	}
+}
@@ -0,0 +1,93 @@
+package wallet
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const defaultProviderVersion = "2.5"
+
+// ProviderIdentity is the game provider a Wallet acts for. It is sent in every wallet
+// request and in the User-Agent header.
+type ProviderIdentity struct {
+	ID        int64
+	Name      string
+	Version   string
+	UserAgent string
+}
+
+// ProviderIdentityFromEnv reads PROVIDER_ID, PROVIDER_NAME and the optional
+// PROVIDER_VERSION, as single-provider processes have always been configured.
+func ProviderIdentityFromEnv() (ProviderIdentity, error) {
+
+	provider := ProviderIdentity{
+		Name:    os.Getenv("PROVIDER_NAME"),
+		Version: os.Getenv("PROVIDER_VERSION"),
+	}
+
+	id, err := strconv.ParseInt(os.Getenv("PROVIDER_ID"), 10, 64)
+	if err != nil {
+
+		return provider, fmt.Errorf("invalid PROVIDER_ID %q: %v", os.Getenv("PROVIDER_ID"), err)
+	}
+
+	provider.ID = id
+	return provider, provider.Validate()
+}
+
+// legacyProviderIdentity reads the environment without validation, matching the behaviour
+// of the package level wallet functions.
+func legacyProviderIdentity() ProviderIdentity {
+
+	id, _ := strconv.ParseInt(os.Getenv("PROVIDER_ID"), 10, 64)
+	return ProviderIdentity{ID: id, Name: os.Getenv("PROVIDER_NAME")}
+}
+
+func (p ProviderIdentity) Validate() error {
+
+	if p.ID <= 0 {
+
+		return fmt.Errorf("provider id must be positive, got %d", p.ID)
+	}
+
+	if len(strings.TrimSpace(p.Name)) == 0 {
+
+		return fmt.Errorf("provider %d has no name", p.ID)
+	}
+
+	// Every field ends up in the User-Agent header, where a line break would inject headers.
+	fields := []struct{ name, value string }{
+		{"name", p.Name},
+		{"version", p.Version},
+		{"user agent", p.UserAgent},
+	}
+
+	for _, f := range fields {
+
+		if strings.ContainsFunc(f.value, unicode.IsControl) {
+
+			return fmt.Errorf("provider %d %s contains a control character", p.ID, f.name)
+		}
+	}
+
+	return nil
+}
+
+func (p ProviderIdentity) userAgent() string {
+
+	if len(p.UserAgent) > 0 {
+
+		return p.UserAgent
+	}
+
+	version := p.Version
+	if len(version) == 0 {
+
+		version = defaultProviderVersion
+	}
+
+	return fmt.Sprintf("Touchvas Gaming/%s (provider;%s) (providerID;%d)", version, p.Name, p.ID)
+}
@@ -0,0 +1,28 @@
+package wallet
+
+import "testing"
+
+func TestProviderIdentityValidate(t *testing.T) {
+
+	tests := []struct {
+		provider ProviderIdentity
+		valid    bool
+	}{
+		{ProviderIdentity{ID: 1, Name: "studio"}, true},
+		{ProviderIdentity{ID: 0, Name: "studio"}, false},
+		{ProviderIdentity{ID: 1, Name: " "}, false},
+		{ProviderIdentity{ID: 1, Name: "studio\r\nX-Injected: 1"}, false},
+		{ProviderIdentity{ID: 1, Name: "studio\x00"}, false},
+		{ProviderIdentity{ID: 1, Name: "studio", Version: "2.5\n"}, false},
+		{ProviderIdentity{ID: 1, Name: "studio", UserAgent: "agent\t"}, false},
+	}
+
+	for _, tt := range tests {
+
+		err := tt.provider.Validate()
+		if (err == nil) != tt.valid {
+
+			t.Errorf("Validate(%+v) = %v, want valid %v", tt.provider, err, tt.valid)
+		}
+	}
+}
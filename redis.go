@@ -3,41 +3,28 @@ package wallet
 import (
 	"context"
 	"fmt"
-	"os"
 
-	"log"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
-func getKey(key string) string {
-
-	if len(os.Getenv("REDIS_KEY_PREFIX")) > 0 {
-
-		return fmt.Sprintf("%s:%s", os.Getenv("REDIS_KEY_PREFIX"), key)
-	}
-
-	return key
-
-}
-
-func GetRedisKey(conn *redis.Client, key string, ctx context.Context) (string, error) {
+func GetRedisKey(conn redis.UniversalClient, ks KeySpace, key string, ctx context.Context) (string, error) {
 
 	var data string
-	data, err := conn.Get(ctx, getKey(key)).Result()
+	data, err := conn.Get(ctx, ks.Key(key)).Result()
 	if err != nil {
 
-		return data, fmt.Errorf("error getting key %s: %v", key, err)
+		return data, fmt.Errorf("error getting key %s: %w", key, err)
 	}
 
 	return data, err
 
 }
 
-func SetRedisKey(conn *redis.Client, key string, value string, ctx context.Context) error {
+func SetRedisKey(conn redis.UniversalClient, ks KeySpace, key string, value string, ctx context.Context) error {
 
-	_, err := conn.Set(ctx, getKey(key), value, time.Second*time.Duration(0)).Result()
+	_, err := conn.Set(ctx, ks.Key(key), value, time.Second*time.Duration(0)).Result()
 	if err != nil {
 
 		v := string(value)
@@ -52,9 +39,14 @@ func SetRedisKey(conn *redis.Client, key string, value string, ctx context.Conte
 	return err
 }
 
-func SetRedisKeyWithExpiry(conn *redis.Client, key string, value string, seconds int, ctx context.Context) error {
+func SetRedisKeyWithExpiry(conn redis.UniversalClient, ks KeySpace, key string, value string, seconds int, ctx context.Context) error {
+
+	return setRedisKeyWithExpiry(conn, ks, key, value, seconds, logTo(nil), ctx)
+}
+
+func setRedisKeyWithExpiry(conn redis.UniversalClient, ks KeySpace, key string, value string, seconds int, log contextLogger, ctx context.Context) error {
 
-	_, err := conn.Set(ctx, getKey(key), value, time.Second*time.Duration(seconds)).Result()
+	_, err := conn.Set(ctx, ks.Key(key), value, time.Second*time.Duration(seconds)).Result()
 	if err != nil {
 
 		v := string(value)
@@ -64,17 +56,20 @@ func SetRedisKeyWithExpiry(conn *redis.Client, key string, value string, seconds
 			v = v[0:12] + "..."
 		}
 
-		log.Printf("error saving redisKey %s error %s", key, err.Error())
+		log.Error(ctx, "error saving redis key", err, LogFields{
+			"key": key,
+		})
+
 		return fmt.Errorf("error setting key %s to %s: %v", key, v, err)
 	}
 
 	return err
 }
 
-func IncRedisKey(conn *redis.Client, key string, ctx context.Context) (int64, error) {
+func IncRedisKey(conn redis.UniversalClient, ks KeySpace, key string, ctx context.Context) (int64, error) {
 
 	var data int64
-	data, err := conn.Incr(ctx, getKey(key)).Result()
+	data, err := conn.Incr(ctx, ks.Key(key)).Result()
 
 	if err != nil {
 
@@ -83,3 +78,65 @@ func IncRedisKey(conn *redis.Client, key string, ctx context.Context) (int64, er
 
 	return data, err
 }
+
+func DelRedisKey(conn redis.UniversalClient, ks KeySpace, key string, ctx context.Context) error {
+
+	_, err := conn.Del(ctx, ks.Key(key)).Result()
+	if err != nil {
+
+		return fmt.Errorf("error deleting key %s: %v", key, err)
+	}
+
+	return err
+}
+
+func ExistsRedisKey(conn redis.UniversalClient, ks KeySpace, key string, ctx context.Context) (bool, error) {
+
+	count, err := conn.Exists(ctx, ks.Key(key)).Result()
+	if err != nil {
+
+		return false, fmt.Errorf("error checking key %s: %v", key, err)
+	}
+
+	return count > 0, err
+}
+
+func GetDelRedisKey(conn redis.UniversalClient, ks KeySpace, key string, ctx context.Context) (string, error) {
+
+	var data string
+	data, err := conn.GetDel(ctx, ks.Key(key)).Result()
+	if err != nil {
+
+		return data, fmt.Errorf("error getting and deleting key %s: %w", key, err)
+	}
+
+	return data, err
+}
+
+// SetRedisKeyWithTTL sets key to expire after ttl, keeping sub-second precision. Unlike
+// SetRedisKeyWithExpiry, a ttl that is not positive is rejected instead of storing the
+// key without expiry.
+func SetRedisKeyWithTTL(conn redis.UniversalClient, ks KeySpace, key string, value string, ttl time.Duration, ctx context.Context) error {
+
+	return setRedisKeyWithTTL(conn, ks, key, value, ttl, logTo(nil), ctx)
+}
+
+func setRedisKeyWithTTL(conn redis.UniversalClient, ks KeySpace, key string, value string, ttl time.Duration, log contextLogger, ctx context.Context) error {
+
+	if ttl <= 0 {
+
+		return fmt.Errorf("error setting key %s: ttl %v is not positive", key, ttl)
+	}
+
+	_, err := conn.Set(ctx, ks.Key(key), value, ttl).Result()
+	if err != nil {
+
+		log.Error(ctx, "error saving redis key", err, LogFields{
+			"key": key,
+		})
+
+		return fmt.Errorf("error setting key %s: %v", key, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,347 @@
+package wallet
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Secrets are sealed in the v2 format, which binds the purpose of the secret, the client ID
+// and the key ID as additional data.
+const secretCiphertextVersion = "v2:"
+
+// Purposes of a sealed secret, so that a credential secret copied over the client secret
+// of the same client, or the other way round, does not open.
+const (
+	secretPurposeClient     = "client"
+	secretPurposeCredential = "credential"
+)
+
+var ErrUnknownSecretKey = errors.New("unknown secret key id")
+
+// KeyProvider wraps and unwraps the per-secret data keys used by SecretCipher. It is the
+// seam for a KMS: a remote implementation never has to reveal its key encryption keys.
+type KeyProvider interface {
+	CurrentKeyID() string
+	WrapKey(ctx context.Context, keyID string, dataKey []byte) ([]byte, error)
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// StaticKeyProvider holds AES-256 key encryption keys in memory.
+type StaticKeyProvider struct {
+	Current string
+	Keys    map[string][]byte
+}
+
+func NewStaticKeyProvider(current string, keys map[string][]byte) (*StaticKeyProvider, error) {
+
+	if _, ok := keys[current]; !ok {
+
+		return nil, fmt.Errorf("current secret key %q is not in the key set", current)
+	}
+
+	for id, key := range keys {
+
+		if len(key) != 32 {
+
+			return nil, fmt.Errorf("secret key %q must be 32 bytes", id)
+		}
+
+		if strings.Contains(id, ":") {
+
+			return nil, fmt.Errorf("secret key id %q must not contain ':'", id)
+		}
+	}
+
+	return &StaticKeyProvider{Current: current, Keys: keys}, nil
+}
+
+// NewEnvKeyProvider reads keys from CLIENT_SECRET_KEYS as comma separated id:base64 pairs
+// and the current key ID from CLIENT_SECRET_KEY_ID.
+func NewEnvKeyProvider() (*StaticKeyProvider, error) {
+
+	keys := make(map[string][]byte)
+
+	for _, pair := range strings.Split(os.Getenv("CLIENT_SECRET_KEYS"), ",") {
+
+		pair = strings.TrimSpace(pair)
+		if len(pair) == 0 {
+
+			continue
+		}
+
+		id, encoded, found := strings.Cut(pair, ":")
+		if !found {
+
+			return nil, fmt.Errorf("CLIENT_SECRET_KEYS entry %q is not id:base64", id)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+
+			return nil, fmt.Errorf("CLIENT_SECRET_KEYS entry %s: %v", id, err)
+		}
+
+		keys[id] = key
+	}
+
+	return NewStaticKeyProvider(os.Getenv("CLIENT_SECRET_KEY_ID"), keys)
+}
+
+// NewFileKeyProvider reads a JSON key file of the form
+// {"current": "k2", "keys": {"k1": "<base64>", "k2": "<base64>"}}.
+func NewFileKeyProvider(path string) (*StaticKeyProvider, error) {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+
+		return nil, err
+	}
+
+	var file struct {
+		Current string            `json:"current"`
+		Keys    map[string]string `json:"keys"`
+	}
+
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+
+		return nil, fmt.Errorf("invalid key file %s: %v", path, err)
+	}
+
+	keys := make(map[string][]byte)
+	for id, encoded := range file.Keys {
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+
+			return nil, fmt.Errorf("key file %s, key %s: %v", path, id, err)
+		}
+
+		keys[id] = key
+	}
+
+	return NewStaticKeyProvider(file.Current, keys)
+}
+
+func (p *StaticKeyProvider) CurrentKeyID() string {
+
+	return p.Current
+}
+
+func (p *StaticKeyProvider) WrapKey(ctx context.Context, keyID string, dataKey []byte) ([]byte, error) {
+
+	kek, ok := p.Keys[keyID]
+	if !ok {
+
+		return nil, ErrUnknownSecretKey
+	}
+
+	return sealAESGCM(kek, dataKey, nil)
+}
+
+func (p *StaticKeyProvider) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+
+	kek, ok := p.Keys[keyID]
+	if !ok {
+
+		return nil, ErrUnknownSecretKey
+	}
+
+	return openAESGCM(kek, wrapped, nil)
+}
+
+// SecretCipher envelope-encrypts operator secrets: each secret is sealed with a fresh
+// AES-256-GCM data key, and the data key is wrapped by the KeyProvider under a key ID
+// that is stored beside the ciphertext.
+type SecretCipher struct {
+	Keys KeyProvider
+}
+
+// NewEnvSecretCipher returns a cipher over NewEnvKeyProvider, or nil when CLIENT_SECRET_KEYS
+// is not set and secrets are stored in plaintext.
+func NewEnvSecretCipher() (*SecretCipher, error) {
+
+	if len(os.Getenv("CLIENT_SECRET_KEYS")) == 0 {
+
+		return nil, nil
+	}
+
+	keys, err := NewEnvKeyProvider()
+	if err != nil {
+
+		return nil, err
+	}
+
+	return &SecretCipher{Keys: keys}, nil
+}
+
+// secretAAD binds a sealed secret to its purpose, client and key, so a ciphertext copied
+// onto another client's row or into another column does not open. Client secrets keep
+// the additional data they were first sealed with.
+func secretAAD(purpose string, clientID int64, keyID string) []byte {
+
+	if purpose == secretPurposeClient {
+
+		return []byte(fmt.Sprintf("client:%d|key:%s", clientID, keyID))
+	}
+
+	return []byte(fmt.Sprintf("%s|client:%d|key:%s", purpose, clientID, keyID))
+}
+
+// Encrypt seals the secret of client clientID under the current key.
+func (c *SecretCipher) Encrypt(ctx context.Context, clientID int64, plaintext string) (ciphertext string, keyID string, err error) {
+
+	return c.seal(ctx, secretPurposeClient, clientID, plaintext)
+}
+
+// EncryptCredential seals the secret of a credential of client clientID under the current key.
+func (c *SecretCipher) EncryptCredential(ctx context.Context, clientID int64, plaintext string) (ciphertext string, keyID string, err error) {
+
+	return c.seal(ctx, secretPurposeCredential, clientID, plaintext)
+}
+
+func (c *SecretCipher) seal(ctx context.Context, purpose string, clientID int64, plaintext string) (ciphertext string, keyID string, err error) {
+
+	keyID = c.Keys.CurrentKeyID()
+
+	dataKey := make([]byte, 32)
+	_, err = rand.Read(dataKey)
+	if err != nil {
+
+		return "", "", err
+	}
+
+	wrapped, err := c.Keys.WrapKey(ctx, keyID, dataKey)
+	if err != nil {
+
+		return "", "", err
+	}
+
+	sealed, err := sealAESGCM(dataKey, []byte(plaintext), secretAAD(purpose, clientID, keyID))
+	if err != nil {
+
+		return "", "", err
+	}
+
+	envelope := make([]byte, 2, 2+len(wrapped)+len(sealed))
+	binary.BigEndian.PutUint16(envelope, uint16(len(wrapped)))
+	envelope = append(envelope, wrapped...)
+	envelope = append(envelope, sealed...)
+
+	return secretCiphertextVersion + base64.StdEncoding.EncodeToString(envelope), keyID, nil
+}
+
+// Decrypt opens a secret of client clientID produced by Encrypt. Secrets stored before
+// encryption was enabled have no key ID and are returned unchanged.
+func (c *SecretCipher) Decrypt(ctx context.Context, clientID int64, ciphertext string, keyID string) (string, error) {
+
+	return c.open(ctx, secretPurposeClient, clientID, ciphertext, keyID)
+}
+
+// DecryptCredential opens a credential secret of client clientID produced by EncryptCredential.
+func (c *SecretCipher) DecryptCredential(ctx context.Context, clientID int64, ciphertext string, keyID string) (string, error) {
+
+	return c.open(ctx, secretPurposeCredential, clientID, ciphertext, keyID)
+}
+
+func (c *SecretCipher) open(ctx context.Context, purpose string, clientID int64, ciphertext string, keyID string) (string, error) {
+
+	if len(keyID) == 0 {
+
+		return ciphertext, nil
+	}
+
+	encoded, found := strings.CutPrefix(ciphertext, secretCiphertextVersion)
+	if !found {
+
+		return "", fmt.Errorf("unsupported secret ciphertext format")
+	}
+
+	envelope, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(envelope) < 2 {
+
+		return "", fmt.Errorf("malformed secret ciphertext")
+	}
+
+	wrappedLen := int(binary.BigEndian.Uint16(envelope))
+	if len(envelope) < 2+wrappedLen {
+
+		return "", fmt.Errorf("malformed secret ciphertext")
+	}
+
+	dataKey, err := c.Keys.UnwrapKey(ctx, keyID, envelope[2:2+wrappedLen])
+	if err != nil {
+
+		return "", err
+	}
+
+	plaintext, err := openAESGCM(dataKey, envelope[2+wrappedLen:], secretAAD(purpose, clientID, keyID))
+	if err != nil {
+
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// IsCurrent reports whether a secret stored under keyID is sealed with the current key,
+// so ReencryptSecrets can skip it.
+func (c *SecretCipher) IsCurrent(ciphertext string, keyID string) bool {
+
+	return keyID == c.Keys.CurrentKeyID() && strings.HasPrefix(ciphertext, secretCiphertextVersion)
+}
+
+func sealAESGCM(key, plaintext, aad []byte) ([]byte, error) {
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func openAESGCM(key, sealed, aad []byte) ([]byte, error) {
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+
+		return nil, fmt.Errorf("sealed secret too short")
+	}
+
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], aad)
+}
@@ -0,0 +1,232 @@
+package wallet
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func testKeyProvider(t *testing.T, current string, ids ...string) *StaticKeyProvider {
+
+	t.Helper()
+
+	keys := make(map[string][]byte)
+	for _, id := range ids {
+
+		keys[id] = bytes.Repeat([]byte(id[:1]), 32)
+	}
+
+	keys[current] = bytes.Repeat([]byte(current[:1]), 32)
+
+	provider, err := NewStaticKeyProvider(current, keys)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	return provider
+}
+
+func TestSecretCipherRoundTrip(t *testing.T) {
+
+	ctx := context.Background()
+	c := &SecretCipher{Keys: testKeyProvider(t, "k1")}
+
+	ciphertext, keyID, err := c.Encrypt(ctx, 7, "s3cret")
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	if keyID != "k1" || strings.Contains(ciphertext, "s3cret") {
+
+		t.Fatalf("Encrypt = %q, %q", ciphertext, keyID)
+	}
+
+	plaintext, err := c.Decrypt(ctx, 7, ciphertext, keyID)
+	if err != nil || plaintext != "s3cret" {
+
+		t.Fatalf("Decrypt = %q, %v", plaintext, err)
+	}
+
+	plaintext, err = c.Decrypt(ctx, 7, "plain", "")
+	if err != nil || plaintext != "plain" {
+
+		t.Fatalf("Decrypt without key ID = %q, %v", plaintext, err)
+	}
+}
+
+func TestSecretCipherBindsClient(t *testing.T) {
+
+	ctx := context.Background()
+	c := &SecretCipher{Keys: testKeyProvider(t, "k1")}
+
+	ciphertext, keyID, err := c.Encrypt(ctx, 7, "s3cret")
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	_, err = c.Decrypt(ctx, 8, ciphertext, keyID)
+	if err == nil {
+
+		t.Fatal("secret of client 7 opened as client 8")
+	}
+
+	_, err = c.Decrypt(ctx, 7, ciphertext, "k2")
+	if err == nil {
+
+		t.Fatal("secret opened under another key ID")
+	}
+}
+
+func TestSecretCipherBindsPurpose(t *testing.T) {
+
+	ctx := context.Background()
+	c := &SecretCipher{Keys: testKeyProvider(t, "k1")}
+
+	ciphertext, keyID, err := c.EncryptCredential(ctx, 7, "s3cret")
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	_, err = c.Decrypt(ctx, 7, ciphertext, keyID)
+	if err == nil {
+
+		t.Fatal("credential secret opened as the client secret")
+	}
+
+	plaintext, err := c.DecryptCredential(ctx, 7, ciphertext, keyID)
+	if err != nil || plaintext != "s3cret" {
+
+		t.Fatalf("DecryptCredential = %q, %v", plaintext, err)
+	}
+}
+
+func TestReencryptSecrets(t *testing.T) {
+
+	ctx := context.Background()
+	store := newTestClientStore(t)
+
+	registry := &ClientRegistry{Store: store}
+
+	err := registry.Create(ctx, Client{ID: 1, BaseURL: "http://one", AuthenticationHeader: "X-Auth", AuthenticationString: "one"})
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	registry.Cipher = &SecretCipher{Keys: testKeyProvider(t, "k1")}
+
+	err = registry.Create(ctx, Client{ID: 2, BaseURL: "http://two", AuthenticationHeader: "X-Auth", AuthenticationString: "two"})
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	_, err = registry.StageCredential(ctx, Credential{ClientID: 2, Header: "X-Auth", Secret: "two-next"})
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	registry.Cipher = &SecretCipher{Keys: testKeyProvider(t, "k2", "k1")}
+
+	count, err := registry.ReencryptSecrets(ctx)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	if count != 3 {
+
+		t.Fatalf("ReencryptSecrets = %d, want 3", count)
+	}
+
+	count, err = registry.ReencryptSecrets(ctx)
+	if err != nil || count != 0 {
+
+		t.Fatalf("second ReencryptSecrets = %d, %v, want 0", count, err)
+	}
+
+	for id, want := range map[int64]string{1: "one", 2: "two"} {
+
+		stored, err := store.Get(ctx, id)
+		if err != nil {
+
+			t.Fatal(err)
+		}
+
+		if stored.AuthenticationKeyID != "k2" || stored.AuthenticationString == want {
+
+			t.Fatalf("client %d stored as %q under %q", id, stored.AuthenticationString, stored.AuthenticationKeyID)
+		}
+
+		client, err := registry.Get(ctx, id)
+		if err != nil {
+
+			t.Fatal(err)
+		}
+
+		if client.AuthenticationString != want {
+
+			t.Fatalf("client %d secret = %q, want %q", id, client.AuthenticationString, want)
+		}
+	}
+
+	client, err := registry.Get(ctx, 2)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	if len(client.Credentials) != 1 || client.Credentials[0].Secret != "two-next" {
+
+		t.Fatalf("credentials of client 2 = %+v", client.Credentials)
+	}
+}
+
+func TestLegacyClientEncryption(t *testing.T) {
+
+	ctx := context.Background()
+	store := newTestClientStore(t)
+
+	t.Setenv("CLIENT_SECRET_KEYS", "k1:"+base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("k"), 32)))
+	t.Setenv("CLIENT_SECRET_KEY_ID", "k1")
+
+	c, err := NewEnvSecretCipher()
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	registry := &ClientRegistry{Store: store, Cipher: c}
+
+	err = registry.Create(ctx, Client{ID: 1, BaseURL: "http://one", AuthenticationHeader: "X-Auth", AuthenticationString: "one"})
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	client, err := GetClient(store.Tracer, ctx, store.DB, 1)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	if client.AuthenticationString != "one" || len(client.AuthenticationKeyID) > 0 {
+
+		t.Fatalf("GetClient = %q under %q, want the decrypted secret", client.AuthenticationString, client.AuthenticationKeyID)
+	}
+
+	t.Setenv("CLIENT_SECRET_KEYS", "")
+
+	_, err = GetClient(store.Tracer, ctx, store.DB, 1)
+	if err == nil {
+
+		t.Fatal("GetClient returned an encrypted secret without keys")
+	}
+}
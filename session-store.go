@@ -0,0 +1,283 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+type TokenMode int
+
+const (
+	// TokenModeRedis issues opaque tokens that are resolved with a Redis lookup on every validation.
+	TokenModeRedis TokenMode = iota
+	// TokenModeSigned issues self-contained signed tokens that are validated locally.
+	TokenModeSigned
+)
+
+// SessionStore issues and validates player session tokens in the selected TokenMode.
+// Redis is required for TokenModeRedis and optional for TokenModeSigned, where it only
+// backs the revocation list. Session lifetime is the KeySpace TTL of KeyFamilySession.
+// Replayed launch tokens are recorded in Audit when it is set.
+type SessionStore struct {
+	Mode       TokenMode
+	Redis      redis.UniversalClient
+	KeySpace   KeySpace
+	Signer     *TokenSigner
+	AccountIDs AccountIDCodec
+	Logger     Logger
+	Audit      AuditSink
+}
+
+// NewSessionStore returns a store issuing tokens in mode, rejecting an invalid key space
+// and a mode without what it needs: a Redis connection for TokenModeRedis, a signer for
+// TokenModeSigned.
+func NewSessionStore(mode TokenMode, redisConn redis.UniversalClient, ks KeySpace, signer *TokenSigner) (*SessionStore, error) {
+
+	err := ks.Validate()
+	if err != nil {
+
+		return nil, err
+	}
+
+	switch mode {
+
+	case TokenModeRedis:
+		if redisConn == nil {
+
+			return nil, fmt.Errorf("redis session store requires a redis connection")
+		}
+
+	case TokenModeSigned:
+		if signer == nil {
+
+			return nil, fmt.Errorf("signed session store requires a signer")
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported token mode %d", mode)
+	}
+
+	s := &SessionStore{
+		Mode:       mode,
+		Redis:      redisConn,
+		KeySpace:   ks,
+		Signer:     signer,
+		AccountIDs: DefaultAccountIDCodec(),
+	}
+
+	err = s.AccountIDs.Validate()
+	if err != nil {
+
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *SessionStore) log() contextLogger {
+
+	return logTo(s.Logger)
+}
+
+// Issue creates a token for claims. SessionID, IssuedAt and ExpiresAt are filled in when empty.
+func (s *SessionStore) Issue(ctx context.Context, claims SessionClaims) (string, error) {
+
+	switch s.Mode {
+
+	case TokenModeRedis:
+		if s.Redis == nil {
+
+			return "", fmt.Errorf("redis session store has no redis connection")
+		}
+
+		profileID := claims.PlayerID
+		if claims.ClientID > 0 {
+
+			account, err := s.AccountIDs.Encode(AccountID{ClientID: claims.ClientID, PlayerID: claims.PlayerID})
+			if err != nil {
+
+				return "", err
+			}
+
+			profileID = account
+		}
+
+		return generateToken(s.Redis, s.KeySpace, profileID, s.log(), ctx), nil
+
+	case TokenModeSigned:
+		if s.Signer == nil {
+
+			return "", fmt.Errorf("signed session store has no signer")
+		}
+
+		now := time.Now()
+
+		if len(claims.SessionID) == 0 {
+
+			claims.SessionID = uuid.New().String()
+		}
+
+		if claims.IssuedAt == 0 {
+
+			claims.IssuedAt = now.Unix()
+		}
+
+		if claims.ExpiresAt == 0 {
+
+			claims.ExpiresAt = now.Add(s.KeySpace.TTL(KeyFamilySession)).Unix()
+		}
+
+		return s.Signer.Sign(claims)
+	}
+
+	return "", fmt.Errorf("unsupported token mode %d", s.Mode)
+}
+
+// Validate resolves token to its claims. Redis mode tokens carry the stored account ID,
+// split into client and player when it decodes, and the token itself is the session ID.
+func (s *SessionStore) Validate(ctx context.Context, token string) (*SessionClaims, error) {
+
+	switch s.Mode {
+
+	case TokenModeRedis:
+		if s.Redis == nil {
+
+			return nil, fmt.Errorf("redis session store has no redis connection")
+		}
+
+		profileID, err := s.profileID(ctx, token)
+		if err != nil {
+
+			return nil, err
+		}
+
+		claims := &SessionClaims{PlayerID: profileID, SessionID: token}
+
+		account, err := s.AccountIDs.Decode(profileID)
+		if err == nil {
+
+			claims.ClientID = account.ClientID
+			claims.PlayerID = account.PlayerID
+		}
+
+		return claims, nil
+
+	case TokenModeSigned:
+		if s.Signer == nil {
+
+			return nil, fmt.Errorf("signed session store has no signer")
+		}
+
+		return ValidateSignedToken(s.Redis, s.KeySpace, s.Signer, token, ctx)
+	}
+
+	return nil, fmt.Errorf("unsupported token mode %d", s.Mode)
+}
+
+// profileID resolves an opaque token, telling an unknown token apart from a Redis failure.
+func (s *SessionStore) profileID(ctx context.Context, token string) (string, error) {
+
+	profileID, err := GetRedisKey(s.Redis, s.KeySpace, tokenKey(token), ctx)
+	if errors.Is(err, redis.Nil) || (err == nil && len(profileID) == 0) {
+
+		return "", ErrInvalidToken
+	}
+
+	return profileID, err
+}
+
+// Revoke ends the session behind token before it expires.
+func (s *SessionStore) Revoke(ctx context.Context, token string) error {
+
+	claims, err := s.Validate(ctx, token)
+	if err != nil {
+
+		return err
+	}
+
+	switch s.Mode {
+
+	case TokenModeRedis:
+		profileID := GetProfileIDFromtoken(s.Redis, s.KeySpace, token, ctx)
+
+		if GetSessionID(s.Redis, s.KeySpace, profileID, ctx) == token {
+
+			return DeleteSession(s.Redis, s.KeySpace, profileID, ctx)
+		}
+
+		return DelRedisKey(s.Redis, s.KeySpace, tokenKey(token), ctx)
+
+	case TokenModeSigned:
+		if s.Redis == nil {
+
+			return fmt.Errorf("revocation requires a redis connection")
+		}
+
+		return revokeSignedSession(s.Redis, s.KeySpace, *claims, s.log(), ctx)
+	}
+
+	return fmt.Errorf("unsupported token mode %d", s.Mode)
+}
+
+// Refresh slides the session of a validated token and returns the token the client should
+// use from now on. Redis sessions get a full session TTL again and keep their token.
+// Signed tokens cannot be extended, so once less than half of their lifetime remains a
+// new token with the same claims is issued; until then token is returned unchanged.
+func (s *SessionStore) Refresh(ctx context.Context, token string, claims *SessionClaims) (string, error) {
+
+	switch s.Mode {
+
+	case TokenModeRedis:
+		if s.Redis == nil {
+
+			return "", fmt.Errorf("redis session store has no redis connection")
+		}
+
+		profileID, err := s.profileID(ctx, token)
+		if err != nil {
+
+			return "", err
+		}
+
+		current := GetSessionID(s.Redis, s.KeySpace, profileID, ctx) == token
+
+		_, err = s.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+
+			pipe.Expire(ctx, s.KeySpace.Key(tokenKey(token)), s.KeySpace.TTL(KeyFamilyToken))
+			if current {
+
+				pipe.Expire(ctx, s.KeySpace.Key(sessionKey(profileID)), s.KeySpace.TTL(KeyFamilySession))
+			}
+
+			return nil
+		})
+		if err != nil {
+
+			return "", err
+		}
+
+		return token, nil
+
+	case TokenModeSigned:
+		// Tokens without an expiry have nothing to slide.
+		lifetime := claims.ExpiresAt - claims.IssuedAt
+		if claims.ExpiresAt <= 0 || lifetime <= 0 || claims.ExpiresAt-time.Now().Unix() > lifetime/2 {
+
+			return token, nil
+		}
+
+		return s.Issue(ctx, SessionClaims{
+			PlayerID:  claims.PlayerID,
+			ClientID:  claims.ClientID,
+			GameID:    claims.GameID,
+			SessionID: claims.SessionID,
+		})
+	}
+
+	return "", fmt.Errorf("unsupported token mode %d", s.Mode)
+}
@@ -0,0 +1,69 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSessionStoreRefreshWithoutExpiry(t *testing.T) {
+
+	signer, err := NewTokenSigner(hmacKey("h1"))
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	store, err := NewSessionStore(TokenModeSigned, nil, KeySpace{Prefix: "test"}, signer)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	claims := SessionClaims{PlayerID: "p1", ClientID: 1, SessionID: "s1"}
+
+	token, err := signer.Sign(claims)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	refreshed, err := store.Refresh(context.Background(), token, &claims)
+	if err != nil || refreshed != token {
+
+		t.Fatalf("Refresh of a token without expiry = %q, %v, want the same token", refreshed, err)
+	}
+}
+
+// A Redis outage must not be reported as an invalid token, or every player is logged out.
+func TestSessionStoreValidateRedisOutage(t *testing.T) {
+
+	ctx := context.Background()
+	server, conn := newTestRedis(t)
+
+	store, err := NewSessionStore(TokenModeRedis, conn, KeySpace{Prefix: "test"}, nil)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	_, err = store.Validate(ctx, "unknown")
+	if !errors.Is(err, ErrInvalidToken) {
+
+		t.Fatalf("Validate(unknown) = %v, want ErrInvalidToken", err)
+	}
+
+	server.Close()
+
+	_, err = store.Validate(ctx, "unknown")
+	if err == nil || errors.Is(err, ErrInvalidToken) {
+
+		t.Fatalf("Validate during an outage = %v, want a Redis error", err)
+	}
+
+	_, err = store.Refresh(ctx, "unknown", nil)
+	if err == nil || errors.Is(err, ErrInvalidToken) {
+
+		t.Fatalf("Refresh during an outage = %v, want a Redis error", err)
+	}
+}
@@ -2,32 +2,127 @@ package wallet
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 )
 
-func GenerateToken(redisConn *redis.Client, profileID string, ctx context.Context) string {
+// playerHashTag returns the Redis Cluster hash tag shared by all keys of one player, so
+// they land in the same slot and can be used together in one transaction.
+func playerHashTag(profileID string) string {
 
-	token := uuid.New().String()
-	SetRedisKeyWithExpiry(redisConn, token, profileID, 60*60*5, ctx)
+	h := fnv.New32a()
+	h.Write([]byte(profileID))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// tokenHashTag extracts the player hash tag from a token issued by GenerateToken. Tokens
+// from before hash tags were introduced are bare UUIDs and return false.
+func tokenHashTag(token string) (string, bool) {
+
+	tag, rest, found := strings.Cut(token, "_")
+	if !found || len(tag) != 8 || len(rest) == 0 {
+
+		return "", false
+	}
+
+	return tag, true
+}
+
+func sessionKey(profileID string) string {
+
+	return fmt.Sprintf("%s:{%s}:%s", KeyFamilySession, playerHashTag(profileID), profileID)
+}
+
+func legacySessionKey(profileID string) string {
+
+	return fmt.Sprintf("%s:%s", KeyFamilySession, profileID)
+}
+
+func tokenKey(token string) string {
+
+	tag, ok := tokenHashTag(token)
+	if !ok {
+
+		return token
+	}
+
+	return fmt.Sprintf("%s:{%s}:%s", KeyFamilyToken, tag, token)
+}
+
+func GenerateToken(redisConn redis.UniversalClient, ks KeySpace, profileID string, ctx context.Context) string {
+
+	return generateToken(redisConn, ks, profileID, logTo(nil), ctx)
+}
 
-	sessionKeys := fmt.Sprintf("session:%s", profileID)
-	SetRedisKeyWithExpiry(redisConn, sessionKeys, token, 60*60*5, ctx)
+func generateToken(redisConn redis.UniversalClient, ks KeySpace, profileID string, log contextLogger, ctx context.Context) string {
+
+	token := fmt.Sprintf("%s_%s", playerHashTag(profileID), uuid.New().String())
+
+	_, err := redisConn.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+
+		pipe.Set(ctx, ks.Key(tokenKey(token)), profileID, ks.TTL(KeyFamilyToken))
+		pipe.Set(ctx, ks.Key(sessionKey(profileID)), token, ks.TTL(KeyFamilySession))
+		return nil
+	})
+	if err != nil {
+
+		log.Error(ctx, "error saving session", err, LogFields{
+			LogFieldPlayerID: profileID,
+		})
+	}
 
 	return token
 }
 
-func GetSessionID(redisConn *redis.Client, profileID string, ctx context.Context) string {
+func GetSessionID(redisConn redis.UniversalClient, ks KeySpace, profileID string, ctx context.Context) string {
 
-	sessionKeys := fmt.Sprintf("session:%s", profileID)
-	profile, _ := GetRedisKey(redisConn, sessionKeys, ctx)
-	return profile
+	token, err := GetRedisKey(redisConn, ks, sessionKey(profileID), ctx)
+	if err != nil && errors.Is(err, redis.Nil) {
+
+		token, _ = GetRedisKey(redisConn, ks, legacySessionKey(profileID), ctx)
+	}
+
+	return token
 }
 
-func GetProfileIDFromtoken(redisConn *redis.Client, token string, ctx context.Context) string {
+func GetProfileIDFromtoken(redisConn redis.UniversalClient, ks KeySpace, token string, ctx context.Context) string {
 
-	profile, _ := GetRedisKey(redisConn, token, ctx)
+	profile, _ := GetRedisKey(redisConn, ks, tokenKey(token), ctx)
 	return profile
 }
+
+// DeleteSession removes the player's current session and the token pointing to it.
+func DeleteSession(redisConn redis.UniversalClient, ks KeySpace, profileID string, ctx context.Context) error {
+
+	token := GetSessionID(redisConn, ks, profileID, ctx)
+
+	if _, ok := tokenHashTag(token); len(token) > 0 && !ok {
+
+		err := DelRedisKey(redisConn, ks, token, ctx)
+		if err != nil {
+
+			return err
+		}
+
+		return DelRedisKey(redisConn, ks, legacySessionKey(profileID), ctx)
+	}
+
+	keys := []string{ks.Key(sessionKey(profileID))}
+	if len(token) > 0 {
+
+		keys = append(keys, ks.Key(tokenKey(token)))
+	}
+
+	_, err := redisConn.Del(ctx, keys...).Result()
+	if err != nil {
+
+		return fmt.Errorf("error deleting session for %s: %v", profileID, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,348 @@
+package wallet
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const signedTokenVersion = "v1"
+
+const (
+	SigningAlgorithmHMAC    SigningAlgorithm = "HS256"
+	SigningAlgorithmEd25519 SigningAlgorithm = "EdDSA"
+)
+
+var (
+	ErrInvalidToken  = errors.New("invalid session token")
+	ErrTokenExpired  = errors.New("session token expired")
+	ErrTokenRevoked  = errors.New("session token revoked")
+	ErrUnknownKeyID  = errors.New("unknown signing key id")
+	ErrNoSigningKeys = errors.New("no active signing key")
+)
+
+type SigningAlgorithm string
+
+// SessionClaims is the payload carried by a signed session token.
+type SessionClaims struct {
+	PlayerID  string `json:"pid"`
+	ClientID  int64  `json:"cid"`
+	GameID    string `json:"gid,omitempty"`
+	SessionID string `json:"sid"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+func (c SessionClaims) Expired(now time.Time) bool {
+
+	return c.ExpiresAt > 0 && now.Unix() >= c.ExpiresAt
+}
+
+// SigningKey is one entry of the token key ring. HMAC keys use Secret, Ed25519 keys use
+// PrivateKey for signing and PublicKey for verification; a verify-only key may omit PrivateKey.
+type SigningKey struct {
+	ID         string
+	Algorithm  SigningAlgorithm
+	Secret     []byte
+	PrivateKey ed25519.PrivateKey
+	PublicKey  ed25519.PublicKey
+}
+
+func (k SigningKey) validate() error {
+
+	if len(k.ID) == 0 || strings.Contains(k.ID, ".") {
+
+		return fmt.Errorf("signing key id %q is empty or contains '.'", k.ID)
+	}
+
+	switch k.Algorithm {
+
+	case SigningAlgorithmHMAC:
+		if len(k.Secret) < 32 {
+
+			return fmt.Errorf("signing key %s: HMAC secret must be at least 32 bytes", k.ID)
+		}
+
+	case SigningAlgorithmEd25519:
+		if len(k.PublicKey) != ed25519.PublicKeySize && len(k.PrivateKey) != ed25519.PrivateKeySize {
+
+			return fmt.Errorf("signing key %s: missing Ed25519 key material", k.ID)
+		}
+
+	default:
+		return fmt.Errorf("signing key %s: unsupported algorithm %q", k.ID, k.Algorithm)
+	}
+
+	return nil
+}
+
+func (k SigningKey) sign(input []byte) ([]byte, error) {
+
+	switch k.Algorithm {
+
+	case SigningAlgorithmHMAC:
+		mac := hmac.New(sha256.New, k.Secret)
+		mac.Write(input)
+		return mac.Sum(nil), nil
+
+	case SigningAlgorithmEd25519:
+		if len(k.PrivateKey) != ed25519.PrivateKeySize {
+
+			return nil, fmt.Errorf("signing key %s is verify-only", k.ID)
+		}
+
+		return ed25519.Sign(k.PrivateKey, input), nil
+	}
+
+	return nil, fmt.Errorf("signing key %s: unsupported algorithm %q", k.ID, k.Algorithm)
+}
+
+func (k SigningKey) verify(input, signature []byte) bool {
+
+	switch k.Algorithm {
+
+	case SigningAlgorithmHMAC:
+		mac := hmac.New(sha256.New, k.Secret)
+		mac.Write(input)
+		return hmac.Equal(mac.Sum(nil), signature)
+
+	case SigningAlgorithmEd25519:
+		pub := k.PublicKey
+		if len(pub) != ed25519.PublicKeySize {
+
+			pub = k.PrivateKey.Public().(ed25519.PublicKey)
+		}
+
+		return ed25519.Verify(pub, input, signature)
+	}
+
+	return false
+}
+
+// TokenSigner signs and verifies compact session tokens of the form
+// v1.<key id>.<payload>.<signature>. Older keys stay in the ring for verification
+// after Rotate so tokens issued before a rotation remain valid until they expire.
+type TokenSigner struct {
+	mu       sync.RWMutex
+	activeID string
+	keys     map[string]SigningKey
+}
+
+func NewTokenSigner(active SigningKey, verifyOnly ...SigningKey) (*TokenSigner, error) {
+
+	s := &TokenSigner{keys: make(map[string]SigningKey)}
+
+	for _, k := range verifyOnly {
+
+		if err := s.AddKey(k); err != nil {
+
+			return nil, err
+		}
+	}
+
+	if err := s.Rotate(active); err != nil {
+
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// AddKey adds a key used only for verification.
+func (s *TokenSigner) AddKey(k SigningKey) error {
+
+	if err := k.validate(); err != nil {
+
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[k.ID] = k
+	return nil
+}
+
+// Rotate adds k to the ring and makes it the key new tokens are signed with.
+func (s *TokenSigner) Rotate(k SigningKey) error {
+
+	if err := s.AddKey(k); err != nil {
+
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.activeID = k.ID
+	return nil
+}
+
+// RemoveKey drops a retired key; tokens signed with it stop validating.
+func (s *TokenSigner) RemoveKey(id string) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id == s.activeID {
+
+		s.activeID = ""
+	}
+
+	delete(s.keys, id)
+}
+
+func (s *TokenSigner) Sign(claims SessionClaims) (string, error) {
+
+	s.mu.RLock()
+	key, ok := s.keys[s.activeID]
+	s.mu.RUnlock()
+
+	if !ok {
+
+		return "", ErrNoSigningKeys
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+
+		return "", err
+	}
+
+	signingInput := fmt.Sprintf("%s.%s.%s", signedTokenVersion, key.ID, base64.RawURLEncoding.EncodeToString(payload))
+
+	signature, err := key.sign([]byte(signingInput))
+	if err != nil {
+
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Verify checks the signature and expiry of token and returns its claims.
+func (s *TokenSigner) Verify(token string) (*SessionClaims, error) {
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 4 || parts[0] != signedTokenVersion {
+
+		return nil, ErrInvalidToken
+	}
+
+	s.mu.RLock()
+	key, ok := s.keys[parts[1]]
+	s.mu.RUnlock()
+
+	if !ok {
+
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, ErrUnknownKeyID)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[3])
+	if err != nil {
+
+		return nil, ErrInvalidToken
+	}
+
+	signingInput := token[:len(token)-len(parts[3])-1]
+	if !key.verify([]byte(signingInput), signature) {
+
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+
+		return nil, ErrInvalidToken
+	}
+
+	claims := new(SessionClaims)
+	err = json.Unmarshal(payload, claims)
+	if err != nil {
+
+		return nil, ErrInvalidToken
+	}
+
+	if claims.Expired(time.Now()) {
+
+		return claims, ErrTokenExpired
+	}
+
+	return claims, nil
+}
+
+// IsSignedToken reports whether token uses the signed format rather than a Redis lookup token.
+func IsSignedToken(token string) bool {
+
+	return strings.HasPrefix(token, signedTokenVersion+".") && strings.Count(token, ".") == 3
+}
+
+func revokedSessionKey(sessionID string) string {
+
+	return fmt.Sprintf("%s:%s", KeyFamilyRevoked, sessionID)
+}
+
+// RevokeSignedSession adds the session to the Redis revocation list until the token would
+// have expired anyway. Tokens without an expiry never stop validating, so their revocation
+// is kept for good.
+func RevokeSignedSession(redisConn redis.UniversalClient, ks KeySpace, claims SessionClaims, ctx context.Context) error {
+
+	return revokeSignedSession(redisConn, ks, claims, logTo(nil), ctx)
+}
+
+func revokeSignedSession(redisConn redis.UniversalClient, ks KeySpace, claims SessionClaims, log contextLogger, ctx context.Context) error {
+
+	ttl := 0
+
+	if claims.ExpiresAt > 0 {
+
+		remaining := claims.ExpiresAt - time.Now().Unix()
+		if remaining <= 0 {
+
+			return nil
+		}
+
+		ttl = int(remaining)
+	}
+
+	return setRedisKeyWithExpiry(redisConn, ks, revokedSessionKey(claims.SessionID), "1", ttl, log, ctx)
+}
+
+// ValidateSignedToken verifies token locally and, when redisConn is not nil, checks the
+// revocation list.
+func ValidateSignedToken(redisConn redis.UniversalClient, ks KeySpace, signer *TokenSigner, token string, ctx context.Context) (*SessionClaims, error) {
+
+	claims, err := signer.Verify(token)
+	if err != nil {
+
+		return nil, err
+	}
+
+	if redisConn == nil {
+
+		return claims, nil
+	}
+
+	revoked, err := ExistsRedisKey(redisConn, ks, revokedSessionKey(claims.SessionID), ctx)
+	if err != nil {
+
+		return nil, err
+	}
+
+	if revoked {
+
+		return nil, ErrTokenRevoked
+	}
+
+	return claims, nil
+}
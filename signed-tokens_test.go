@@ -0,0 +1,263 @@
+package wallet
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func hmacKey(id string) SigningKey {
+
+	return SigningKey{ID: id, Algorithm: SigningAlgorithmHMAC, Secret: []byte(strings.Repeat(id, 32))}
+}
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, redis.UniversalClient) {
+
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	conn := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { conn.Close() })
+
+	return server, conn
+}
+
+func TestTokenSignerSignVerify(t *testing.T) {
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	keys := []SigningKey{
+		hmacKey("h1"),
+		{ID: "e1", Algorithm: SigningAlgorithmEd25519, PrivateKey: private},
+	}
+
+	for _, key := range keys {
+
+		t.Run(string(key.Algorithm), func(t *testing.T) {
+
+			signer, err := NewTokenSigner(key)
+			if err != nil {
+
+				t.Fatal(err)
+			}
+
+			claims := SessionClaims{PlayerID: "p1", ClientID: 7, SessionID: "s1", ExpiresAt: time.Now().Add(time.Hour).Unix()}
+
+			token, err := signer.Sign(claims)
+			if err != nil {
+
+				t.Fatal(err)
+			}
+
+			if !IsSignedToken(token) {
+
+				t.Fatalf("IsSignedToken(%q) = false", token)
+			}
+
+			got, err := signer.Verify(token)
+			if err != nil {
+
+				t.Fatal(err)
+			}
+
+			if *got != claims {
+
+				t.Fatalf("Verify = %+v, want %+v", *got, claims)
+			}
+
+			parts := strings.Split(token, ".")
+			tampered := strings.Join([]string{parts[0], parts[1], parts[2] + "x", parts[3]}, ".")
+
+			_, err = signer.Verify(tampered)
+			if !errors.Is(err, ErrInvalidToken) {
+
+				t.Fatalf("Verify(tampered) = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestTokenSignerExpiry(t *testing.T) {
+
+	signer, err := NewTokenSigner(hmacKey("h1"))
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	token, err := signer.Sign(SessionClaims{PlayerID: "p1", SessionID: "s1", ExpiresAt: time.Now().Add(-time.Second).Unix()})
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	_, err = signer.Verify(token)
+	if !errors.Is(err, ErrTokenExpired) {
+
+		t.Fatalf("Verify(expired) = %v, want ErrTokenExpired", err)
+	}
+}
+
+func TestTokenSignerRotation(t *testing.T) {
+
+	signer, err := NewTokenSigner(hmacKey("k1"))
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	old, err := signer.Sign(SessionClaims{PlayerID: "p1", SessionID: "s1"})
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	err = signer.Rotate(hmacKey("k2"))
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	current, err := signer.Sign(SessionClaims{PlayerID: "p1", SessionID: "s2"})
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(current, "v1.k2.") {
+
+		t.Fatalf("token after rotation %q is not signed with k2", current)
+	}
+
+	_, err = signer.Verify(old)
+	if err != nil {
+
+		t.Fatalf("token signed before rotation: %v", err)
+	}
+
+	signer.RemoveKey("k1")
+
+	_, err = signer.Verify(old)
+	if !errors.Is(err, ErrUnknownKeyID) {
+
+		t.Fatalf("token of removed key: %v, want ErrUnknownKeyID", err)
+	}
+
+	_, err = signer.Verify(current)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	signer.RemoveKey("k2")
+
+	_, err = signer.Sign(SessionClaims{PlayerID: "p1"})
+	if !errors.Is(err, ErrNoSigningKeys) {
+
+		t.Fatalf("Sign without active key = %v, want ErrNoSigningKeys", err)
+	}
+}
+
+func TestSigningKeyValidate(t *testing.T) {
+
+	tests := []SigningKey{
+		{ID: "", Algorithm: SigningAlgorithmHMAC, Secret: make([]byte, 32)},
+		{ID: "a.b", Algorithm: SigningAlgorithmHMAC, Secret: make([]byte, 32)},
+		{ID: "short", Algorithm: SigningAlgorithmHMAC, Secret: make([]byte, 16)},
+		{ID: "ed", Algorithm: SigningAlgorithmEd25519},
+		{ID: "rsa", Algorithm: "RS256", Secret: make([]byte, 32)},
+	}
+
+	for _, key := range tests {
+
+		_, err := NewTokenSigner(key)
+		if err == nil {
+
+			t.Errorf("NewTokenSigner(%q, %s) accepted an invalid key", key.ID, key.Algorithm)
+		}
+	}
+}
+
+func TestRevokeSignedSession(t *testing.T) {
+
+	server, conn := newTestRedis(t)
+	ctx := context.Background()
+	ks := KeySpace{Prefix: "test"}
+
+	signer, err := NewTokenSigner(hmacKey("k1"))
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		expiresAt int64
+		ttl       time.Duration
+	}{
+		{"expiring", time.Now().Add(time.Hour).Unix(), time.Hour},
+		{"without expiry", 0, 0},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			claims := SessionClaims{PlayerID: "p1", SessionID: tt.name, ExpiresAt: tt.expiresAt}
+
+			token, err := signer.Sign(claims)
+			if err != nil {
+
+				t.Fatal(err)
+			}
+
+			err = RevokeSignedSession(conn, ks, claims, ctx)
+			if err != nil {
+
+				t.Fatal(err)
+			}
+
+			_, err = ValidateSignedToken(conn, ks, signer, token, ctx)
+			if !errors.Is(err, ErrTokenRevoked) {
+
+				t.Fatalf("ValidateSignedToken = %v, want ErrTokenRevoked", err)
+			}
+
+			ttl := server.TTL(ks.Key(revokedSessionKey(claims.SessionID)))
+			if tt.ttl == 0 {
+
+				// A token that never expires must stay revoked past the revocation TTL.
+				if ttl != 0 {
+
+					t.Fatalf("revocation TTL = %v, want none", ttl)
+				}
+
+				server.FastForward(ks.TTL(KeyFamilyRevoked) + time.Hour)
+
+				_, err = ValidateSignedToken(conn, ks, signer, token, ctx)
+				if !errors.Is(err, ErrTokenRevoked) {
+
+					t.Fatalf("ValidateSignedToken after the revocation TTL = %v, want ErrTokenRevoked", err)
+				}
+
+				return
+			}
+
+			if ttl <= 0 || ttl > tt.ttl || ttl < tt.ttl-time.Minute {
+
+				t.Fatalf("revocation TTL = %v, want about %v", ttl, tt.ttl)
+			}
+		})
+	}
+}
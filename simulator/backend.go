@@ -0,0 +1,268 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	wallet "github.com/touchvas/casino-wallet"
+	"github.com/touchvas/casino-wallet/operator"
+)
+
+const defaultCurrency = "KES"
+
+// Player is a simulated player account.
+type Player struct {
+	ID          string
+	DisplayName string
+	Balance     float64
+	Bonus       float64
+	Currency    string
+	Language    string
+}
+
+type transaction struct {
+	playerID   string
+	amount     float64
+	credited   bool
+	rolledBack bool
+	settled    bool
+}
+
+// MemoryBackend is an operator.WalletBackend keeping balances in memory. Credits and
+// rollbacks that name a debit must name one it processed. A debit is paid out once: it can
+// be credited or rolled back, but not both, and neither twice.
+type MemoryBackend struct {
+	mu      sync.Mutex
+	players map[string]*Player
+	debits  map[string]*transaction
+}
+
+func NewMemoryBackend() *MemoryBackend {
+
+	return &MemoryBackend{
+		players: make(map[string]*Player),
+		debits:  make(map[string]*transaction),
+	}
+}
+
+// SetPlayer creates or replaces a player.
+func (b *MemoryBackend) SetPlayer(player Player) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(player.Currency) == 0 {
+
+		player.Currency = defaultCurrency
+	}
+
+	b.players[player.ID] = &player
+}
+
+// Player returns a copy of the player with id.
+func (b *MemoryBackend) Player(id string) (Player, bool) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p, ok := b.players[id]
+	if !ok {
+
+		return Player{}, false
+	}
+
+	return *p, true
+}
+
+func (b *MemoryBackend) player(id string) (*Player, error) {
+
+	p, ok := b.players[id]
+	if !ok {
+
+		return nil, fmt.Errorf("%w: %s", operator.ErrPlayerNotFound, id)
+	}
+
+	return p, nil
+}
+
+func (b *MemoryBackend) Profile(ctx context.Context, req wallet.ProfileRequest) (*wallet.WalletProfile, error) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p, err := b.player(req.PlayerID)
+	if err != nil {
+
+		return nil, err
+	}
+
+	return &wallet.WalletProfile{
+		DisplayName: p.DisplayName,
+		ID:          p.ID,
+		Balance:     p.Balance,
+		Bonus:       p.Bonus,
+		Currency:    p.Currency,
+		Language:    p.Language,
+	}, nil
+}
+
+func (b *MemoryBackend) Debit(ctx context.Context, req wallet.DebitRequest) (*wallet.DebitTransactionResponse, error) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p, err := b.player(req.PlayerID)
+	if err != nil {
+
+		return nil, err
+	}
+
+	if req.Amount > p.Balance {
+
+		return nil, operator.ErrInsufficientFunds
+	}
+
+	p.Balance -= req.Amount
+	b.debits[req.TransactionID] = &transaction{playerID: p.ID, amount: req.Amount}
+
+	return &wallet.DebitTransactionResponse{
+		Balance:      p.Balance,
+		BonusBalance: p.Bonus,
+		Currency:     p.Currency,
+		Language:     p.Language,
+	}, nil
+}
+
+func (b *MemoryBackend) Credit(ctx context.Context, req wallet.CreditRequest) (*wallet.CreditTransactionResponse, error) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p, err := b.player(req.PlayerID)
+	if err != nil {
+
+		return nil, err
+	}
+
+	if len(req.DebitTransactionID) > 0 {
+
+		debit, err := b.debit(req.DebitTransactionID, p.ID)
+		if err != nil {
+
+			return nil, err
+		}
+
+		if debit.rolledBack {
+
+			return nil, fmt.Errorf("%w: debit %s already rolled back", operator.ErrDuplicateTransaction, req.DebitTransactionID)
+		}
+
+		if debit.credited {
+
+			return nil, fmt.Errorf("%w: debit %s already credited", operator.ErrDuplicateTransaction, req.DebitTransactionID)
+		}
+
+		debit.credited = true
+	}
+
+	p.Balance += req.Amount
+
+	return &wallet.CreditTransactionResponse{
+		Balance:      p.Balance,
+		BonusBalance: p.Bonus,
+		Currency:     p.Currency,
+		Language:     p.Language,
+	}, nil
+}
+
+func (b *MemoryBackend) Settle(ctx context.Context, req wallet.SettlementRequest) error {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	debit, err := b.debit(req.DebitTransactionID, req.PlayerID)
+	if err != nil {
+
+		return err
+	}
+
+	debit.settled = true
+	return nil
+}
+
+func (b *MemoryBackend) Adjust(ctx context.Context, req wallet.AdjustmentRequest) (*wallet.AdjustmentTransactionResponse, error) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p, err := b.player(req.PlayerID)
+	if err != nil {
+
+		return nil, err
+	}
+
+	if p.Balance+req.Amount < 0 {
+
+		return nil, operator.ErrInsufficientFunds
+	}
+
+	p.Balance += req.Amount
+
+	return &wallet.AdjustmentTransactionResponse{
+		Balance:      p.Balance,
+		BonusBalance: p.Bonus,
+		Currency:     p.Currency,
+		Language:     p.Language,
+	}, nil
+}
+
+// Rollback refunds the debit it names, whatever the amount of the request.
+func (b *MemoryBackend) Rollback(ctx context.Context, req wallet.RollbackRequest) (*wallet.RollbackTransactionResponse, error) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p, err := b.player(req.PlayerID)
+	if err != nil {
+
+		return nil, err
+	}
+
+	debit, err := b.debit(req.DebitTransactionID, p.ID)
+	if err != nil {
+
+		return nil, err
+	}
+
+	if debit.rolledBack {
+
+		return nil, fmt.Errorf("%w: debit %s already rolled back", operator.ErrDuplicateTransaction, req.DebitTransactionID)
+	}
+
+	if debit.credited {
+
+		return nil, fmt.Errorf("%w: debit %s already credited", operator.ErrDuplicateTransaction, req.DebitTransactionID)
+	}
+
+	debit.rolledBack = true
+	p.Balance += debit.amount
+
+	return &wallet.RollbackTransactionResponse{
+		Balance:      p.Balance,
+		BonusBalance: p.Bonus,
+		Currency:     p.Currency,
+		Language:     p.Language,
+	}, nil
+}
+
+func (b *MemoryBackend) debit(transactionID, playerID string) (*transaction, error) {
+
+	debit, ok := b.debits[transactionID]
+	if !ok || debit.playerID != playerID {
+
+		return nil, fmt.Errorf("%w: debit %s", operator.ErrTransactionNotFound, transactionID)
+	}
+
+	return debit, nil
+}
@@ -0,0 +1,123 @@
+package simulator
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type Fault string
+
+const (
+	// FaultNone answers normally, after Latency.
+	FaultNone              Fault = ""
+	FaultInsufficientFunds Fault = "insufficient_funds"
+	FaultDuplicate         Fault = "duplicate"
+	// FaultTimeout holds the request until the client gives up.
+	FaultTimeout     Fault = "timeout"
+	FaultServerError Fault = "server_error"
+	// FaultErrorBody answers 200 with a body that reports an error instead of a balance.
+	FaultErrorBody     Fault = "error_body"
+	FaultMalformedJSON Fault = "malformed_json"
+)
+
+// UnmarshalText rejects unknown faults, so that a misspelt scenario file fails to load
+// instead of answering normally.
+func (f *Fault) UnmarshalText(text []byte) error {
+
+	switch fault := Fault(text); fault {
+
+	case FaultNone, FaultInsufficientFunds, FaultDuplicate, FaultTimeout, FaultServerError, FaultErrorBody, FaultMalformedJSON:
+		*f = fault
+		return nil
+
+	default:
+		return fmt.Errorf("unknown fault %q", text)
+	}
+}
+
+// maxHold bounds FaultTimeout for clients that never time out.
+const maxHold = 2 * time.Minute
+
+// Scenario scripts the answer to the calls it matches. Empty Operation, PlayerID and
+// TransactionID match any call. Times limits the number of calls the scenario applies
+// to, zero meaning every matching call.
+type Scenario struct {
+	Operation     string
+	PlayerID      string
+	TransactionID string
+	Fault         Fault
+	Latency       time.Duration
+	Times         int
+}
+
+func (s Scenario) matches(call Call) bool {
+
+	return (len(s.Operation) == 0 || s.Operation == call.Operation) &&
+		(len(s.PlayerID) == 0 || s.PlayerID == call.PlayerID) &&
+		(len(s.TransactionID) == 0 || s.TransactionID == call.TransactionID)
+}
+
+type script struct {
+	Scenario
+	used int
+}
+
+// apply delays the call and, unless the fault lets the backend answer, writes the
+// scripted response and reports true.
+func (s Scenario) apply(rw http.ResponseWriter, r *http.Request) bool {
+
+	if s.Latency > 0 {
+
+		select {
+
+		case <-time.After(s.Latency):
+
+		case <-r.Context().Done():
+			return true
+		}
+	}
+
+	switch s.Fault {
+
+	case FaultInsufficientFunds:
+		writeText(rw, http.StatusPaymentRequired, "insufficient funds")
+
+	case FaultDuplicate:
+		writeText(rw, http.StatusConflict, "duplicate transaction")
+
+	case FaultTimeout:
+		select {
+
+		case <-r.Context().Done():
+
+		case <-time.After(maxHold):
+			writeText(rw, http.StatusGatewayTimeout, "simulated timeout")
+		}
+
+	case FaultServerError:
+		writeText(rw, http.StatusInternalServerError, "simulated server error")
+
+	case FaultErrorBody:
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		_, _ = rw.Write([]byte(`{"status":0,"description":"simulated error","error":"simulated error"}`))
+
+	case FaultMalformedJSON:
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		_, _ = rw.Write([]byte(`{"balance": 10.5, "status"`))
+
+	default:
+		return false
+	}
+
+	return true
+}
+
+func writeText(rw http.ResponseWriter, status int, message string) {
+
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rw.WriteHeader(status)
+	_, _ = rw.Write([]byte(message))
+}
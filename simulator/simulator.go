@@ -0,0 +1,332 @@
+// Package simulator is an in-memory operator wallet for integration tests. It serves the
+// wallet contract through operator.Server backed by MemoryBackend, lets tests script
+// faults per operation, player or transaction, and records every call it receives.
+package simulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/touchvas/casino-wallet/operator"
+)
+
+// Call is a request received by the simulator and the status it was answered with.
+// Status is zero when the client gave up before an answer was written.
+type Call struct {
+	Operation          string
+	PlayerID           string
+	TransactionID      string
+	DebitTransactionID string
+	Amount             float64
+	Header             http.Header
+	Body               []byte
+	Status             int
+	Fault              Fault
+	ReceivedAt         time.Time
+}
+
+type Simulator struct {
+	Backend *MemoryBackend
+	server  *operator.Server
+
+	mu      sync.Mutex
+	scripts []*script
+	calls   []Call
+}
+
+// New returns a simulator accepting secret in header.
+func New(header, secret string) *Simulator {
+
+	backend := NewMemoryBackend()
+
+	return &Simulator{
+		Backend: backend,
+		server:  operator.NewServer(backend, header, secret),
+	}
+}
+
+// Start serves the simulator on a local httptest server, whose URL is the BaseURL of the
+// simulated operator. Close the server when done.
+func (s *Simulator) Start() *httptest.Server {
+
+	return httptest.NewServer(s)
+}
+
+// SetPlayer creates or replaces a player with balance.
+func (s *Simulator) SetPlayer(id string, balance float64) {
+
+	s.Backend.SetPlayer(Player{ID: id, DisplayName: id, Balance: balance})
+}
+
+// Balance returns the balance of player id, or zero for an unknown player.
+func (s *Simulator) Balance(id string) float64 {
+
+	p, _ := s.Backend.Player(id)
+	return p.Balance
+}
+
+// Script adds a scenario. Scenarios are tried in the order they were added.
+func (s *Simulator) Script(scenario Scenario) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.scripts = append(s.scripts, &script{Scenario: scenario})
+}
+
+// Reset drops all scenarios and recorded calls. Balances are kept.
+func (s *Simulator) Reset() {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.scripts = nil
+	s.calls = nil
+}
+
+func (s *Simulator) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+
+	body, _ := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	var fields struct {
+		PlayerID           string  `json:"player_id"`
+		TransactionID      string  `json:"transaction_id"`
+		DebitTransactionID string  `json:"debit_transaction_id"`
+		Amount             float64 `json:"amount"`
+	}
+
+	_ = json.Unmarshal(body, &fields)
+
+	call := Call{
+		Operation:          strings.Trim(r.URL.Path, "/"),
+		PlayerID:           fields.PlayerID,
+		TransactionID:      fields.TransactionID,
+		DebitTransactionID: fields.DebitTransactionID,
+		Amount:             fields.Amount,
+		Header:             r.Header.Clone(),
+		Body:               body,
+		ReceivedAt:         time.Now(),
+	}
+
+	// The call is recorded on arrival, so that it can be asserted while a scripted timeout
+	// still holds it, and completed with its status once answered.
+	scenario, scripted, index := s.receive(call)
+
+	recorder := &statusRecorder{ResponseWriter: rw}
+
+	if !scripted || !scenario.apply(recorder, r) {
+
+		s.server.ServeHTTP(recorder, r)
+	}
+
+	s.mu.Lock()
+	if index < len(s.calls) {
+
+		s.calls[index].Status = recorder.status
+	}
+	s.mu.Unlock()
+}
+
+// receive records call and returns the scenario it matches.
+func (s *Simulator) receive(call Call) (Scenario, bool, int) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scenario, scripted := s.match(call)
+	call.Fault = scenario.Fault
+	s.calls = append(s.calls, call)
+
+	return scenario, scripted, len(s.calls) - 1
+}
+
+func (s *Simulator) match(call Call) (Scenario, bool) {
+
+	for _, sc := range s.scripts {
+
+		if sc.Times > 0 && sc.used >= sc.Times {
+
+			continue
+		}
+
+		if sc.matches(call) {
+
+			sc.used++
+			return sc.Scenario, true
+		}
+	}
+
+	return Scenario{}, false
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+
+	if r.status == 0 {
+
+		r.status = status
+	}
+
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+
+	if r.status == 0 {
+
+		r.status = http.StatusOK
+	}
+
+	return r.ResponseWriter.Write(b)
+}
+
+// Calls returns the calls received so far, optionally only those of operation.
+func (s *Simulator) Calls(operation ...string) []Call {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []Call
+
+	for _, c := range s.calls {
+
+		if len(operation) == 0 || c.Operation == operation[0] {
+
+			out = append(out, c)
+		}
+	}
+
+	return out
+}
+
+// callJSON is the form of a Call served by CallsHandler, with the body as text.
+type callJSON struct {
+	Operation          string      `json:"operation"`
+	PlayerID           string      `json:"player_id,omitempty"`
+	TransactionID      string      `json:"transaction_id,omitempty"`
+	DebitTransactionID string      `json:"debit_transaction_id,omitempty"`
+	Amount             float64     `json:"amount"`
+	Header             http.Header `json:"header"`
+	Body               string      `json:"body"`
+	Status             int         `json:"status"`
+	Fault              Fault       `json:"fault,omitempty"`
+	ReceivedAt         time.Time   `json:"received_at"`
+}
+
+// CallsHandler serves the recorded calls as a JSON array, optionally only those of the
+// operation query parameter, so that tests against the wallet-simulator binary can make
+// the assertions in-process tests make with Calls.
+func (s *Simulator) CallsHandler() http.Handler {
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+
+		if r.Method != http.MethodGet {
+
+			rw.Header().Set("Allow", http.MethodGet)
+			writeText(rw, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		var calls []Call
+		if operation := r.URL.Query().Get("operation"); len(operation) > 0 {
+
+			calls = s.Calls(operation)
+		} else {
+
+			calls = s.Calls()
+		}
+
+		out := make([]callJSON, 0, len(calls))
+		for _, c := range calls {
+
+			out = append(out, callJSON{
+				Operation:          c.Operation,
+				PlayerID:           c.PlayerID,
+				TransactionID:      c.TransactionID,
+				DebitTransactionID: c.DebitTransactionID,
+				Amount:             c.Amount,
+				Header:             c.Header,
+				Body:               string(c.Body),
+				Status:             c.Status,
+				Fault:              c.Fault,
+				ReceivedAt:         c.ReceivedAt,
+			})
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(rw).Encode(out)
+	})
+}
+
+// The Assert methods return an error describing the mismatch, so that tests can report
+// it with t.Fatal without the simulator depending on the testing package.
+
+// AssertCallCount checks that operation was called n times.
+func (s *Simulator) AssertCallCount(operation string, n int) error {
+
+	got := len(s.Calls(operation))
+	if got != n {
+
+		return fmt.Errorf("expected %d %s calls, got %d", n, operation, got)
+	}
+
+	return nil
+}
+
+// AssertCalled checks that operation was called for transactionID and returns the last
+// such call.
+func (s *Simulator) AssertCalled(operation, transactionID string) (Call, error) {
+
+	calls := s.Calls(operation)
+
+	for i := len(calls) - 1; i >= 0; i-- {
+
+		if calls[i].TransactionID == transactionID {
+
+			return calls[i], nil
+		}
+	}
+
+	return Call{}, fmt.Errorf("expected a %s call for transaction %s, got none", operation, transactionID)
+}
+
+// AssertNotCalled checks that operation was never called for transactionID.
+func (s *Simulator) AssertNotCalled(operation, transactionID string) error {
+
+	_, err := s.AssertCalled(operation, transactionID)
+	if err == nil {
+
+		return fmt.Errorf("expected no %s call for transaction %s", operation, transactionID)
+	}
+
+	return nil
+}
+
+// AssertBalance checks the balance of player id.
+func (s *Simulator) AssertBalance(id string, balance float64) error {
+
+	p, ok := s.Backend.Player(id)
+	if !ok {
+
+		return fmt.Errorf("unknown player %s", id)
+	}
+
+	if p.Balance != balance {
+
+		return fmt.Errorf("expected balance %v for player %s, got %v", balance, id, p.Balance)
+	}
+
+	return nil
+}
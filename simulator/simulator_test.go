@@ -0,0 +1,130 @@
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	wallet "github.com/touchvas/casino-wallet"
+	"github.com/touchvas/casino-wallet/operator"
+)
+
+func TestMemoryBackendRejectsDoublePayout(t *testing.T) {
+
+	ctx := context.Background()
+	backend := NewMemoryBackend()
+	backend.SetPlayer(Player{ID: "p1", Balance: 100})
+
+	for _, id := range []string{"d1", "d2"} {
+
+		_, err := backend.Debit(ctx, wallet.DebitRequest{PlayerID: "p1", TransactionID: id, Amount: 10})
+		if err != nil {
+
+			t.Fatal(err)
+		}
+	}
+
+	_, err := backend.Credit(ctx, wallet.CreditRequest{PlayerID: "p1", TransactionID: "c1", DebitTransactionID: "d1", Amount: 20})
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	_, err = backend.Credit(ctx, wallet.CreditRequest{PlayerID: "p1", TransactionID: "c3", DebitTransactionID: "d1", Amount: 20})
+	if !errors.Is(err, operator.ErrDuplicateTransaction) {
+
+		t.Fatalf("second credit of a debit = %v, want ErrDuplicateTransaction", err)
+	}
+
+	_, err = backend.Rollback(ctx, wallet.RollbackRequest{PlayerID: "p1", TransactionID: "r1", DebitTransactionID: "d1"})
+	if !errors.Is(err, operator.ErrDuplicateTransaction) {
+
+		t.Fatalf("rollback of a credited debit = %v, want ErrDuplicateTransaction", err)
+	}
+
+	_, err = backend.Rollback(ctx, wallet.RollbackRequest{PlayerID: "p1", TransactionID: "r2", DebitTransactionID: "d2"})
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	_, err = backend.Credit(ctx, wallet.CreditRequest{PlayerID: "p1", TransactionID: "c2", DebitTransactionID: "d2", Amount: 20})
+	if !errors.Is(err, operator.ErrDuplicateTransaction) {
+
+		t.Fatalf("credit of a rolled back debit = %v, want ErrDuplicateTransaction", err)
+	}
+
+	p, _ := backend.Player("p1")
+	if p.Balance != 110 {
+
+		t.Fatalf("balance = %v, want 110", p.Balance)
+	}
+}
+
+func TestFaultUnmarshalText(t *testing.T) {
+
+	var scenario struct {
+		Fault Fault `json:"fault"`
+	}
+
+	err := json.Unmarshal([]byte(`{"fault": "server_error"}`), &scenario)
+	if err != nil || scenario.Fault != FaultServerError {
+
+		t.Fatalf("Unmarshal = %q, %v", scenario.Fault, err)
+	}
+
+	err = json.Unmarshal([]byte(`{"fault": "server-error"}`), &scenario)
+	if err == nil {
+
+		t.Fatal("unknown fault accepted")
+	}
+}
+
+func TestCallsHandler(t *testing.T) {
+
+	sim := New("X-Secret", "secret")
+	sim.SetPlayer("p1", 100)
+
+	server := sim.Start()
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/debit", strings.NewReader(`{"player_id":"p1","transaction_id":"d1","amount":10}`))
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	req.Header.Set("X-Secret", "secret")
+
+	resp, err := server.Client().Do(req)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	resp.Body.Close()
+
+	rw := httptest.NewRecorder()
+	sim.CallsHandler().ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/_calls?operation=debit", nil))
+
+	var calls []struct {
+		Operation     string `json:"operation"`
+		TransactionID string `json:"transaction_id"`
+		Status        int    `json:"status"`
+	}
+
+	err = json.Unmarshal(rw.Body.Bytes(), &calls)
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	if len(calls) != 1 || calls[0].TransactionID != "d1" || calls[0].Status != http.StatusOK {
+
+		t.Fatalf("calls = %+v, want the debit answered 200", calls)
+	}
+}
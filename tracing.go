@@ -0,0 +1,94 @@
+package wallet
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	attrClientID      = attribute.Key("wallet.client_id")
+	attrPlayerID      = attribute.Key("wallet.player_id")
+	attrGameID        = attribute.Key("wallet.game_id")
+	attrSessionID     = attribute.Key("wallet.session_id")
+	attrRoundID       = attribute.Key("wallet.round_id")
+	attrTransactionID = attribute.Key("wallet.transaction_id")
+	attrDebitID       = attribute.Key("wallet.debit_transaction_id")
+	attrAmount        = attribute.Key("wallet.amount")
+	attrOperation     = attribute.Key("wallet.operation")
+	attrOutcome       = attribute.Key("wallet.outcome")
+	attrHTTPStatus    = attribute.Key("http.response.status_code")
+	attrCredentialID  = attribute.Key("wallet.credential_id")
+	attrAttempt       = attribute.Key("wallet.attempt")
+)
+
+// startSpan starts the span of a wallet operation carrying the operator and the business
+// identifiers of the instruction.
+func (w *Wallet) startSpan(ctx context.Context, name, operation string, client Client, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+
+	attrs = append(attrs, attrOperation.String(operation), attrClientID.Int64(client.ID))
+	return w.Tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// endSpan records the outcome of a wallet operation and ends its span. Declined debits
+// and duplicates are business outcomes, not errors, and leave the status unset.
+func endSpan(span trace.Span, status int64, err error) {
+
+	outcome := outcomeCode(status, err)
+	span.SetAttributes(attrOutcome.String(outcome))
+
+	if err != nil {
+
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+	} else {
+
+		span.SetStatus(codes.Ok, "")
+	}
+
+	span.End()
+}
+
+func transactionAttributes(playerID, gameID, sessionID, roundID, transactionID string, amount float64) []attribute.KeyValue {
+
+	attrs := []attribute.KeyValue{
+		attrPlayerID.String(playerID),
+		attrRoundID.String(roundID),
+		attrTransactionID.String(transactionID),
+		attrAmount.Float64(amount),
+	}
+
+	if len(gameID) > 0 {
+
+		attrs = append(attrs, attrGameID.String(gameID))
+	}
+
+	if len(sessionID) > 0 {
+
+		attrs = append(attrs, attrSessionID.String(sessionID))
+	}
+
+	return attrs
+}
+
+func (w *Wallet) propagator() propagation.TextMapPropagator {
+
+	if w.Propagator != nil {
+
+		return w.Propagator
+	}
+
+	return otel.GetTextMapPropagator()
+}
+
+// injectTraceContext adds traceparent, tracestate and any other fields of the configured
+// propagator to headers, next to the legacy span-id and trace-id headers.
+func (w *Wallet) injectTraceContext(ctx context.Context, headers map[string]string) {
+
+	w.propagator().Inject(ctx, propagation.MapCarrier(headers))
+}
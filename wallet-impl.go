@@ -9,12 +9,9 @@ import (
 	"io"
 	"net"
 	"net/http"
-	"os"
-	"strconv"
 	"sync"
 	"time"
 
-	"github.com/sirupsen/logrus"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -24,18 +21,16 @@ var (
 	netClient *http.Client
 )
 
-func GetWalletProfile(tr trace.Tracer, ctx context.Context, client Client, profileID string) (*WalletProfile, error) {
+func (w *Wallet) fetchWalletProfile(ctx context.Context, client Client, profileID string) (*WalletProfile, error) {
 
-	ctx, span := tr.Start(ctx, "GetWalletProfile")
-	defer span.End()
+	span := trace.SpanFromContext(ctx)
 
 	spanID := span.SpanContext().SpanID().String()
 	traceID := span.SpanContext().TraceID().String()
 
 	headers := map[string]string{
-		client.AuthenticationHeader: client.AuthenticationString,
-		"span-id":                   spanID,
-		"trace-id":                  traceID,
+		"span-id":  spanID,
+		"trace-id": traceID,
 	}
 
 	profileRequest := ProfileRequest{
@@ -46,7 +41,7 @@ func GetWalletProfile(tr trace.Tracer, ctx context.Context, client Client, profi
 
 	endpoint := fmt.Sprintf("%s/profile", client.BaseURL)
 
-	status, response := HTTPPost(ctx, endpoint, headers, profileRequest)
+	status, response := w.post(ctx, OperationProfile, client, endpoint, headers, profileRequest)
 	if status > 299 || status < 200 {
 
 		return nil, fmt.Errorf("%s", response)
@@ -57,39 +52,43 @@ func GetWalletProfile(tr trace.Tracer, ctx context.Context, client Client, profi
 	err := json.Unmarshal([]byte(response), prof)
 	if err != nil {
 
-		logrus.WithContext(ctx).
-			WithFields(logrus.Fields{
-				"description": "error unmarshalling profile to JSON",
-				"data":        response,
-			}).
-			Error(err.Error())
+		w.log().Error(ctx, "error unmarshalling profile to JSON", err, LogFields{
+			"data": w.loggingPolicy().body([]byte(response), true),
+		})
 
 		return nil, fmt.Errorf("internal server error")
 
 	}
 
-	id := fmt.Sprintf("%d%s", client.ID, prof.ID)
+	id, err := w.AccountIDs.Encode(AccountID{ClientID: client.ID, PlayerID: prof.ID})
+	if err != nil {
+
+		w.log().Error(ctx, "error building account id", err, LogFields{
+			LogFieldClientID: client.ID,
+		})
+
+		return nil, err
+	}
+
 	prof.ID = id
 
 	return prof, nil
 
 }
 
-func DebitWalletProfile(tr trace.Tracer, ctx context.Context, client Client, debit Debit) (*DebitTransactionResponse, error) {
+func (w *Wallet) debitWalletProfile(ctx context.Context, client Client, debit Debit) (*DebitTransactionResponse, error) {
 
-	ctx, span := tr.Start(ctx, "DebitWalletProfile")
-	defer span.End()
+	span := trace.SpanFromContext(ctx)
 
 	spanID := span.SpanContext().SpanID().String()
 	traceID := span.SpanContext().TraceID().String()
 
-	providerID, _ := strconv.ParseInt(os.Getenv("PROVIDER_ID"), 10, 64)
-	providerName := os.Getenv("PROVIDER_NAME")
+	providerID := w.Provider.ID
+	providerName := w.Provider.Name
 
 	headers := map[string]string{
-		client.AuthenticationHeader: client.AuthenticationString,
-		"span-id":                   spanID,
-		"trace-id":                  traceID,
+		"span-id":  spanID,
+		"trace-id": traceID,
 	}
 
 	debitRequest := DebitRequest{
@@ -108,7 +107,7 @@ func DebitWalletProfile(tr trace.Tracer, ctx context.Context, client Client, deb
 
 	endpoint := fmt.Sprintf("%s/debit", client.BaseURL)
 
-	status, response := HTTPPost(ctx, endpoint, headers, debitRequest)
+	status, response := w.post(ctx, OperationDebit, client, endpoint, headers, debitRequest)
 	if status > 299 || status < 200 {
 
 		if status == http.StatusPaymentRequired {
@@ -116,6 +115,7 @@ func DebitWalletProfile(tr trace.Tracer, ctx context.Context, client Client, deb
 			prof := new(DebitTransactionResponse)
 			prof.Status = http.StatusPaymentRequired
 			prof.Description = response
+			w.invalidateProfileCache(ctx, client.ID, debit.PlayerID)
 			return prof, nil
 
 		}
@@ -125,9 +125,11 @@ func DebitWalletProfile(tr trace.Tracer, ctx context.Context, client Client, deb
 			prof := new(DebitTransactionResponse)
 			prof.Status = http.StatusConflict
 			prof.Description = response
+			w.invalidateProfileCache(ctx, client.ID, debit.PlayerID)
 			return prof, nil
 		}
 
+		w.invalidateProfileCache(ctx, client.ID, debit.PlayerID)
 		return nil, fmt.Errorf("%s", response)
 
 	}
@@ -136,38 +138,35 @@ func DebitWalletProfile(tr trace.Tracer, ctx context.Context, client Client, deb
 	err := json.Unmarshal([]byte(response), prof)
 	if err != nil {
 
-		logrus.WithContext(ctx).
-			WithFields(logrus.Fields{
-				"description": "error unmarshalling TransactionResponse from JSON",
-				"data":        response,
-			}).
-			Error(err.Error())
+		w.log().Error(ctx, "error unmarshalling TransactionResponse from JSON", err, LogFields{
+			"data": w.loggingPolicy().body([]byte(response), true),
+		})
 
+		w.invalidateProfileCache(ctx, client.ID, debit.PlayerID)
 		return nil, fmt.Errorf("internal server error")
 
 	}
 
 	prof.Status = 1
+	w.refreshProfileCache(ctx, client.ID, debit.PlayerID, prof.Balance, prof.BonusBalance)
 
 	return prof, nil
 
 }
 
-func CreditWalletProfile(tr trace.Tracer, ctx context.Context, client Client, credit Credit) (*CreditTransactionResponse, error) {
+func (w *Wallet) creditWalletProfile(ctx context.Context, client Client, credit Credit) (*CreditTransactionResponse, error) {
 
-	ctx, span := tr.Start(ctx, "CreditWalletProfile")
-	defer span.End()
+	span := trace.SpanFromContext(ctx)
 
 	spanID := span.SpanContext().SpanID().String()
 	traceID := span.SpanContext().TraceID().String()
 
-	providerID, _ := strconv.ParseInt(os.Getenv("PROVIDER_ID"), 10, 64)
-	providerName := os.Getenv("PROVIDER_NAME")
+	providerID := w.Provider.ID
+	providerName := w.Provider.Name
 
 	headers := map[string]string{
-		client.AuthenticationHeader: client.AuthenticationString,
-		"span-id":                   spanID,
-		"trace-id":                  traceID,
+		"span-id":  spanID,
+		"trace-id": traceID,
 	}
 
 	creditRequest := CreditRequest{
@@ -188,7 +187,7 @@ func CreditWalletProfile(tr trace.Tracer, ctx context.Context, client Client, cr
 
 	endpoint := fmt.Sprintf("%s/credit", client.BaseURL)
 
-	status, response := HTTPPost(ctx, endpoint, headers, creditRequest)
+	status, response := w.post(ctx, OperationCredit, client, endpoint, headers, creditRequest)
 
 	if status > 299 || status < 200 {
 
@@ -197,9 +196,11 @@ func CreditWalletProfile(tr trace.Tracer, ctx context.Context, client Client, cr
 			prof := new(CreditTransactionResponse)
 			prof.Status = http.StatusConflict
 			prof.Description = response
+			w.invalidateProfileCache(ctx, client.ID, credit.PlayerID)
 			return prof, nil
 		}
 
+		w.invalidateProfileCache(ctx, client.ID, credit.PlayerID)
 		return nil, fmt.Errorf("%s", response)
 
 	}
@@ -208,37 +209,34 @@ func CreditWalletProfile(tr trace.Tracer, ctx context.Context, client Client, cr
 	err := json.Unmarshal([]byte(response), prof)
 	if err != nil {
 
-		logrus.WithContext(ctx).
-			WithFields(logrus.Fields{
-				"description": "error unmarshalling TransactionResponse from JSON",
-				"data":        response,
-			}).
-			Error(err.Error())
+		w.log().Error(ctx, "error unmarshalling TransactionResponse from JSON", err, LogFields{
+			"data": w.loggingPolicy().body([]byte(response), true),
+		})
 
+		w.invalidateProfileCache(ctx, client.ID, credit.PlayerID)
 		return nil, fmt.Errorf("internal server error")
 
 	}
 
 	prof.Status = 1
+	w.refreshProfileCache(ctx, client.ID, credit.PlayerID, prof.Balance, prof.BonusBalance)
 
 	return prof, nil
 
 }
 
-func BetSettlement(tr trace.Tracer, ctx context.Context, client Client, settlement Settlement) error {
+func (w *Wallet) betSettlement(ctx context.Context, client Client, settlement Settlement) error {
 
-	ctx, span := tr.Start(ctx, "BetSettlement")
-	defer span.End()
+	span := trace.SpanFromContext(ctx)
 
 	spanID := span.SpanContext().SpanID().String()
 	traceID := span.SpanContext().TraceID().String()
 
-	providerID, _ := strconv.ParseInt(os.Getenv("PROVIDER_ID"), 10, 64)
+	providerID := w.Provider.ID
 
 	headers := map[string]string{
-		client.AuthenticationHeader: client.AuthenticationString,
-		"span-id":                   spanID,
-		"trace-id":                  traceID,
+		"span-id":  spanID,
+		"trace-id": traceID,
 	}
 
 	settlementRequest := SettlementRequest{
@@ -252,7 +250,7 @@ func BetSettlement(tr trace.Tracer, ctx context.Context, client Client, settleme
 
 	endpoint := fmt.Sprintf("%s/settlement", client.BaseURL)
 
-	status, response := HTTPPost(ctx, endpoint, headers, settlementRequest)
+	status, response := w.post(ctx, OperationSettlement, client, endpoint, headers, settlementRequest)
 	if status > 299 || status < 200 {
 
 		return fmt.Errorf("%s", response)
@@ -262,21 +260,19 @@ func BetSettlement(tr trace.Tracer, ctx context.Context, client Client, settleme
 
 }
 
-func AdjustWalletProfile(tr trace.Tracer, ctx context.Context, client Client, adjustment Adjustment) (*AdjustmentTransactionResponse, error) {
+func (w *Wallet) adjustWalletProfile(ctx context.Context, client Client, adjustment Adjustment) (*AdjustmentTransactionResponse, error) {
 
-	ctx, span := tr.Start(ctx, "AdjustWalletProfile")
-	defer span.End()
+	span := trace.SpanFromContext(ctx)
 
 	spanID := span.SpanContext().SpanID().String()
 	traceID := span.SpanContext().TraceID().String()
 
-	providerID, _ := strconv.ParseInt(os.Getenv("PROVIDER_ID"), 10, 64)
-	providerName := os.Getenv("PROVIDER_NAME")
+	providerID := w.Provider.ID
+	providerName := w.Provider.Name
 
 	headers := map[string]string{
-		client.AuthenticationHeader: client.AuthenticationString,
-		"span-id":                   spanID,
-		"trace-id":                  traceID,
+		"span-id":  spanID,
+		"trace-id": traceID,
 	}
 
 	adjustmentRequest := AdjustmentRequest{
@@ -294,7 +290,7 @@ func AdjustWalletProfile(tr trace.Tracer, ctx context.Context, client Client, ad
 
 	endpoint := fmt.Sprintf("%s/adjust", client.BaseURL)
 
-	status, response := HTTPPost(ctx, endpoint, headers, adjustmentRequest)
+	status, response := w.post(ctx, OperationAdjustment, client, endpoint, headers, adjustmentRequest)
 
 	if status > 299 || status < 200 {
 
@@ -303,9 +299,11 @@ func AdjustWalletProfile(tr trace.Tracer, ctx context.Context, client Client, ad
 			prof := new(AdjustmentTransactionResponse)
 			prof.Status = http.StatusConflict
 			prof.Description = response
+			w.invalidateProfileCache(ctx, client.ID, adjustment.PlayerID)
 			return prof, nil
 		}
 
+		w.invalidateProfileCache(ctx, client.ID, adjustment.PlayerID)
 		return nil, fmt.Errorf("%s", response)
 
 	}
@@ -315,38 +313,35 @@ func AdjustWalletProfile(tr trace.Tracer, ctx context.Context, client Client, ad
 	err := json.Unmarshal([]byte(response), prof)
 	if err != nil {
 
-		logrus.WithContext(ctx).
-			WithFields(logrus.Fields{
-				"description": "error unmarshalling TransactionResponse from JSON",
-				"data":        response,
-			}).
-			Error(err.Error())
+		w.log().Error(ctx, "error unmarshalling TransactionResponse from JSON", err, LogFields{
+			"data": w.loggingPolicy().body([]byte(response), true),
+		})
 
+		w.invalidateProfileCache(ctx, client.ID, adjustment.PlayerID)
 		return nil, fmt.Errorf("internal server error")
 
 	}
 
 	prof.Status = 1
+	w.refreshProfileCache(ctx, client.ID, adjustment.PlayerID, prof.Balance, prof.BonusBalance)
 
 	return prof, nil
 
 }
 
-func BetRollback(tr trace.Tracer, ctx context.Context, client Client, rollback Rollback) (*RollbackTransactionResponse, error) {
+func (w *Wallet) betRollback(ctx context.Context, client Client, rollback Rollback) (*RollbackTransactionResponse, error) {
 
-	ctx, span := tr.Start(ctx, "BetRollback")
-	defer span.End()
+	span := trace.SpanFromContext(ctx)
 
 	spanID := span.SpanContext().SpanID().String()
 	traceID := span.SpanContext().TraceID().String()
 
-	providerID, _ := strconv.ParseInt(os.Getenv("PROVIDER_ID"), 10, 64)
-	providerName := os.Getenv("PROVIDER_NAME")
+	providerID := w.Provider.ID
+	providerName := w.Provider.Name
 
 	headers := map[string]string{
-		client.AuthenticationHeader: client.AuthenticationString,
-		"span-id":                   spanID,
-		"trace-id":                  traceID,
+		"span-id":  spanID,
+		"trace-id": traceID,
 	}
 
 	rollbackRequest := RollbackRequest{
@@ -362,7 +357,7 @@ func BetRollback(tr trace.Tracer, ctx context.Context, client Client, rollback R
 
 	endpoint := fmt.Sprintf("%s/rollback", client.BaseURL)
 
-	status, response := HTTPPost(ctx, endpoint, headers, rollbackRequest)
+	status, response := w.post(ctx, OperationRollback, client, endpoint, headers, rollbackRequest)
 
 	if status > 299 || status < 200 {
 
@@ -371,9 +366,11 @@ func BetRollback(tr trace.Tracer, ctx context.Context, client Client, rollback R
 			prof := new(RollbackTransactionResponse)
 			prof.Status = http.StatusConflict
 			prof.Description = response
+			w.invalidateProfileCache(ctx, client.ID, rollback.PlayerID)
 			return prof, nil
 		}
 
+		w.invalidateProfileCache(ctx, client.ID, rollback.PlayerID)
 		return nil, fmt.Errorf("%s", response)
 
 	}
@@ -383,18 +380,17 @@ func BetRollback(tr trace.Tracer, ctx context.Context, client Client, rollback R
 	err := json.Unmarshal([]byte(response), prof)
 	if err != nil {
 
-		logrus.WithContext(ctx).
-			WithFields(logrus.Fields{
-				"description": "error unmarshalling TransactionResponse from JSON",
-				"data":        response,
-			}).
-			Error(err.Error())
+		w.log().Error(ctx, "error unmarshalling TransactionResponse from JSON", err, LogFields{
+			"data": w.loggingPolicy().body([]byte(response), true),
+		})
 
+		w.invalidateProfileCache(ctx, client.ID, rollback.PlayerID)
 		return nil, fmt.Errorf("internal server error")
 
 	}
 
 	prof.Status = 1
+	w.refreshProfileCache(ctx, client.ID, rollback.PlayerID, prof.Balance, prof.BonusBalance)
 
 	return prof, nil
 
@@ -402,6 +398,18 @@ func BetRollback(tr trace.Tracer, ctx context.Context, client Client, rollback R
 
 func HTTPPost(ctx context.Context, url string, headers map[string]string, payload interface{}) (httpStatus int, response string) {
 
+	return HTTPPostWithPolicy(ctx, url, headers, payload, DefaultLoggingPolicy())
+}
+
+// HTTPPostWithPolicy posts payload as JSON and logs the exchange according to policy.
+func HTTPPostWithPolicy(ctx context.Context, url string, headers map[string]string, payload interface{}, policy LoggingPolicy) (httpStatus int, response string) {
+
+	return httpPost(ctx, NewNetClient(), url, legacyProviderIdentity().userAgent(), headers, payload, policy, logTo(nil))
+}
+
+// httpPost posts payload as JSON with userAgent, unless headers set their own User-Agent.
+func httpPost(ctx context.Context, httpClient *http.Client, url string, userAgent string, headers map[string]string, payload interface{}, policy LoggingPolicy, log contextLogger) (httpStatus int, response string) {
+
 	if payload == nil {
 
 		payload = "{}"
@@ -412,22 +420,17 @@ func HTTPPost(ctx context.Context, url string, headers map[string]string, payloa
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 
-		logrus.WithContext(ctx).
-			WithFields(logrus.Fields{
-				"description": "got error making http request",
-				"endpoint":    url,
-				"request":     payload,
-			}).
-			Error(err.Error())
+		log.Error(ctx, "got error making http request", err, LogFields{
+			"endpoint": url,
+			"request":  policy.body(jsonData, true),
+		})
 
 		return 0, ""
 	}
 
-	ua := fmt.Sprintf("Touchvas Gaming/2.5 (provider;%s) (providerID;%s)", os.Getenv("PROVIDER_NAME"), os.Getenv("PROVIDER_ID"))
-
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Accept", "application/json")
-	req.Header.Set("User-Agent", ua)
+	req.Header.Set("User-Agent", userAgent)
 
 	if headers != nil {
 
@@ -437,57 +440,55 @@ func HTTPPost(ctx context.Context, url string, headers map[string]string, payloa
 		}
 	}
 
-	resp, err := NewNetClient().Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 
-		logrus.WithContext(ctx).
-			WithFields(logrus.Fields{
-				"description": "got error making http request",
-				"endpoint":    url,
-				"request":     payload,
-			}).
-			Error(err.Error())
+		log.Error(ctx, "got error making http request", err, LogFields{
+			"endpoint":        url,
+			"request":         policy.body(jsonData, true),
+			"request_headers": policy.headers(req.Header),
+		})
 
 		return 0, ""
 	}
 
+	defer resp.Body.Close()
+
 	st := resp.StatusCode
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 
-		logrus.WithContext(ctx).
-			WithFields(logrus.Fields{
-				"description":     "got error making http request",
-				"endpoint":        url,
-				"request":         payload,
-				"response_status": st,
-			}).
-			Error(err.Error())
+		log.Error(ctx, "got error making http request", err, LogFields{
+			"endpoint":        url,
+			"request":         policy.body(jsonData, true),
+			"request_headers": policy.headers(req.Header),
+			"response_status": st,
+		})
 
 		return st, ""
 	}
 
-	var responseLog interface{}
+	failed := st < 200 || st > 299
 
-	dt := new(map[string]interface{})
-	err = json.Unmarshal([]byte(response), dt)
-	if err == nil {
+	if failed || policy.sampleSuccess() {
 
-		responseLog = *dt
+		fields := LogFields{
+			"endpoint":         url,
+			"request":          policy.body(jsonData, failed),
+			"request_headers":  policy.headers(req.Header),
+			"response_status":  st,
+			"response_payload": policy.body(body, failed),
+		}
 
-	} else {
+		if failed {
 
-		responseLog = response
-	}
+			log.Warn(ctx, "api response", fields)
 
-	logrus.WithContext(ctx).
-		WithFields(logrus.Fields{
-			"endpoint":         url,
-			"request":          payload,
-			"response_status":  st,
-			"response_payload": responseLog,
-		}).
-		Info("api response")
+		} else {
+
+			log.Info(ctx, "api response", fields)
+		}
+	}
 
 	return st, string(body)
 }
@@ -5,7 +5,37 @@ type Client struct {
 	BaseURL              string
 	AuthenticationString string
 	AuthenticationHeader string
+	AuthenticationKeyID  string
 	APIVersion           int64
+	Status               ClientStatus
+	Credentials          []Credential
+}
+
+type ClientStatus string
+
+const (
+	ClientStatusActive      ClientStatus = "active"
+	ClientStatusSuspended   ClientStatus = "suspended"
+	ClientStatusMaintenance ClientStatus = "maintenance"
+)
+
+func (s ClientStatus) Valid() bool {
+
+	switch s {
+
+	case ClientStatusActive, ClientStatusSuspended, ClientStatusMaintenance:
+		return true
+	}
+
+	return false
+}
+
+// ClientFilter narrows ListClients. Zero fields match every client; a zero Limit returns all rows.
+type ClientFilter struct {
+	Status ClientStatus
+	IDs    []int64
+	Limit  int
+	Offset int
 }
 
 type TransactionResponse struct {
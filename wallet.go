@@ -0,0 +1,421 @@
+package wallet
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Wallet sends wallet instructions to operators on behalf of one game provider. Tracer and
+// Provider are required; every other field is optional and enables the matching feature
+// when set.
+type Wallet struct {
+	Tracer       trace.Tracer
+	Provider     ProviderIdentity
+	ProfileCache *ProfileCache
+	Credentials  CredentialRecorder
+	AccountIDs   AccountIDCodec
+	Metrics      *WalletMetrics
+	Propagator   propagation.TextMapPropagator
+	Logging      *LoggingPolicy
+	Logger       Logger
+	Audit        AuditSink
+	HTTPClient   *http.Client
+}
+
+// NewWallet returns a wallet for provider, rejecting an invalid provider identity so that
+// misconfiguration surfaces at startup rather than on the first bet.
+func NewWallet(tr trace.Tracer, provider ProviderIdentity) (*Wallet, error) {
+
+	if tr == nil {
+
+		return nil, fmt.Errorf("wallet requires a tracer")
+	}
+
+	err := provider.Validate()
+	if err != nil {
+
+		return nil, err
+	}
+
+	w := &Wallet{Tracer: tr, Provider: provider, AccountIDs: DefaultAccountIDCodec()}
+
+	err = w.AccountIDs.Validate()
+	if err != nil {
+
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// legacyWallet backs the package level functions, which read the provider from the
+// environment on every call.
+func legacyWallet(tr trace.Tracer) *Wallet {
+
+	return &Wallet{Tracer: tr, Provider: legacyProviderIdentity(), AccountIDs: DefaultAccountIDCodec()}
+}
+
+func GetWalletProfile(tr trace.Tracer, ctx context.Context, client Client, profileID string) (*WalletProfile, error) {
+
+	return legacyWallet(tr).GetWalletProfile(ctx, client, profileID)
+}
+
+func DebitWalletProfile(tr trace.Tracer, ctx context.Context, client Client, debit Debit) (*DebitTransactionResponse, error) {
+
+	return legacyWallet(tr).DebitWalletProfile(ctx, client, debit)
+}
+
+func CreditWalletProfile(tr trace.Tracer, ctx context.Context, client Client, credit Credit) (*CreditTransactionResponse, error) {
+
+	return legacyWallet(tr).CreditWalletProfile(ctx, client, credit)
+}
+
+func BetSettlement(tr trace.Tracer, ctx context.Context, client Client, settlement Settlement) error {
+
+	return legacyWallet(tr).BetSettlement(ctx, client, settlement)
+}
+
+func AdjustWalletProfile(tr trace.Tracer, ctx context.Context, client Client, adjustment Adjustment) (*AdjustmentTransactionResponse, error) {
+
+	return legacyWallet(tr).AdjustWalletProfile(ctx, client, adjustment)
+}
+
+func BetRollback(tr trace.Tracer, ctx context.Context, client Client, rollback Rollback) (*RollbackTransactionResponse, error) {
+
+	return legacyWallet(tr).BetRollback(ctx, client, rollback)
+}
+
+func (w *Wallet) GetWalletProfile(ctx context.Context, client Client, profileID string) (*WalletProfile, error) {
+
+	fetch := func() (*WalletProfile, error) {
+
+		ctx = operationContext(ctx, OperationProfile, client.ID, profileID, "", "")
+		ctx, span := w.startSpan(ctx, "GetWalletProfile", OperationProfile, client, attrPlayerID.String(profileID))
+		done := w.Metrics.begin(ctx, OperationProfile, client.ID)
+		prof, err := w.fetchWalletProfile(ctx, client, profileID)
+		done(0, err)
+		endSpan(span, 0, err)
+		return prof, err
+	}
+
+	if w.ProfileCache == nil {
+
+		return fetch()
+	}
+
+	return w.ProfileCache.Fetch(ctx, client.ID, profileID, fetch)
+}
+
+func (w *Wallet) DebitWalletProfile(ctx context.Context, client Client, debit Debit) (*DebitTransactionResponse, error) {
+
+	ctx = operationContext(ctx, OperationDebit, client.ID, debit.PlayerID, debit.RoundID, debit.TransactionID)
+	ctx, span := w.startSpan(ctx, "DebitWalletProfile", OperationDebit, client,
+		transactionAttributes(debit.PlayerID, debit.GameID, debit.SessionID, debit.RoundID, debit.TransactionID, debit.Amount)...)
+	done := w.Metrics.begin(ctx, OperationDebit, client.ID)
+	record := AuditRecord{
+		Operation:     OperationDebit,
+		ClientID:      client.ID,
+		PlayerID:      debit.PlayerID,
+		GameID:        debit.GameID,
+		SessionID:     debit.SessionID,
+		RoundID:       debit.RoundID,
+		TransactionID: debit.TransactionID,
+		Amount:        debit.Amount,
+		StartedAt:     time.Now(),
+	}
+
+	err := w.auditSent(ctx, record)
+	if err != nil {
+
+		done(0, err)
+		endSpan(span, 0, err)
+		return nil, err
+	}
+
+	resp, err := w.debitWalletProfile(ctx, client, debit)
+
+	var status int64
+	var balance *float64
+	if resp != nil {
+
+		status = resp.Status
+		if err == nil && resp.Status == 1 {
+
+			balance = &resp.Balance
+		}
+	}
+
+	w.audit(ctx, record, status, balance, err)
+	done(status, err)
+	endSpan(span, status, err)
+	return resp, err
+}
+
+func (w *Wallet) CreditWalletProfile(ctx context.Context, client Client, credit Credit) (*CreditTransactionResponse, error) {
+
+	ctx = operationContext(ctx, OperationCredit, client.ID, credit.PlayerID, credit.RoundID, credit.TransactionID)
+	ctx, span := w.startSpan(ctx, "CreditWalletProfile", OperationCredit, client,
+		append(transactionAttributes(credit.PlayerID, credit.GameID, credit.SessionID, credit.RoundID, credit.TransactionID, credit.Amount),
+			attrDebitID.String(credit.DebitTransactionID))...)
+	done := w.Metrics.begin(ctx, OperationCredit, client.ID)
+	record := AuditRecord{
+		Operation:          OperationCredit,
+		ClientID:           client.ID,
+		PlayerID:           credit.PlayerID,
+		GameID:             credit.GameID,
+		SessionID:          credit.SessionID,
+		RoundID:            credit.RoundID,
+		TransactionID:      credit.TransactionID,
+		DebitTransactionID: credit.DebitTransactionID,
+		Amount:             credit.Amount,
+		StartedAt:          time.Now(),
+	}
+
+	err := w.auditSent(ctx, record)
+	if err != nil {
+
+		done(0, err)
+		endSpan(span, 0, err)
+		return nil, err
+	}
+
+	resp, err := w.creditWalletProfile(ctx, client, credit)
+
+	var status int64
+	var balance *float64
+	if resp != nil {
+
+		status = resp.Status
+		if err == nil && resp.Status == 1 {
+
+			balance = &resp.Balance
+		}
+	}
+
+	w.audit(ctx, record, status, balance, err)
+	done(status, err)
+	endSpan(span, status, err)
+	return resp, err
+}
+
+func (w *Wallet) BetSettlement(ctx context.Context, client Client, settlement Settlement) error {
+
+	ctx = operationContext(ctx, OperationSettlement, client.ID, settlement.PlayerID, settlement.RoundID, settlement.DebitTransactionID)
+	ctx, span := w.startSpan(ctx, "BetSettlement", OperationSettlement, client,
+		attrPlayerID.String(settlement.PlayerID), attrRoundID.String(settlement.RoundID), attrDebitID.String(settlement.DebitTransactionID))
+	done := w.Metrics.begin(ctx, OperationSettlement, client.ID)
+	record := AuditRecord{
+		Operation:          OperationSettlement,
+		ClientID:           client.ID,
+		PlayerID:           settlement.PlayerID,
+		SessionID:          settlement.SessionID,
+		RoundID:            settlement.RoundID,
+		DebitTransactionID: settlement.DebitTransactionID,
+		StartedAt:          time.Now(),
+	}
+
+	err := w.auditSent(ctx, record)
+	if err != nil {
+
+		done(0, err)
+		endSpan(span, 0, err)
+		return err
+	}
+
+	err = w.betSettlement(ctx, client, settlement)
+	w.audit(ctx, record, 0, nil, err)
+	done(0, err)
+	endSpan(span, 0, err)
+	return err
+}
+
+func (w *Wallet) AdjustWalletProfile(ctx context.Context, client Client, adjustment Adjustment) (*AdjustmentTransactionResponse, error) {
+
+	ctx = operationContext(ctx, OperationAdjustment, client.ID, adjustment.PlayerID, adjustment.RoundID, adjustment.TransactionID)
+	ctx, span := w.startSpan(ctx, "AdjustWalletProfile", OperationAdjustment, client,
+		transactionAttributes(adjustment.PlayerID, adjustment.GameID, adjustment.SessionID, adjustment.RoundID, adjustment.TransactionID, adjustment.Amount)...)
+	done := w.Metrics.begin(ctx, OperationAdjustment, client.ID)
+	record := AuditRecord{
+		Operation:     OperationAdjustment,
+		ClientID:      client.ID,
+		PlayerID:      adjustment.PlayerID,
+		GameID:        adjustment.GameID,
+		SessionID:     adjustment.SessionID,
+		RoundID:       adjustment.RoundID,
+		TransactionID: adjustment.TransactionID,
+		Amount:        adjustment.Amount,
+		StartedAt:     time.Now(),
+	}
+
+	err := w.auditSent(ctx, record)
+	if err != nil {
+
+		done(0, err)
+		endSpan(span, 0, err)
+		return nil, err
+	}
+
+	resp, err := w.adjustWalletProfile(ctx, client, adjustment)
+
+	var status int64
+	var balance *float64
+	if resp != nil {
+
+		status = resp.Status
+		if err == nil && resp.Status == 1 {
+
+			balance = &resp.Balance
+		}
+	}
+
+	w.audit(ctx, record, status, balance, err)
+	done(status, err)
+	endSpan(span, status, err)
+	return resp, err
+}
+
+func (w *Wallet) BetRollback(ctx context.Context, client Client, rollback Rollback) (*RollbackTransactionResponse, error) {
+
+	ctx = operationContext(ctx, OperationRollback, client.ID, rollback.PlayerID, rollback.RoundID, rollback.TransactionID)
+	ctx, span := w.startSpan(ctx, "BetRollback", OperationRollback, client,
+		append(transactionAttributes(rollback.PlayerID, "", rollback.SessionID, rollback.RoundID, rollback.TransactionID, rollback.Amount),
+			attrDebitID.String(rollback.DebitTransactionID))...)
+	done := w.Metrics.begin(ctx, OperationRollback, client.ID)
+	record := AuditRecord{
+		Operation:          OperationRollback,
+		ClientID:           client.ID,
+		PlayerID:           rollback.PlayerID,
+		SessionID:          rollback.SessionID,
+		RoundID:            rollback.RoundID,
+		TransactionID:      rollback.TransactionID,
+		DebitTransactionID: rollback.DebitTransactionID,
+		Amount:             rollback.Amount,
+		StartedAt:          time.Now(),
+	}
+
+	err := w.auditSent(ctx, record)
+	if err != nil {
+
+		done(0, err)
+		endSpan(span, 0, err)
+		return nil, err
+	}
+
+	resp, err := w.betRollback(ctx, client, rollback)
+
+	var status int64
+	var balance *float64
+	if resp != nil {
+
+		status = resp.Status
+		if err == nil && resp.Status == 1 {
+
+			balance = &resp.Balance
+		}
+	}
+
+	w.audit(ctx, record, status, balance, err)
+	done(status, err)
+	endSpan(span, status, err)
+	return resp, err
+}
+
+// post sends payload with the client's primary credential. When the operator answers 401
+// the remaining usable credentials are tried in turn, and the one that is accepted is
+// reported to the CredentialRecorder.
+func (w *Wallet) post(ctx context.Context, operation string, client Client, endpoint string, headers map[string]string, payload interface{}) (int, string) {
+
+	userAgent := w.Provider.userAgent()
+	w.injectTraceContext(ctx, headers)
+
+	span := trace.SpanFromContext(ctx)
+	credentials := client.outboundCredentials(time.Now())
+
+	var status int
+	var response string
+
+	for i, credential := range credentials {
+
+		attempt := make(map[string]string, len(headers)+1)
+		for k, v := range headers {
+
+			attempt[k] = v
+		}
+
+		attempt[credential.Header] = credential.Secret
+
+		if i > 0 {
+
+			span.AddEvent("wallet.retry", trace.WithAttributes(
+				attrAttempt.Int(i+1),
+				attrCredentialID.Int64(credential.ID),
+				attrHTTPStatus.Int(status),
+			))
+		}
+
+		started := time.Now()
+		status, response = httpPost(ctx, w.httpClient(), endpoint, userAgent, attempt, payload, w.loggingPolicy(), w.log())
+		w.Metrics.recordHTTP(ctx, operation, client.ID, status, time.Since(started), i > 0)
+
+		if status != http.StatusUnauthorized {
+
+			if i > 0 && w.Credentials != nil && credential.ID > 0 {
+
+				w.Credentials.RecordCredentialUse(ctx, client.ID, credential.ID)
+			}
+
+			span.SetAttributes(attrHTTPStatus.Int(status))
+			return status, response
+		}
+	}
+
+	span.SetAttributes(attrHTTPStatus.Int(status))
+	return status, response
+}
+
+// httpClient returns HTTPClient, or the shared client of NewNetClient when it is nil.
+func (w *Wallet) httpClient() *http.Client {
+
+	if w.HTTPClient != nil {
+
+		return w.HTTPClient
+	}
+
+	return NewNetClient()
+}
+
+func (w *Wallet) log() contextLogger {
+
+	return logTo(w.Logger)
+}
+
+func (w *Wallet) loggingPolicy() LoggingPolicy {
+
+	if w.Logging != nil {
+
+		return *w.Logging
+	}
+
+	return DefaultLoggingPolicy()
+}
+
+func (w *Wallet) refreshProfileCache(ctx context.Context, clientID int64, playerID string, balance, bonus float64) {
+
+	if w.ProfileCache != nil {
+
+		w.ProfileCache.UpdateBalance(ctx, clientID, playerID, balance, bonus)
+	}
+}
+
+func (w *Wallet) invalidateProfileCache(ctx context.Context, clientID int64, playerID string) {
+
+	if w.ProfileCache != nil {
+
+		w.ProfileCache.Invalidate(ctx, clientID, playerID)
+	}
+}